@@ -0,0 +1,228 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+)
+
+// running serialises backups and restores within a process.
+var running sync.Mutex
+
+// Create writes an archive to output, which must not exist; an empty output
+// names it after its ID in the backup directory. With a base manifest only
+// media that is new or changed since that backup is stored.
+//
+// The database snapshot is consistent even while the server is writing;
+// media is immutable once uploaded, so copying it afterwards is safe.
+func Create(output string, base *Manifest) (*Manifest, error) {
+	if !running.TryLock() {
+		return nil, ErrBusy
+	}
+	defer running.Unlock()
+
+	now := time.Now().UTC()
+	m := &Manifest{
+		Version:   manifestVersion,
+		ID:        now.Format("20060102T150405.000Z"),
+		CreatedAt: now,
+		Media:     []File{},
+	}
+	if base != nil {
+		m.Base = base.ID
+	}
+
+	if output == "" {
+		output = filepath.Join(config.AppConfig.BackupDir, FileName(m.ID))
+	}
+	if _, err := os.Stat(output); err == nil {
+		return nil, fmt.Errorf("%s already exists", output)
+	}
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return nil, err
+	}
+
+	stage, err := os.MkdirTemp(filepath.Dir(output), ".backup-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(stage)
+
+	snapshot := filepath.Join(stage, databaseName)
+	if err := database.Snapshot(snapshot); err != nil {
+		return nil, fmt.Errorf("snapshot database: %w", err)
+	}
+	if m.Database, err = describe(snapshot, databaseName); err != nil {
+		return nil, err
+	}
+	m.Database.Archive = m.ID
+
+	names, err := referencedMedia(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := make(map[string]File)
+	if base != nil {
+		for _, f := range base.Media {
+			previous[f.Name] = f
+		}
+	}
+	for _, name := range names {
+		path := filepath.Join(config.AppConfig.UploadDir, name)
+		stat, err := os.Stat(path)
+		if err != nil {
+			m.Missing = append(m.Missing, name)
+			continue
+		}
+
+		f := File{Name: name, Size: stat.Size(), ModTime: stat.ModTime().UnixNano(), Archive: m.ID}
+		prev, seen := previous[name]
+		if seen && prev.Size == f.Size && prev.ModTime == f.ModTime {
+			f.SHA256, f.Archive = prev.SHA256, prev.Archive
+		} else {
+			if f.SHA256, err = hashFile(path); err != nil {
+				return nil, err
+			}
+			if seen && prev.SHA256 == f.SHA256 {
+				f.Archive = prev.Archive
+			}
+		}
+		m.Media = append(m.Media, f)
+	}
+
+	partial := output + ".part"
+	if err := writeArchive(partial, m, snapshot); err != nil {
+		os.Remove(partial)
+		return nil, err
+	}
+	if err := os.Rename(partial, output); err != nil {
+		os.Remove(partial)
+		return nil, err
+	}
+	return m, nil
+}
+
+func writeArchive(path string, m *Manifest, snapshot string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: manifestName, Mode: 0644, Size: int64(len(data)), ModTime: m.CreatedAt}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	if err := addFile(tw, databaseName, snapshot, m.Database.Size); err != nil {
+		return err
+	}
+	for _, f := range m.Media {
+		if f.Archive != m.ID {
+			continue
+		}
+		if err := addFile(tw, mediaPrefix+f.Name, filepath.Join(config.AppConfig.UploadDir, f.Name), f.Size); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+func addFile(tw *tar.Writer, name, path string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, ModTime: time.Now()}); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(tw, f, size); err != nil {
+		return fmt.Errorf("%s changed while it was backed up: %w", name, err)
+	}
+	return nil
+}
+
+// referencedMedia lists the upload files the snapshot refers to. Orphaned
+// files and the variant cache are not backed up.
+func referencedMedia(snapshot string) ([]string, error) {
+	db, err := sql.Open("sqlite", "file:"+snapshot+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT filename FROM images UNION SELECT avatar FROM users WHERE avatar != ''")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if validName(name) {
+			names = append(names, name)
+		}
+	}
+	return names, rows.Err()
+}
+
+func describe(path, name string) (File, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return File{}, err
+	}
+	sum, err := hashFile(path)
+	if err != nil {
+		return File{}, err
+	}
+	return File{Name: name, Size: stat.Size(), SHA256: sum}, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
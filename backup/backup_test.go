@@ -0,0 +1,277 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+)
+
+// connect points the configuration at a fresh database, upload directory
+// and backup directory, and opens the database.
+func connect(t *testing.T) {
+	t.Helper()
+	database.Close()
+	dir := t.TempDir()
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("DATABASE_PATH", filepath.Join(dir, "test.db"))
+	t.Setenv("UPLOAD_DIR", filepath.Join(dir, "uploads"))
+	t.Setenv("BACKUP_DIR", filepath.Join(dir, "backups"))
+	if _, err := config.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(config.AppConfig.UploadDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	database.Connect()
+	t.Cleanup(database.Close)
+}
+
+// addImage stores an image row, tagged, and its file in the upload directory.
+func addImage(t *testing.T, name, title, ocr, tag string) {
+	t.Helper()
+	res, err := database.DB.Exec("INSERT INTO images (filename, original_name, uploader_id, status, title, ocr_text) VALUES (?, ?, 1, 'approved', ?, ?)",
+		name, name+".png", title, ocr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := res.LastInsertId()
+	if _, err := database.DB.Exec("INSERT OR IGNORE INTO tags (name) VALUES (?)", tag); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.DB.Exec("INSERT INTO image_tags (image_id, tag_id) SELECT ?, id FROM tags WHERE name = ?", id, tag); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(config.AppConfig.UploadDir, name), []byte("webp bytes of "+name), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// state captures what a restore must bring back: row counts, what the search
+// index finds, and the media files.
+type state struct {
+	rows   map[string]int
+	search map[string]int
+	media  map[string]string
+}
+
+func capture(t *testing.T) state {
+	t.Helper()
+	s := state{rows: map[string]int{}, search: map[string]int{}, media: map[string]string{}}
+	for _, table := range []string{"users", "images", "tags", "image_tags"} {
+		var n int
+		if err := database.DB.QueryRow(`SELECT COUNT(*) FROM "` + table + `"`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		s.rows[table] = n
+	}
+	for _, query := range []string{"猫猫头", "sunset", "表情包", "nothing"} {
+		var n int
+		if err := database.DB.QueryRow("SELECT COUNT(*) FROM images_fts WHERE images_fts MATCH ?", `"`+query+`"`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		s.search[query] = n
+	}
+	entries, err := os.ReadDir(config.AppConfig.UploadDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(config.AppConfig.UploadDir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.media[e.Name()] = string(data)
+	}
+	return s
+}
+
+// backupTwice makes a full backup of two images, adds a third, and makes an
+// incremental backup on top. It returns the state at the incremental backup
+// and both manifests.
+func backupTwice(t *testing.T) (state, *Manifest, *Manifest) {
+	t.Helper()
+	connect(t)
+	if _, err := database.DB.Exec("INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')"); err != nil {
+		t.Fatal(err)
+	}
+	addImage(t, "a.webp", "猫猫头 sunset", "", "cat")
+	addImage(t, "b.webp", "", "今天也是表情包", "meme")
+
+	full, err := Create("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Archive IDs are timestamps to the millisecond
+	time.Sleep(2 * time.Millisecond)
+	addImage(t, "c.webp", "another sunset", "", "cat")
+	incremental, err := Create("", full)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(full.Media) != 2 || full.Included() != 2 {
+		t.Errorf("full backup holds %d of %d media, want 2 of 2", full.Included(), len(full.Media))
+	}
+	if incremental.Base != full.ID || len(incremental.Media) != 3 || incremental.Included() != 1 {
+		t.Errorf("incremental backup on %q holds %d of %d media, want 1 of 3 on %q", incremental.Base, incremental.Included(), len(incremental.Media), full.ID)
+	}
+	return capture(t), full, incremental
+}
+
+func TestRestoreIncremental(t *testing.T) {
+	want, _, incremental := backupTwice(t)
+	archive := filepath.Join(config.AppConfig.BackupDir, FileName(incremental.ID))
+
+	connect(t)
+	if _, err := Restore(archive); err != nil {
+		t.Fatal(err)
+	}
+	got := capture(t)
+	if fmt.Sprint(got.rows) != fmt.Sprint(want.rows) {
+		t.Errorf("rows after restore = %v, want %v", got.rows, want.rows)
+	}
+	if fmt.Sprint(got.search) != fmt.Sprint(want.search) {
+		t.Errorf("search matches after restore = %v, want %v", got.search, want.search)
+	}
+	if want.search["sunset"] != 2 || want.search["表情包"] != 1 {
+		t.Errorf("search matches before backup = %v, want 2 for sunset and 1 for 表情包", want.search)
+	}
+	if fmt.Sprint(got.media) != fmt.Sprint(want.media) {
+		t.Errorf("media after restore = %v, want %v", got.media, want.media)
+	}
+
+	// The search triggers are back: new rows are indexed again
+	addImage(t, "d.webp", "sunset again", "", "dog")
+	var n int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM images_fts WHERE images_fts MATCH '"sunset"'`).Scan(&n)
+	if n != 3 {
+		t.Errorf("%d images match sunset after an upload following the restore, want 3", n)
+	}
+}
+
+// rewrite copies the archive at src to dst with its manifest changed by edit.
+func rewrite(t *testing.T, src, dst string, edit func(*Manifest)) {
+	t.Helper()
+	in, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+
+	var out bytes.Buffer
+	gw := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gw)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name == manifestName {
+			var m Manifest
+			if err := json.Unmarshal(data, &m); err != nil {
+				t.Fatal(err)
+			}
+			edit(&m)
+			if data, err = json.Marshal(m); err != nil {
+				t.Fatal(err)
+			}
+			hdr.Size = int64(len(data))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(data)
+	}
+	tw.Close()
+	gw.Close()
+	if err := os.WriteFile(dst, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestoreRejectsBadArchives(t *testing.T) {
+	_, full, incremental := backupTwice(t)
+	backups := config.AppConfig.BackupDir
+	fullPath := filepath.Join(backups, FileName(full.ID))
+	incrementalPath := filepath.Join(backups, FileName(incremental.ID))
+	wrongHash := strings.Repeat("0", 64)
+
+	tests := []struct {
+		name  string
+		setup func(dir string) string // returns the archive to restore
+		err   string
+	}{
+		{"wrong media hash", func(dir string) string {
+			path := filepath.Join(dir, FileName(full.ID))
+			rewrite(t, fullPath, path, func(m *Manifest) { m.Media[len(m.Media)-1].SHA256 = wrongHash })
+			return path
+		}, "does not match its hash"},
+		{"wrong database hash", func(dir string) string {
+			path := filepath.Join(dir, FileName(full.ID))
+			rewrite(t, fullPath, path, func(m *Manifest) { m.Database.SHA256 = wrongHash })
+			return path
+		}, "does not match its hash"},
+		{"wrong hash of media in the base", func(dir string) string {
+			rewrite(t, fullPath, filepath.Join(dir, FileName(full.ID)), func(*Manifest) {})
+			path := filepath.Join(dir, FileName(incremental.ID))
+			rewrite(t, incrementalPath, path, func(m *Manifest) {
+				for i := range m.Media {
+					if m.Media[i].Archive == full.ID {
+						m.Media[i].SHA256 = wrongHash
+					}
+				}
+			})
+			return path
+		}, "does not match its hash"},
+		{"missing base archive", func(dir string) string {
+			path := filepath.Join(dir, FileName(incremental.ID))
+			rewrite(t, incrementalPath, path, func(*Manifest) {})
+			return path
+		}, "needs archive " + full.ID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := tt.setup(t.TempDir())
+			connect(t)
+			_, err := Restore(archive)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Restore = %v, want an error containing %q", err, tt.err)
+			}
+			entries, err := os.ReadDir(config.AppConfig.UploadDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range entries {
+				t.Errorf("%s was put in place by a rejected restore", e.Name())
+			}
+			var images int
+			database.DB.QueryRow("SELECT COUNT(*) FROM images").Scan(&images)
+			if images != 0 {
+				t.Errorf("%d images after a rejected restore, want 0", images)
+			}
+		})
+	}
+}
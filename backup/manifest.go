@@ -0,0 +1,161 @@
+// Package backup writes and restores archives of the database and the
+// uploaded media. An archive is a gzipped tar holding manifest.json first,
+// then a VACUUM INTO snapshot of the database and the media files. An
+// incremental archive leaves out media an earlier archive already holds; its
+// manifest names the archive each file is in, and restore reads those from
+// the same directory.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	manifestName  = "manifest.json"
+	databaseName  = "database.db"
+	mediaPrefix   = "media/"
+	archiveSuffix = ".tar.gz"
+
+	manifestVersion = 1
+)
+
+// ErrBusy is returned when another backup or restore is running.
+var ErrBusy = errors.New("a backup or restore is already running")
+
+// File describes one file of a backup.
+type File struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256"`
+	ModTime int64  `json:"mod_time,omitempty"` // unix nanoseconds, to skip rehashing unchanged media
+	Archive string `json:"archive,omitempty"`  // ID of the archive holding the bytes
+}
+
+// Manifest lists everything a backup restores.
+type Manifest struct {
+	Version   int       `json:"version"`
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Base      string    `json:"base,omitempty"` // archive an incremental backup builds on
+	Database  File      `json:"database"`
+	Media     []File    `json:"media"`
+	Missing   []string  `json:"missing,omitempty"` // referenced media that was not on disk
+}
+
+// Included returns how many media files are stored in the archive itself.
+func (m *Manifest) Included() int {
+	n := 0
+	for _, f := range m.Media {
+		if f.Archive == m.ID {
+			n++
+		}
+	}
+	return n
+}
+
+// Info describes an archive in a backup directory.
+type Info struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	ID       string    `json:"id"`
+	Base     string    `json:"base,omitempty"`
+	Created  time.Time `json:"created_at"`
+	Media    int       `json:"media"`
+	Included int       `json:"included"`
+}
+
+// FileName returns the default file name of the archive with the given ID.
+func FileName(id string) string {
+	return "backup-" + id + archiveSuffix
+}
+
+// ReadManifest reads the manifest at the start of an archive.
+func ReadManifest(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: not a backup archive: %w", path, err)
+	}
+	tr := tar.NewReader(gz)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != manifestName {
+		return nil, fmt.Errorf("%s: not a backup archive: no manifest", path)
+	}
+	return decodeManifest(tr)
+}
+
+func decodeManifest(r io.Reader) (*Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	if m.ID == "" || m.Database.SHA256 == "" {
+		return nil, errors.New("invalid manifest: missing id or database")
+	}
+	return &m, nil
+}
+
+// List returns the archives in dir, oldest first. Files that are not backup
+// archives are skipped.
+func List(dir string) ([]Info, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+archiveSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	list := []Info{}
+	for _, path := range paths {
+		m, err := ReadManifest(path)
+		if err != nil {
+			continue
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		list = append(list, Info{
+			Name:     filepath.Base(path),
+			Size:     stat.Size(),
+			ID:       m.ID,
+			Base:     m.Base,
+			Created:  m.CreatedAt,
+			Media:    len(m.Media),
+			Included: m.Included(),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list, nil
+}
+
+// Latest returns the newest archive in dir, or nil when there is none.
+func Latest(dir string) (*Manifest, error) {
+	list, err := List(dir)
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	return ReadManifest(filepath.Join(dir, list[len(list)-1].Name))
+}
+
+// validName reports whether name is a plain file name, so archive entries
+// cannot write outside the directory they are restored into.
+func validName(name string) bool {
+	return name != "" && name == filepath.Base(name) && !strings.HasPrefix(name, ".")
+}
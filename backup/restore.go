@@ -0,0 +1,197 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+)
+
+// Restore replaces the database and media with the contents of the archive
+// at path. Archives an incremental backup builds on must be in the same
+// directory. Everything is extracted to a staging directory and checked
+// against the manifest hashes first; nothing live is touched unless every
+// file verifies.
+func Restore(path string) (*Manifest, error) {
+	if !running.TryLock() {
+		return nil, ErrBusy
+	}
+	defer running.Unlock()
+
+	m, err := ReadManifest(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Group the media by the archive holding it
+	wanted := map[string]map[string]File{m.ID: {}}
+	for _, f := range m.Media {
+		if !validName(f.Name) {
+			return nil, fmt.Errorf("invalid media name %q in manifest", f.Name)
+		}
+		if wanted[f.Archive] == nil {
+			wanted[f.Archive] = make(map[string]File)
+		}
+		wanted[f.Archive][f.Name] = f
+	}
+	archives, err := findArchives(filepath.Dir(path), m.ID, path, wanted)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(config.AppConfig.UploadDir, 0755); err != nil {
+		return nil, err
+	}
+	// Media is staged inside the upload directory so it can be renamed into
+	// place, the database next to the live one, away from /uploads
+	mediaStage := filepath.Join(config.AppConfig.UploadDir, ".restore-"+m.ID)
+	os.RemoveAll(mediaStage)
+	if err := os.MkdirAll(mediaStage, 0755); err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(mediaStage)
+	dbStage, err := os.MkdirTemp(filepath.Dir(config.AppConfig.DatabasePath), ".restore-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dbStage)
+	snapshot := filepath.Join(dbStage, databaseName)
+
+	for id, archive := range archives {
+		db := ""
+		if id == m.ID {
+			db = snapshot
+		}
+		if err := extract(archive, id, db, &m.Database, wanted[id], mediaStage); err != nil {
+			return nil, err
+		}
+		for name := range wanted[id] {
+			return nil, fmt.Errorf("%s: missing %s", filepath.Base(archive), name)
+		}
+	}
+
+	if err := database.CheckSnapshot(snapshot); err != nil {
+		return nil, err
+	}
+
+	// Media first: it is only ever added to, so if the database swap fails
+	// the current data is still complete
+	for _, f := range m.Media {
+		if err := os.Rename(filepath.Join(mediaStage, f.Name), filepath.Join(config.AppConfig.UploadDir, f.Name)); err != nil {
+			return nil, err
+		}
+	}
+	if err := database.Restore(snapshot); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// findArchives locates the archive of every ID in wanted, looking through
+// the other archives in dir for those an incremental backup refers to.
+func findArchives(dir, id, path string, wanted map[string]map[string]File) (map[string]string, error) {
+	archives := map[string]string{id: path}
+	if len(wanted) == 1 {
+		return archives, nil
+	}
+
+	list, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range list {
+		if _, need := wanted[info.ID]; need && archives[info.ID] == "" {
+			archives[info.ID] = filepath.Join(dir, info.Name)
+		}
+	}
+	for need := range wanted {
+		if archives[need] == "" {
+			return nil, fmt.Errorf("backup %s needs archive %s, which is not in %s", id, need, dir)
+		}
+	}
+	return archives, nil
+}
+
+// extract writes the database to dbPath (when set) and the wanted media of
+// one archive into mediaDir, verifying each against the manifest. Verified
+// media is removed from wanted.
+func extract(path, id, dbPath string, db *File, wanted map[string]File, mediaDir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	tr := tar.NewReader(gz)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+
+		switch {
+		case hdr.Name == manifestName:
+			m, err := decodeManifest(tr)
+			if err != nil {
+				return fmt.Errorf("%s: %w", filepath.Base(path), err)
+			}
+			if m.ID != id {
+				return fmt.Errorf("%s: expected backup %s, found %s", filepath.Base(path), id, m.ID)
+			}
+		case hdr.Name == databaseName && dbPath != "":
+			if err := writeVerified(dbPath, tr, *db); err != nil {
+				return err
+			}
+			dbPath = ""
+		case strings.HasPrefix(hdr.Name, mediaPrefix):
+			name := strings.TrimPrefix(hdr.Name, mediaPrefix)
+			want, ok := wanted[name]
+			if !ok {
+				continue
+			}
+			if err := writeVerified(filepath.Join(mediaDir, name), tr, want); err != nil {
+				return err
+			}
+			delete(wanted, name)
+		}
+	}
+
+	if dbPath != "" {
+		return fmt.Errorf("%s: missing %s", filepath.Base(path), databaseName)
+	}
+	return nil
+}
+
+func writeVerified(dst string, r io.Reader, want File) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, h), r)
+	if err != nil {
+		return err
+	}
+	if n != want.Size || hex.EncodeToString(h.Sum(nil)) != want.SHA256 {
+		return fmt.Errorf("%s does not match its hash in the manifest", want.Name)
+	}
+	return out.Close()
+}
@@ -0,0 +1,210 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"hyw-webpics/models"
+)
+
+// Register creates an account. It does not log in.
+func (c *Client) Register(ctx context.Context, username, password string) (*Registration, error) {
+	body := map[string]string{"username": username, "password": password}
+	return call[Registration](ctx, c, http.MethodPost, "/api/auth/register", nil, body)
+}
+
+// Login signs in and keeps the session's tokens for later calls. For an
+// account with two-factor authentication the session only has a Challenge;
+// finish with LoginTwoFactor.
+func (c *Client) Login(ctx context.Context, username, password string) (*Session, error) {
+	body := map[string]string{"username": username, "password": password}
+	return c.session(call[Session](ctx, c, http.MethodPost, "/api/auth/login", nil, body))
+}
+
+// LoginTwoFactor completes a login with a TOTP or recovery code.
+func (c *Client) LoginTwoFactor(ctx context.Context, challenge, code string) (*Session, error) {
+	body := map[string]string{"challenge": challenge, "code": code}
+	return c.session(call[Session](ctx, c, http.MethodPost, "/api/auth/login/2fa", nil, body))
+}
+
+// Refresh exchanges the refresh token for new tokens.
+func (c *Client) Refresh(ctx context.Context) (*Session, error) {
+	body := map[string]string{"refresh_token": c.RefreshToken}
+	return c.session(call[Session](ctx, c, http.MethodPost, "/api/auth/refresh", nil, body))
+}
+
+// session keeps the tokens of a successful login.
+func (c *Client) session(s *Session, err error) (*Session, error) {
+	if err != nil {
+		return nil, err
+	}
+	if s.Token != "" {
+		c.Token, c.RefreshToken = s.Token, s.RefreshToken
+	}
+	return s, nil
+}
+
+// Logout revokes the refresh token and forgets both tokens.
+func (c *Client) Logout(ctx context.Context) error {
+	body := map[string]string{"refresh_token": c.RefreshToken}
+	if err := c.do(ctx, http.MethodPost, "/api/auth/logout", nil, body, nil); err != nil {
+		return err
+	}
+	c.Token, c.RefreshToken = "", ""
+	return nil
+}
+
+// LogoutAll revokes every session of the current user.
+func (c *Client) LogoutAll(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/api/auth/logout-all", nil, nil, nil)
+}
+
+// Me returns the current user.
+func (c *Client) Me(ctx context.Context) (*models.UserSummary, error) {
+	return call[models.UserSummary](ctx, c, http.MethodGet, "/api/auth/me", nil, nil)
+}
+
+// MyFavorites returns a page of the current user's favorites.
+func (c *Client) MyFavorites(ctx context.Context, opts PageOptions) (*ImagePage, error) {
+	return call[ImagePage](ctx, c, http.MethodGet, "/api/me/favorites", opts.query(), nil)
+}
+
+// MyQuota returns the current user's trust level and remaining upload quota.
+func (c *Client) MyQuota(ctx context.Context) (*Quota, error) {
+	return call[Quota](ctx, c, http.MethodGet, "/api/me/quota", nil, nil)
+}
+
+// ChangePassword changes the current user's password. Every other session
+// is signed out; the client continues with the returned one.
+func (c *Client) ChangePassword(ctx context.Context, current, next string) (*Session, error) {
+	body := map[string]string{"current_password": current, "new_password": next}
+	return c.session(call[Session](ctx, c, http.MethodPut, "/api/me/password", nil, body))
+}
+
+// UpdateProfile sets the current user's display name.
+func (c *Client) UpdateProfile(ctx context.Context, displayName string) (*models.UserSummary, error) {
+	body := map[string]string{"display_name": displayName}
+	return call[models.UserSummary](ctx, c, http.MethodPut, "/api/me/profile", nil, body)
+}
+
+// UploadAvatar replaces the current user's avatar.
+func (c *Client) UploadAvatar(ctx context.Context, file File) (*models.UserSummary, error) {
+	var u models.UserSummary
+	if err := c.upload(ctx, "/api/me/avatar", "avatar", []File{file}, nil, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// DeleteAvatar removes the current user's avatar.
+func (c *Client) DeleteAvatar(ctx context.Context) (*models.UserSummary, error) {
+	return call[models.UserSummary](ctx, c, http.MethodDelete, "/api/me/avatar", nil, nil)
+}
+
+// DeleteAccount deletes the current user. uploads is anonymize, to keep
+// their images without an uploader, or remove.
+func (c *Client) DeleteAccount(ctx context.Context, password, uploads string) (*AccountDeleted, error) {
+	body := map[string]string{"password": password, "uploads": uploads}
+	return call[AccountDeleted](ctx, c, http.MethodDelete, "/api/me", nil, body)
+}
+
+// APIKeys lists the current user's API keys.
+func (c *Client) APIKeys(ctx context.Context) (*APIKeyList, error) {
+	return call[APIKeyList](ctx, c, http.MethodGet, "/api/me/api-keys", nil, nil)
+}
+
+// CreateAPIKey creates an API key limited to scopes (read, upload,
+// favorite). expiresInDays is 0 for a key that never expires.
+func (c *Client) CreateAPIKey(ctx context.Context, name string, scopes []string, expiresInDays int) (*NewAPIKey, error) {
+	body := map[string]interface{}{"name": name, "scopes": scopes, "expires_in_days": expiresInDays}
+	return call[NewAPIKey](ctx, c, http.MethodPost, "/api/me/api-keys", nil, body)
+}
+
+// RevokeAPIKey revokes one of the current user's API keys.
+func (c *Client) RevokeAPIKey(ctx context.Context, keyID int64) error {
+	return c.do(ctx, http.MethodDelete, "/api/me/api-keys/"+id(keyID), nil, nil, nil)
+}
+
+// TwoFactorStatus reports whether the current user has two-factor
+// authentication.
+func (c *Client) TwoFactorStatus(ctx context.Context) (*TwoFactorStatus, error) {
+	return call[TwoFactorStatus](ctx, c, http.MethodGet, "/api/me/2fa", nil, nil)
+}
+
+// SetupTwoFactor starts enabling two-factor authentication.
+func (c *Client) SetupTwoFactor(ctx context.Context) (*TwoFactorSetup, error) {
+	return call[TwoFactorSetup](ctx, c, http.MethodPost, "/api/me/2fa/setup", nil, nil)
+}
+
+// EnableTwoFactor confirms the secret from SetupTwoFactor with a code.
+func (c *Client) EnableTwoFactor(ctx context.Context, code string) (*RecoveryCodes, error) {
+	return call[RecoveryCodes](ctx, c, http.MethodPost, "/api/me/2fa/enable", nil, map[string]string{"code": code})
+}
+
+// DisableTwoFactor turns two-factor authentication off.
+func (c *Client) DisableTwoFactor(ctx context.Context, password, code string) error {
+	body := map[string]string{"password": password, "code": code}
+	return c.do(ctx, http.MethodPost, "/api/me/2fa/disable", nil, body, nil)
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes.
+func (c *Client) RegenerateRecoveryCodes(ctx context.Context, code string) (*RecoveryCodes, error) {
+	return call[RecoveryCodes](ctx, c, http.MethodPost, "/api/me/2fa/recovery-codes", nil, map[string]string{"code": code})
+}
+
+// CollectionOptions are the fields of a collection to set; nil fields are
+// left unchanged. Visibility is private, unlisted or public.
+type CollectionOptions struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Visibility  *string `json:"visibility,omitempty"`
+}
+
+// PublicCollections returns a page of public collections.
+func (c *Client) PublicCollections(ctx context.Context, page, limit int) (*CollectionPage, error) {
+	return call[CollectionPage](ctx, c, http.MethodGet, "/api/collections", pageQuery(page, limit), nil)
+}
+
+// MyCollections returns a page of the current user's collections.
+func (c *Client) MyCollections(ctx context.Context, page, limit int) (*CollectionPage, error) {
+	return call[CollectionPage](ctx, c, http.MethodGet, "/api/me/collections", pageQuery(page, limit), nil)
+}
+
+// Collection returns a collection with a page of its images.
+func (c *Client) Collection(ctx context.Context, slug string, page, limit int) (*CollectionDetail, error) {
+	return call[CollectionDetail](ctx, c, http.MethodGet, "/api/collections/"+url.PathEscape(slug), pageQuery(page, limit), nil)
+}
+
+// CreateCollection creates a collection; Name is required.
+func (c *Client) CreateCollection(ctx context.Context, opts CollectionOptions) (*models.Collection, error) {
+	return call[models.Collection](ctx, c, http.MethodPost, "/api/collections", nil, opts)
+}
+
+// UpdateCollection changes one of the current user's collections.
+func (c *Client) UpdateCollection(ctx context.Context, slug string, opts CollectionOptions) (*models.Collection, error) {
+	return call[models.Collection](ctx, c, http.MethodPut, "/api/collections/"+url.PathEscape(slug), nil, opts)
+}
+
+// DeleteCollection deletes one of the current user's collections.
+func (c *Client) DeleteCollection(ctx context.Context, slug string) error {
+	return c.do(ctx, http.MethodDelete, "/api/collections/"+url.PathEscape(slug), nil, nil, nil)
+}
+
+// AddToCollection appends an image to a collection.
+func (c *Client) AddToCollection(ctx context.Context, slug string, imageID int64) error {
+	body := map[string]int64{"image_id": imageID}
+	return c.do(ctx, http.MethodPost, "/api/collections/"+url.PathEscape(slug)+"/images", nil, body, nil)
+}
+
+// RemoveFromCollection removes an image from a collection.
+func (c *Client) RemoveFromCollection(ctx context.Context, slug string, imageID int64) error {
+	return c.do(ctx, http.MethodDelete, "/api/collections/"+url.PathEscape(slug)+"/images/"+id(imageID), nil, nil, nil)
+}
+
+// ReorderCollection sets the order of a collection's images; imageIDs must
+// list every image in it.
+func (c *Client) ReorderCollection(ctx context.Context, slug string, imageIDs []int64) error {
+	body := map[string][]int64{"image_ids": imageIDs}
+	return c.do(ctx, http.MethodPut, "/api/collections/"+url.PathEscape(slug)+"/order", nil, body, nil)
+}
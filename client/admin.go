@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+
+	"hyw-webpics/models"
+)
+
+// The methods below need a moderator or admin account; category, bulk
+// delete, role and backup calls need an admin. API keys cannot moderate, so
+// log in first.
+
+// AdminStats returns the counters of the admin dashboard.
+func (c *Client) AdminStats(ctx context.Context) (*AdminStats, error) {
+	return call[AdminStats](ctx, c, http.MethodGet, "/api/admin/stats", nil, nil)
+}
+
+// PendingImages lists every image awaiting review.
+func (c *Client) PendingImages(ctx context.Context) (*PendingImages, error) {
+	return call[PendingImages](ctx, c, http.MethodGet, "/api/admin/pending", nil, nil)
+}
+
+// AdminImages returns a page of images of any status, or of one of
+// pending, approved and review.
+func (c *Client) AdminImages(ctx context.Context, status string, opts PageOptions) (*ImagePage, error) {
+	q := opts.query()
+	if status != "" {
+		q.Set("status", status)
+	}
+	return call[ImagePage](ctx, c, http.MethodGet, "/api/admin/images", q, nil)
+}
+
+// Approve publishes an image, filing it in a category.
+func (c *Client) Approve(ctx context.Context, imageID, categoryID int64) error {
+	body := map[string]int64{"category_id": categoryID}
+	return c.do(ctx, http.MethodPost, "/api/admin/approve/"+id(imageID), nil, body, nil)
+}
+
+// BulkApprove publishes images, filing them in a category.
+func (c *Client) BulkApprove(ctx context.Context, imageIDs []int64, categoryID int64) (*BulkResult, error) {
+	body := map[string]interface{}{"ids": imageIDs, "category_id": categoryID}
+	return call[BulkResult](ctx, c, http.MethodPost, "/api/admin/bulk-approve", nil, body)
+}
+
+// BulkDelete deletes images and their files.
+func (c *Client) BulkDelete(ctx context.Context, imageIDs []int64) (*BulkResult, error) {
+	body := map[string]interface{}{"ids": imageIDs}
+	return call[BulkResult](ctx, c, http.MethodPost, "/api/admin/bulk-delete", nil, body)
+}
+
+// DeleteImage deletes an image and its files.
+func (c *Client) DeleteImage(ctx context.Context, imageID int64) error {
+	return c.do(ctx, http.MethodDelete, "/api/admin/images/"+id(imageID), nil, nil, nil)
+}
+
+// SetImageText replaces an image's OCR text; OCR no longer overwrites it.
+func (c *Client) SetImageText(ctx context.Context, imageID int64, text string) (*ImageText, error) {
+	return call[ImageText](ctx, c, http.MethodPut, "/api/admin/images/"+id(imageID)+"/text", nil, map[string]string{"text": text})
+}
+
+// AdminComments returns a page of comments, newest first, optionally only
+// visible or hidden ones, or those of one image.
+func (c *Client) AdminComments(ctx context.Context, status string, imageID int64, page, limit int) (*CommentPage, error) {
+	q := pageQuery(page, limit)
+	if status != "" {
+		q.Set("status", status)
+	}
+	if imageID != 0 {
+		q.Set("image_id", id(imageID))
+	}
+	return call[CommentPage](ctx, c, http.MethodGet, "/api/admin/comments", q, nil)
+}
+
+// HideComment hides a comment, recording reason in the moderation log.
+func (c *Client) HideComment(ctx context.Context, commentID int64, reason string) error {
+	return c.do(ctx, http.MethodPost, "/api/admin/comments/"+id(commentID)+"/hide", nil, map[string]string{"reason": reason}, nil)
+}
+
+// UnhideComment makes a hidden comment visible again.
+func (c *Client) UnhideComment(ctx context.Context, commentID int64, reason string) error {
+	return c.do(ctx, http.MethodPost, "/api/admin/comments/"+id(commentID)+"/unhide", nil, map[string]string{"reason": reason}, nil)
+}
+
+// RemoveComment deletes any comment, recording reason in the moderation
+// log.
+func (c *Client) RemoveComment(ctx context.Context, commentID int64, reason string) error {
+	return c.do(ctx, http.MethodDelete, "/api/admin/comments/"+id(commentID), nil, map[string]string{"reason": reason}, nil)
+}
+
+// ModerationLog returns a page of the audit log, optionally of one target
+// type (image, comment, user) or image.
+func (c *Client) ModerationLog(ctx context.Context, targetType string, imageID int64, page, limit int) (*ModerationLog, error) {
+	q := pageQuery(page, limit)
+	if targetType != "" {
+		q.Set("target_type", targetType)
+	}
+	if imageID != 0 {
+		q.Set("image_id", id(imageID))
+	}
+	return call[ModerationLog](ctx, c, http.MethodGet, "/api/admin/moderation", q, nil)
+}
+
+// ReportQueue returns a page of images with open reports.
+func (c *Client) ReportQueue(ctx context.Context, page, limit int) (*ReportQueue, error) {
+	return call[ReportQueue](ctx, c, http.MethodGet, "/api/admin/reports", pageQuery(page, limit), nil)
+}
+
+// ImageReports lists every report filed against an image.
+func (c *Client) ImageReports(ctx context.Context, imageID int64) (*ImageReports, error) {
+	return call[ImageReports](ctx, c, http.MethodGet, "/api/admin/reports/images/"+id(imageID), nil, nil)
+}
+
+// ResolveReports closes an image's open reports. action is dismiss, which
+// republishes an image the reports sent back to review, or remove, which
+// deletes it.
+func (c *Client) ResolveReports(ctx context.Context, imageID int64, action, reason string) error {
+	body := map[string]string{"action": action, "reason": reason}
+	return c.do(ctx, http.MethodPost, "/api/admin/reports/images/"+id(imageID)+"/resolve", nil, body, nil)
+}
+
+// SetUserRole sets a user's role: user, moderator or admin.
+func (c *Client) SetUserRole(ctx context.Context, username, role string) (*RoleChange, error) {
+	return call[RoleChange](ctx, c, http.MethodPut, "/api/admin/users/"+url.PathEscape(username)+"/role", nil, map[string]string{"role": role})
+}
+
+// CreateCategory creates a category.
+func (c *Client) CreateCategory(ctx context.Context, name, slug string) (*models.Category, error) {
+	body := map[string]string{"name": name, "slug": slug}
+	return call[models.Category](ctx, c, http.MethodPost, "/api/admin/categories", nil, body)
+}
+
+// UpdateCategory renames a category.
+func (c *Client) UpdateCategory(ctx context.Context, categoryID int64, name, slug string) error {
+	body := map[string]string{"name": name, "slug": slug}
+	return c.do(ctx, http.MethodPut, "/api/admin/categories/"+id(categoryID), nil, body, nil)
+}
+
+// DeleteCategory deletes a category no image is filed in.
+func (c *Client) DeleteCategory(ctx context.Context, categoryID int64) error {
+	return c.do(ctx, http.MethodDelete, "/api/admin/categories/"+id(categoryID), nil, nil, nil)
+}
+
+// Backups lists the backup archives.
+func (c *Client) Backups(ctx context.Context) (*BackupList, error) {
+	return call[BackupList](ctx, c, http.MethodGet, "/api/admin/backups", nil, nil)
+}
+
+// CreateBackup archives the database and media. An incremental backup
+// stores only media changed since the latest archive.
+func (c *Client) CreateBackup(ctx context.Context, incremental bool) (*BackupCreated, error) {
+	body := map[string]bool{"incremental": incremental}
+	return call[BackupCreated](ctx, c, http.MethodPost, "/api/admin/backups", nil, body)
+}
+
+// DownloadBackup returns a backup archive. The caller closes it.
+func (c *Client) DownloadBackup(ctx context.Context, name string) (io.ReadCloser, error) {
+	body, _, err := c.stream(ctx, "/api/admin/backups/"+url.PathEscape(name), nil)
+	return body, err
+}
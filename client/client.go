@@ -0,0 +1,230 @@
+// Package client is a typed Go client for the HYW WebPics API, for bots and
+// scripts. Authenticate with an API key from /api/me/api-keys, or log in
+// with a username and password:
+//
+//	c := client.New("https://pics.example.com", os.Getenv("WEBPICS_API_KEY"))
+//	res, err := c.Random(ctx, client.RandomOptions{Tag: "cat"})
+//
+// Every method returns an *Error when the server answers with an error
+// status. The package depends only on the models package and the standard
+// library.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Client calls the API of one server. It is safe for concurrent use as long
+// as the tokens are not changed while requests are running.
+type Client struct {
+	// BaseURL is the server's address, e.g. https://pics.example.com.
+	BaseURL string
+	// Token is an API key or an access token, sent as a bearer token. Login
+	// and Refresh set it.
+	Token string
+	// RefreshToken renews the access token; Login and Refresh set it.
+	RefreshToken string
+	// HTTPClient makes the requests; http.DefaultClient when nil.
+	HTTPClient *http.Client
+}
+
+// New returns a client for the server at baseURL, authenticating with token
+// (an API key or access token), which may be empty.
+func New(baseURL, token string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/"), Token: token}
+}
+
+// Error is an error response. The server's error envelope is
+// {"error": "message"}; an upload whose files all failed lists why in
+// errors instead.
+type Error struct {
+	StatusCode int      `json:"-"`
+	Message    string   `json:"error"`
+	Errors     []string `json:"errors,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Errors) > 0 {
+		return fmt.Sprintf("webpics: %d %s: %s", e.StatusCode, e.Message, strings.Join(e.Errors, "; "))
+	}
+	return fmt.Sprintf("webpics: %d %s", e.StatusCode, e.Message)
+}
+
+// File is a file to upload.
+type File struct {
+	Name string
+	Body io.Reader
+}
+
+// send performs a request and returns the response for the caller to read.
+// Error statuses are turned into an *Error.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		if json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// do sends in as JSON, when it is not nil, and decodes the response into
+// out.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body, contentType = bytes.NewReader(data), "application/json"
+	}
+	resp, err := c.send(ctx, method, path, query, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Health checks that the server is up.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	return call[Health](ctx, c, http.MethodGet, "/healthz", nil, nil)
+}
+
+// call sends in as JSON and returns the decoded response.
+func call[T any](ctx context.Context, c *Client, method, path string, query url.Values, in interface{}) (*T, error) {
+	var out T
+	if err := c.do(ctx, method, path, query, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// upload sends files and fields as a multipart form.
+func (c *Client) upload(ctx context.Context, path, field string, files []File, fields map[string]string, out interface{}) error {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := w.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+	for _, f := range files {
+		part, err := w.CreateFormFile(field, f.Name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, f.Body); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	resp, err := c.send(ctx, http.MethodPost, path, nil, w.FormDataContentType(), &buf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// stream returns the body of a binary response. The caller closes it.
+func (c *Client) stream(ctx context.Context, path string, query url.Values) (io.ReadCloser, string, error) {
+	resp, err := c.send(ctx, http.MethodGet, path, query, "", nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return resp.Body, resp.Header.Get("Content-Type"), nil
+}
+
+func id(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+// pageQuery encodes page-mode pagination, leaving out zero values so the
+// server's defaults apply.
+func pageQuery(page, limit int) url.Values {
+	q := url.Values{}
+	if page > 0 {
+		q.Set("page", strconv.Itoa(page))
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	return q
+}
+
+// PageOptions selects a page of an image listing. Listings use page numbers
+// unless Cursor is set, or CursorMode for the first page; cursors stay
+// stable while images are added.
+type PageOptions struct {
+	Limit int
+	// Sort is newest (default), oldest, random, most-liked or most-viewed.
+	Sort string
+	// Seed fixes the shuffle of random order.
+	Seed       int64
+	Page       int
+	Cursor     string
+	CursorMode bool
+}
+
+func (o PageOptions) query() url.Values {
+	q := pageQuery(o.Page, o.Limit)
+	if o.Sort != "" {
+		q.Set("sort", o.Sort)
+	}
+	if o.Seed != 0 {
+		q.Set("seed", strconv.FormatInt(o.Seed, 10))
+	}
+	if o.Cursor != "" || o.CursorMode {
+		q.Set("cursor", o.Cursor)
+		q.Del("page")
+	}
+	return q
+}
@@ -0,0 +1,191 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"hyw-webpics/models"
+)
+
+// ListImages returns a page of approved images, optionally of one category.
+func (c *Client) ListImages(ctx context.Context, categoryID int64, opts PageOptions) (*ImagePage, error) {
+	q := opts.query()
+	if categoryID != 0 {
+		q.Set("category_id", id(categoryID))
+	}
+	return call[ImagePage](ctx, c, http.MethodGet, "/api/images", q, nil)
+}
+
+// Image returns an approved image.
+func (c *Client) Image(ctx context.Context, imageID int64) (*models.Image, error) {
+	return call[models.Image](ctx, c, http.MethodGet, "/api/images/"+id(imageID), nil, nil)
+}
+
+// RandomOptions filters random images.
+type RandomOptions struct {
+	CategoryID int64
+	Tag        string
+	// Animated restricts the pick to animated or still images when set.
+	Animated *bool
+	// Count is the number of images, 1 to 20; 1 when zero.
+	Count int
+	// Session continues a previous walk, which does not repeat an image
+	// until every match has been seen.
+	Session string
+	// Seed starts a reproducible walk.
+	Seed *int64
+}
+
+func (o RandomOptions) query() url.Values {
+	q := url.Values{}
+	if o.CategoryID != 0 {
+		q.Set("category_id", id(o.CategoryID))
+	}
+	if o.Tag != "" {
+		q.Set("tag", o.Tag)
+	}
+	if o.Animated != nil {
+		q.Set("animated", strconv.FormatBool(*o.Animated))
+	}
+	return q
+}
+
+// Random returns random approved images and the session to continue with.
+func (c *Client) Random(ctx context.Context, opts RandomOptions) (*RandomImages, error) {
+	q := opts.query()
+	// Without count the server answers with a bare image
+	count := opts.Count
+	if count == 0 {
+		count = 1
+	}
+	q.Set("count", strconv.Itoa(count))
+	if opts.Session != "" {
+		q.Set("session", opts.Session)
+	}
+	if opts.Seed != nil {
+		q.Set("seed", strconv.FormatInt(*opts.Seed, 10))
+	}
+	return call[RandomImages](ctx, c, http.MethodGet, "/api/images/random", q, nil)
+}
+
+// RandomFile returns the file of a random approved image and its content
+// type. width is 0 for the original or one of 128, 256, 512 and 1024;
+// format is webp (the default when empty) or png. The caller closes the
+// file.
+func (c *Client) RandomFile(ctx context.Context, opts RandomOptions, width int, format string) (io.ReadCloser, string, error) {
+	q := opts.query()
+	if width != 0 {
+		q.Set("size", strconv.Itoa(width))
+	}
+	if format != "" {
+		q.Set("format", format)
+	}
+	return c.stream(ctx, "/random.webp", q)
+}
+
+// Search finds approved images by title, tags and text.
+func (c *Client) Search(ctx context.Context, query string, page, limit int) (*SearchResults, error) {
+	q := pageQuery(page, limit)
+	q.Set("q", query)
+	return call[SearchResults](ctx, c, http.MethodGet, "/api/images/search", q, nil)
+}
+
+// Trending returns the hottest images of the day, week or month.
+func (c *Client) Trending(ctx context.Context, window string, limit int) (*TrendingImages, error) {
+	q := pageQuery(0, limit)
+	if window != "" {
+		q.Set("window", window)
+	}
+	return call[TrendingImages](ctx, c, http.MethodGet, "/api/images/trending", q, nil)
+}
+
+// UploadOptions describes an upload. Tags apply to every file.
+type UploadOptions struct {
+	Title      string
+	Tags       []string
+	CategoryID int64
+}
+
+// Upload uploads images for review. Files the server rejects are listed in
+// the result's Errors rather than failing the call, unless all of them fail.
+func (c *Client) Upload(ctx context.Context, files []File, opts UploadOptions) (*UploadResult, error) {
+	fields := map[string]string{
+		"title": opts.Title,
+		"tags":  strings.Join(opts.Tags, ","),
+	}
+	if opts.CategoryID != 0 {
+		fields["category_id"] = id(opts.CategoryID)
+	}
+	var res UploadResult
+	if err := c.upload(ctx, "/api/images/upload", "images", files, fields, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Share records that an image was shared or copied.
+func (c *Client) Share(ctx context.Context, imageID int64) error {
+	return c.do(ctx, http.MethodPost, "/api/images/"+id(imageID)+"/share", nil, nil, nil)
+}
+
+// Favorite adds an image to the current user's favorites.
+func (c *Client) Favorite(ctx context.Context, imageID int64) (*FavoriteState, error) {
+	return call[FavoriteState](ctx, c, http.MethodPost, "/api/images/"+id(imageID)+"/favorite", nil, nil)
+}
+
+// Unfavorite removes an image from the current user's favorites.
+func (c *Client) Unfavorite(ctx context.Context, imageID int64) (*FavoriteState, error) {
+	return call[FavoriteState](ctx, c, http.MethodDelete, "/api/images/"+id(imageID)+"/favorite", nil, nil)
+}
+
+// Report reports an image to the moderators. reason is one of spam, nsfw,
+// offensive, copyright or other.
+func (c *Client) Report(ctx context.Context, imageID int64, reason, details string) error {
+	body := map[string]string{"reason": reason, "details": details}
+	return c.do(ctx, http.MethodPost, "/api/images/"+id(imageID)+"/report", nil, body, nil)
+}
+
+// Comments returns a page of an image's comment threads.
+func (c *Client) Comments(ctx context.Context, imageID int64, page, limit int) (*CommentPage, error) {
+	return call[CommentPage](ctx, c, http.MethodGet, "/api/images/"+id(imageID)+"/comments", pageQuery(page, limit), nil)
+}
+
+// Comment comments on an image, or replies to a comment when parentID is
+// set.
+func (c *Client) Comment(ctx context.Context, imageID int64, body string, parentID *int64) (*models.Comment, error) {
+	in := map[string]interface{}{"body": body, "parent_id": parentID}
+	return call[models.Comment](ctx, c, http.MethodPost, "/api/images/"+id(imageID)+"/comments", nil, in)
+}
+
+// EditComment changes the text of one of the current user's comments.
+func (c *Client) EditComment(ctx context.Context, commentID int64, body string) (*models.Comment, error) {
+	return call[models.Comment](ctx, c, http.MethodPut, "/api/comments/"+id(commentID), nil, map[string]string{"body": body})
+}
+
+// DeleteComment deletes one of the current user's comments.
+func (c *Client) DeleteComment(ctx context.Context, commentID int64) error {
+	return c.do(ctx, http.MethodDelete, "/api/comments/"+id(commentID), nil, nil, nil)
+}
+
+// Categories lists every category.
+func (c *Client) Categories(ctx context.Context) ([]models.Category, error) {
+	var categories []models.Category
+	if err := c.do(ctx, http.MethodGet, "/api/categories", nil, nil, &categories); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// UserProfile returns a user's public profile.
+func (c *Client) UserProfile(ctx context.Context, username string) (*models.UserProfile, error) {
+	return call[models.UserProfile](ctx, c, http.MethodGet, "/api/users/"+url.PathEscape(username), nil, nil)
+}
+
+// UserImages returns a page of a user's approved images.
+func (c *Client) UserImages(ctx context.Context, username string, opts PageOptions) (*ImagePage, error) {
+	return call[ImagePage](ctx, c, http.MethodGet, "/api/users/"+url.PathEscape(username)+"/images", opts.query(), nil)
+}
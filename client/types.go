@@ -0,0 +1,298 @@
+package client
+
+import (
+	"time"
+
+	"hyw-webpics/models"
+)
+
+// Response bodies of the API. Entities are the models types; these are the
+// envelopes around them. The server's OpenAPI spec is built from the same
+// types, and the openapi tests check real responses against it.
+
+// Message is the body of requests that only confirm an action.
+type Message struct {
+	Message string `json:"message"`
+}
+
+// AdminSession is the result of the shared admin password login. AdminToken
+// must be sent as the X-Admin-Token header along with the admin_session
+// cookie.
+type AdminSession struct {
+	Message    string `json:"message"`
+	AdminToken string `json:"admin_token"`
+}
+
+// Session is the result of logging in or refreshing. When the account has
+// two-factor authentication, logging in returns only TwoFactorRequired and
+// a Challenge to pass to LoginTwoFactor.
+type Session struct {
+	Token             string       `json:"token,omitempty"`
+	RefreshToken      string       `json:"refresh_token,omitempty"`
+	ExpiresIn         int          `json:"expires_in,omitempty"`
+	User              *SessionUser `json:"user,omitempty"`
+	TwoFactorRequired bool         `json:"two_factor_required,omitempty"`
+	Challenge         string       `json:"challenge,omitempty"`
+}
+
+// SessionUser identifies the account a session or registration belongs to.
+type SessionUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// Registration is returned when an account is created.
+type Registration struct {
+	Message string      `json:"message"`
+	User    SessionUser `json:"user"`
+}
+
+// ImagePage is a page of an image listing. Total and Page are only set in
+// page mode; NextCursor is empty on the last page. Seed is set for random
+// order, to request the next page of the same shuffle.
+type ImagePage struct {
+	Images     []models.Image `json:"images"`
+	Limit      int            `json:"limit"`
+	Sort       string         `json:"sort"`
+	NextCursor string         `json:"next_cursor"`
+	Total      *int           `json:"total,omitempty"`
+	Page       *int           `json:"page,omitempty"`
+	Seed       *int64         `json:"seed,omitempty"`
+}
+
+// RandomImages is a batch of random images. Session continues the walk
+// without repeats.
+type RandomImages struct {
+	Images  []models.Image `json:"images"`
+	Session string         `json:"session"`
+}
+
+// SearchResult is an image matching a search, with the matching text
+// marked up as HTML.
+type SearchResult struct {
+	models.Image
+	Snippet string `json:"snippet"`
+}
+
+// SearchResults is a page of search results.
+type SearchResults struct {
+	Results []SearchResult `json:"results"`
+	Total   int            `json:"total"`
+	Page    int            `json:"page"`
+	Limit   int            `json:"limit"`
+}
+
+// TrendingImage is an image with its score in a trending window.
+type TrendingImage struct {
+	models.Image
+	HotScore float64 `json:"hot_score"`
+}
+
+// TrendingImages lists the hottest images of a window.
+type TrendingImages struct {
+	Window string          `json:"window"`
+	Images []TrendingImage `json:"images"`
+}
+
+// Quota is the uploader's trust level and what is left of each limit. A
+// nil limit is unlimited.
+type Quota struct {
+	TrustLevel             string `json:"trust_level"`
+	DailyUploadsRemaining  *int64 `json:"daily_uploads_remaining"`
+	WeeklyUploadsRemaining *int64 `json:"weekly_uploads_remaining"`
+	DailyBytesRemaining    *int64 `json:"daily_bytes_remaining"`
+	WeeklyBytesRemaining   *int64 `json:"weekly_bytes_remaining"`
+}
+
+// UploadedImage describes one file accepted by an upload.
+type UploadedImage struct {
+	ID       int64    `json:"id"`
+	Filename string   `json:"filename"`
+	Name     string   `json:"name"`
+	Title    string   `json:"title"`
+	Tags     []string `json:"tags"`
+	Animated bool     `json:"animated"`
+	Status   string   `json:"status"`
+}
+
+// UploadResult reports a batch upload. Files that were rejected are listed
+// in Errors.
+type UploadResult struct {
+	Message  string          `json:"message"`
+	Uploaded []UploadedImage `json:"uploaded"`
+	Errors   []string        `json:"errors"`
+	Quota    Quota           `json:"quota"`
+}
+
+// FavoriteState is an image's favorite status after adding or removing it.
+type FavoriteState struct {
+	ImageID       int64 `json:"image_id"`
+	Favorited     bool  `json:"favorited"`
+	FavoriteCount int64 `json:"favorite_count"`
+}
+
+// CommentPage is a page of comment threads, or of comments for moderation.
+type CommentPage struct {
+	Comments []models.Comment `json:"comments"`
+	Total    int              `json:"total"`
+	Page     int              `json:"page"`
+	Limit    int              `json:"limit"`
+}
+
+// CollectionPage is a page of collections.
+type CollectionPage struct {
+	Collections []models.Collection `json:"collections"`
+	Total       int                 `json:"total"`
+	Page        int                 `json:"page"`
+	Limit       int                 `json:"limit"`
+}
+
+// CollectionDetail is a collection with a page of its images.
+type CollectionDetail struct {
+	Collection models.Collection `json:"collection"`
+	Images     []models.Image    `json:"images"`
+	Total      int               `json:"total"`
+	Page       int               `json:"page"`
+	Limit      int               `json:"limit"`
+}
+
+// APIKeyList lists the current user's API keys.
+type APIKeyList struct {
+	Keys []models.APIKey `json:"keys"`
+}
+
+// NewAPIKey is a freshly created API key. Key is the secret, which is not
+// shown again.
+type NewAPIKey struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Key       string     `json:"key"`
+}
+
+// TwoFactorStatus describes the current user's two-factor authentication.
+type TwoFactorStatus struct {
+	Enabled                bool   `json:"enabled"`
+	Role                   string `json:"role"`
+	Required               bool   `json:"required"`
+	RecoveryCodesRemaining int    `json:"recovery_codes_remaining"`
+}
+
+// TwoFactorSetup is a new TOTP secret, to be confirmed with a code.
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// RecoveryCodes are single-use codes that replace a TOTP code.
+type RecoveryCodes struct {
+	Message       string   `json:"message,omitempty"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// AccountDeleted confirms an account deletion.
+type AccountDeleted struct {
+	Message       string `json:"message"`
+	RemovedImages int    `json:"removed_images"`
+}
+
+// PendingImages lists the images awaiting review.
+type PendingImages struct {
+	Images []models.Image `json:"images"`
+	Count  int            `json:"count"`
+}
+
+// BulkResult reports a bulk moderation action.
+type BulkResult struct {
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+}
+
+// ImageText is an image's corrected OCR text.
+type ImageText struct {
+	Message string `json:"message"`
+	OCRText string `json:"ocr_text"`
+}
+
+// AdminStats are the counters of the admin dashboard.
+type AdminStats struct {
+	TotalImages     int `json:"total_images"`
+	PendingImages   int `json:"pending_images"`
+	ApprovedImages  int `json:"approved_images"`
+	TotalCategories int `json:"total_categories"`
+	TotalComments   int `json:"total_comments"`
+	HiddenComments  int `json:"hidden_comments"`
+	ReviewImages    int `json:"review_images"`
+	OpenReports     int `json:"open_reports"`
+}
+
+// ModerationLog is a page of the moderation audit log.
+type ModerationLog struct {
+	Actions []models.ModerationAction `json:"actions"`
+	Total   int                       `json:"total"`
+	Page    int                       `json:"page"`
+	Limit   int                       `json:"limit"`
+}
+
+// ReportedImage is an image in the report queue with its open reports
+// counted by reason.
+type ReportedImage struct {
+	models.Image
+	ReportCount    int            `json:"report_count"`
+	Reasons        map[string]int `json:"reasons"`
+	LastReportedAt time.Time      `json:"last_reported_at"`
+}
+
+// ReportQueue is a page of reported images, most reported first.
+type ReportQueue struct {
+	Images []ReportedImage `json:"images"`
+	Total  int             `json:"total"`
+	Page   int             `json:"page"`
+	Limit  int             `json:"limit"`
+}
+
+// ImageReports lists the reports filed against an image.
+type ImageReports struct {
+	Reports []models.Report `json:"reports"`
+}
+
+// RoleChange confirms a user's new role.
+type RoleChange struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// Backup describes a backup archive.
+type Backup struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	ID       string    `json:"id"`
+	Base     string    `json:"base,omitempty"`
+	Created  time.Time `json:"created_at"`
+	Media    int       `json:"media"`
+	Included int       `json:"included"`
+}
+
+// BackupList lists the backup archives, oldest first.
+type BackupList struct {
+	Backups []Backup `json:"backups"`
+}
+
+// BackupCreated reports a new backup. Missing lists media files that were
+// referenced but not on disk.
+type BackupCreated struct {
+	Name     string   `json:"name"`
+	ID       string   `json:"id"`
+	Base     string   `json:"base"`
+	Media    int      `json:"media"`
+	Included int      `json:"included"`
+	Missing  []string `json:"missing"`
+}
+
+// Health is the body of the health and readiness probes.
+type Health struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"hyw-webpics/config"
+	"hyw-webpics/handlers"
+	"hyw-webpics/openapi"
+	"hyw-webpics/server"
+	"hyw-webpics/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const usage = `usage: server [flags] [command]
+
+commands:
+  serve                                run the HTTP server (default)
+  migrate                              bring the database schema up to date
+  config print                         show the effective configuration
+  user create [-role r] [-password p] <name>
+  user list
+  user set-role <name> <role>
+  user reset-password [-password p] <name>
+  category export [-o file]
+  category import <file|->
+  images reprocess [-id n] [-ocr] [-force]
+  ocr [-force]                         re-run text extraction on all images
+  gc [-dry-run] [-grace d]             remove orphaned files and expired rows
+  backup [-o file] [-incremental]      archive the database and media
+  restore <archive|db file>            verify and restore a backup
+  openapi print                        write the API's OpenAPI document
+  openapi check                        fail if routes and the document differ
+
+Commands use the same configuration and database as the server and are safe
+to run while it is up.`
+
+// runCommand runs a subcommand and returns the exit code.
+func runCommand(name string, args []string) int {
+	switch name {
+	case "serve":
+		return serve(args)
+	case "migrate":
+		return runMigrate(args)
+	case "user":
+		return runUser(args)
+	case "category":
+		return runCategory(args)
+	case "images":
+		return runImages(args)
+	case "ocr":
+		return runOCR(args)
+	case "gc":
+		return runGC(args)
+	case "backup":
+		return runBackup(args)
+	case "restore":
+		return runRestore(args)
+	case "openapi":
+		return runOpenAPI(args)
+	case "help":
+		fmt.Println(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s\n", name, usage)
+		return 2
+	}
+}
+
+// runMigrate exists for deploy scripts that migrate before starting the
+// server. Connecting to the database already applies pending migrations.
+func runMigrate(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: server [flags] migrate")
+		return 2
+	}
+	fmt.Println("Database schema is up to date")
+	return 0
+}
+
+func runOCR(args []string) int {
+	fs := flag.NewFlagSet("ocr", flag.ContinueOnError)
+	force := fs.Bool("force", false, "also overwrite text corrected by moderators")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if !utils.OCREnabled() {
+		fmt.Fprintln(os.Stderr, "OCR is not available: install tesseract with the configured languages")
+		return 1
+	}
+
+	processed, failed := handlers.RerunOCR(*force)
+	fmt.Printf("OCR complete: %d processed, %d failed\n", processed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runConfig shows the effective configuration. It also reports validation
+// problems, so it can be used to check a config file before deploying.
+func runConfig(args []string) int {
+	if len(args) != 1 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "usage: server [flags] config print")
+		return 2
+	}
+
+	config.AppConfig.Print(os.Stdout)
+	if err := config.AppConfig.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "\ninvalid configuration:\n%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runOpenAPI prints the OpenAPI document, or checks it against the routes
+// the server registers. CI runs the check, so a route added without a spec
+// entry (or the other way round) fails the build.
+func runOpenAPI(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: server [flags] openapi print|check")
+		return 2
+	}
+
+	switch args[0] {
+	case "print":
+		os.Stdout.Write(openapi.JSON())
+		fmt.Println()
+		return 0
+	case "check":
+		var routes []string
+		app, metricsApp := server.New()
+		for _, a := range []*fiber.App{app, metricsApp} {
+			if a == nil {
+				continue
+			}
+			for _, r := range a.GetRoutes(true) {
+				routes = append(routes, r.Method+" "+r.Path)
+			}
+		}
+		problems := openapi.Check(routes)
+		for _, p := range problems {
+			fmt.Fprintln(os.Stderr, p)
+		}
+		if len(problems) > 0 {
+			return 1
+		}
+		fmt.Printf("OpenAPI document covers all %d operations\n", len(openapi.Operations))
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown openapi command %q\n", args[0])
+		return 2
+	}
+}
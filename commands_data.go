@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"hyw-webpics/backup"
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+	"hyw-webpics/handlers"
+	"hyw-webpics/utils"
+)
+
+func runCategory(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: server [flags] category export|import ...")
+		return 2
+	}
+
+	switch args[0] {
+	case "export":
+		return runCategoryExport(args[1:])
+	case "import":
+		return runCategoryImport(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown category command %q\n", args[0])
+		return 2
+	}
+}
+
+func runCategoryExport(args []string) int {
+	fs := flag.NewFlagSet("category export", flag.ContinueOnError)
+	output := fs.String("o", "", "write to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	categories, err := handlers.ExportCategories()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to export categories:", err)
+		return 1
+	}
+	data, _ := json.MarshalIndent(categories, "", "  ")
+	data = append(data, '\n')
+
+	if *output == "" {
+		os.Stdout.Write(data)
+		return 0
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to export categories:", err)
+		return 1
+	}
+	fmt.Printf("Exported %d categories to %s\n", len(categories), *output)
+	return 0
+}
+
+func runCategoryImport(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: server [flags] category import <file|->")
+		return 2
+	}
+
+	var data []byte
+	var err error
+	if args[0] == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read categories:", err)
+		return 1
+	}
+
+	var categories []handlers.CreateCategoryRequest
+	if err := json.Unmarshal(data, &categories); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid category file:", err)
+		return 1
+	}
+	created, updated, err := handlers.ImportCategories(categories)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to import categories:", err)
+		return 1
+	}
+	fmt.Printf("Imported categories: %d created, %d updated\n", created, updated)
+	return 0
+}
+
+func runImages(args []string) int {
+	if len(args) == 0 || args[0] != "reprocess" {
+		fmt.Fprintln(os.Stderr, "usage: server [flags] images reprocess [-id n] [-ocr] [-force]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("images reprocess", flag.ContinueOnError)
+	id := fs.Int64("id", 0, "only reprocess this image")
+	ocr := fs.Bool("ocr", false, "also re-run text extraction")
+	force := fs.Bool("force", false, "with -ocr, also overwrite text corrected by moderators")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *ocr && !utils.OCREnabled() {
+		fmt.Fprintln(os.Stderr, "OCR is not available: install tesseract with the configured languages")
+		return 1
+	}
+
+	result, err := handlers.ReprocessImages(*id, *ocr, *force)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to reprocess images:", err)
+		return 1
+	}
+	for _, name := range result.Missing {
+		fmt.Fprintf(os.Stderr, "missing file: %s\n", name)
+	}
+	fmt.Printf("Reprocessed %d images: %d missing, %d failed\n", result.Processed, len(result.Missing), result.Failed)
+	if result.Failed > 0 || len(result.Missing) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func runGC(args []string) int {
+	fs := flag.NewFlagSet("gc", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only report what would be removed")
+	grace := fs.Duration("grace", time.Hour, "keep unreferenced files younger than this, as uploads may still be in flight")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	result, err := handlers.CollectGarbage(*grace, *dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Garbage collection failed:", err)
+		return 1
+	}
+
+	verb := "Removed"
+	if *dryRun {
+		verb = "Would remove"
+		for _, name := range result.OrphanFiles {
+			fmt.Println("orphan:", name)
+		}
+	}
+	fmt.Printf("%s %d orphaned files (%d bytes), %d cached variants, %d expired sessions\n",
+		verb, len(result.OrphanFiles), result.OrphanBytes, result.Variants, result.ExpiredTokens)
+	return 0
+}
+
+func runBackup(args []string) int {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	output := fs.String("o", "", "archive to write (default: a new file in storage.backup_dir)")
+	incremental := fs.Bool("incremental", false, "leave out media the newest archive in storage.backup_dir already holds")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "usage: server [flags] backup [-o file] [-incremental]")
+		return 2
+	}
+
+	var base *backup.Manifest
+	var err error
+	if *incremental {
+		base, err = backup.Latest(config.AppConfig.BackupDir)
+	}
+	var m *backup.Manifest
+	if err == nil {
+		m, err = backup.Create(*output, base)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Backup failed:", err)
+		return 1
+	}
+	if *output == "" {
+		*output = filepath.Join(config.AppConfig.BackupDir, backup.FileName(m.ID))
+	}
+
+	for _, name := range m.Missing {
+		fmt.Fprintf(os.Stderr, "missing file: %s\n", name)
+	}
+	fmt.Printf("Wrote backup %s to %s: %d media files, %d stored in this archive\n", m.ID, *output, len(m.Media), m.Included())
+	return 0
+}
+
+func runRestore(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: server [flags] restore <archive|database file>")
+		return 2
+	}
+
+	// A plain database snapshot restores the database alone
+	header := make([]byte, 16)
+	if f, err := os.Open(args[0]); err == nil {
+		io.ReadFull(f, header)
+		f.Close()
+	}
+	if string(header) == "SQLite format 3\x00" {
+		if err := database.Restore(args[0]); err != nil {
+			fmt.Fprintln(os.Stderr, "Restore failed:", err)
+			return 1
+		}
+		fmt.Println("Restored database from", args[0])
+		return 0
+	}
+
+	m, err := backup.Restore(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Restore failed:", err)
+		return 1
+	}
+	fmt.Printf("Restored backup %s (%s): database and %d media files\n", m.ID, m.CreatedAt.Format(time.RFC3339), len(m.Media))
+	return 0
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"hyw-webpics/handlers"
+)
+
+// cliModerator is recorded in the moderation log for changes made from the
+// command line.
+const cliModerator = "cli"
+
+func runUser(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: server [flags] user create|list|set-role|reset-password ...")
+		return 2
+	}
+
+	switch args[0] {
+	case "create":
+		return runUserCreate(args[1:])
+	case "list":
+		return runUserList(args[1:])
+	case "set-role":
+		return runUserSetRole(args[1:])
+	case "reset-password":
+		return runUserResetPassword(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown user command %q\n", args[0])
+		return 2
+	}
+}
+
+func runUserCreate(args []string) int {
+	fs := flag.NewFlagSet("user create", flag.ContinueOnError)
+	role := fs.String("role", "user", "user, moderator or admin")
+	password := fs.String("password", "", "password (read from stdin when empty)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: server [flags] user create [-role r] [-password p] <name>")
+		return 2
+	}
+
+	if *password == "" {
+		*password = readPassword()
+	}
+	id, err := handlers.CreateUser(fs.Arg(0), *password, *role)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to create user:", err)
+		return 1
+	}
+	fmt.Printf("Created %s %q (id %d)\n", *role, fs.Arg(0), id)
+	return 0
+}
+
+func runUserList(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: server [flags] user list")
+		return 2
+	}
+
+	users, err := handlers.ListUsers()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to list users:", err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSERNAME\tROLE\t2FA\tIMAGES\tCREATED")
+	for _, u := range users {
+		twoFactor := "no"
+		if u.TwoFactor {
+			twoFactor = "yes"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\n", u.ID, u.Username, u.Role, twoFactor, u.Images, u.CreatedAt)
+	}
+	w.Flush()
+	return 0
+}
+
+func runUserSetRole(args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: server [flags] user set-role <name> <role>")
+		return 2
+	}
+
+	previous, err := handlers.ChangeRole(args[0], args[1], cliModerator)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to set role:", err)
+		return 1
+	}
+	fmt.Printf("%s: %s -> %s\n", args[0], previous, args[1])
+	return 0
+}
+
+func runUserResetPassword(args []string) int {
+	fs := flag.NewFlagSet("user reset-password", flag.ContinueOnError)
+	password := fs.String("password", "", "new password (read from stdin when empty)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: server [flags] user reset-password [-password p] <name>")
+		return 2
+	}
+
+	if *password == "" {
+		*password = readPassword()
+	}
+	if err := handlers.ResetPassword(fs.Arg(0), *password); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to reset password:", err)
+		return 1
+	}
+	fmt.Printf("Password of %q reset; all of their sessions were signed out\n", fs.Arg(0))
+	return 0
+}
+
+// readPassword reads one line from stdin, so passwords can be piped in
+// instead of showing up in the process list and shell history.
+func readPassword() string {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	fmt.Fprintln(os.Stderr)
+	return strings.TrimRight(line, "\r\n")
+}
@@ -1,32 +1,251 @@
 package config
 
 import (
+	"encoding/base32"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+
+	"hyw-webpics/logging"
 )
 
+// Config holds every tunable. Each field is described by its tags:
+//
+//	key      name in the config file, as section.name, and the flag -section.name
+//	env      environment variable
+//	default  value used when nothing else sets it
+//	secret   redacted by `config print`
+//
+// Sources apply in order of precedence: flags, then environment variables,
+// then the config file, then defaults.
 type Config struct {
-	AdminPassword string
-	JWTSecret     string
-	DatabasePath  string
-	UploadDir     string
-	Port          string
+	Mode         string   `key:"server.mode" env:"APP_ENV" default:"development" help:"development or production; production refuses insecure defaults"`
+	Port         string   `key:"server.port" env:"PORT" default:"3000" help:"HTTP port"`
+	BodyLimitMB  int      `key:"server.body_limit_mb" env:"BODY_LIMIT_MB" default:"50" help:"largest request body, in MB"`
+	CORSOrigins  []string `key:"server.cors_origins" env:"CORS_ORIGINS" default:"*" help:"allowed CORS origins, comma separated"`
+	FrontendDir  string   `key:"server.frontend_dir" env:"FRONTEND_DIR" help:"serve the frontend from this directory (e.g. web/dist) instead of the copy built into the binary, for development"`
+	ShutdownSecs int      `key:"server.shutdown_timeout_seconds" env:"SHUTDOWN_TIMEOUT_SECONDS" default:"30" help:"how long a shutdown waits for requests and background jobs to finish"`
+
+	DatabasePath string `key:"storage.database_path" env:"DATABASE_PATH" default:"./memes.db" help:"SQLite database file"`
+	UploadDir    string `key:"storage.upload_dir" env:"UPLOAD_DIR" default:"./uploads" help:"directory for uploaded images"`
+	BackupDir    string `key:"storage.backup_dir" env:"BACKUP_DIR" default:"./backups" help:"directory for backup archives"`
+
+	AdminPassword    string `key:"auth.admin_password" env:"ADMIN_PASSWORD" default:"admin123" secret:"true" help:"shared admin password"`
+	AdminTOTPSecret  string `key:"auth.admin_totp_secret" env:"ADMIN_TOTP_SECRET" secret:"true" help:"base32 TOTP secret, a second factor for the shared admin password"`
+	Require2FA       bool   `key:"auth.require_privileged_2fa" env:"REQUIRE_PRIVILEGED_2FA" default:"false" help:"privileged roles must have two-factor authentication"`
+	JWTSecret        string `key:"auth.jwt_secret" env:"JWT_SECRET" default:"your-secret-key-change-in-production" secret:"true" help:"HMAC key for tokens and signed cookies"`
+	AccessTokenMins  int    `key:"auth.access_token_minutes" env:"ACCESS_TOKEN_MINUTES" default:"15" help:"lifetime of access tokens"`
+	RefreshTokenDays int    `key:"auth.refresh_token_days" env:"REFRESH_TOKEN_DAYS" default:"30" help:"lifetime of refresh tokens"`
+
+	WebPQuality     int    `key:"images.webp_quality" env:"WEBP_QUALITY" default:"75" help:"cwebp quality, 0-100"`
+	OCRLanguages    string `key:"images.ocr_languages" env:"OCR_LANGUAGES" default:"chi_sim+eng" help:"tesseract languages"`
+	DefaultPageSize int    `key:"images.default_page_size" env:"DEFAULT_PAGE_SIZE" default:"20" help:"page size when a listing does not ask for one"`
+	MaxPageSize     int    `key:"images.max_page_size" env:"MAX_PAGE_SIZE" default:"100" help:"largest page size a listing may ask for"`
+
+	RateLimitStore     string `key:"rate_limits.store" env:"RATE_LIMIT_STORE" default:"memory" help:"memory, or sqlite to share limits between processes"`
+	RandomRateLimit    int    `key:"rate_limits.random" env:"RANDOM_RATE_LIMIT" default:"60" help:"random image requests per IP per minute"`
+	CommentRateLimit   int    `key:"rate_limits.comment" env:"COMMENT_RATE_LIMIT" default:"5" help:"comments per user per minute"`
+	ReportRateLimit    int    `key:"rate_limits.report" env:"REPORT_RATE_LIMIT" default:"10" help:"reports per user or IP per hour"`
+	LoginRateLimit     int    `key:"rate_limits.login" env:"LOGIN_RATE_LIMIT" default:"10" help:"login attempts per IP per minute"`
+	RegisterRateLimit  int    `key:"rate_limits.register" env:"REGISTER_RATE_LIMIT" default:"5" help:"registrations per IP per hour"`
+	UploadRateLimit    int    `key:"rate_limits.upload" env:"UPLOAD_RATE_LIMIT" default:"30" help:"upload requests per user per hour"`
+	TwoFactorRateLimit int    `key:"rate_limits.two_factor" env:"TWO_FACTOR_RATE_LIMIT" default:"10" help:"second-factor attempts per IP per 5 minutes"`
+	LockoutThreshold   int    `key:"rate_limits.lockout_threshold" env:"LOGIN_LOCKOUT_THRESHOLD" default:"5" help:"failed logins per account before it is locked out"`
+	LockoutMins        int    `key:"rate_limits.lockout_minutes" env:"LOGIN_LOCKOUT_MINUTES" default:"1" help:"first lockout, doubling with each further failure"`
+	LockoutMaxMins     int    `key:"rate_limits.lockout_max_minutes" env:"LOGIN_LOCKOUT_MAX_MINUTES" default:"60" help:"longest lockout"`
+
+	QuotaNew           UploadQuota `key:"quotas.new" env:"UPLOAD_QUOTA_NEW" default:"5/day,20/week,25MB/day,100MB/week" help:"upload quota for new accounts"`
+	QuotaMember        UploadQuota `key:"quotas.member" env:"UPLOAD_QUOTA_MEMBER" default:"30/day,100/week,200MB/day,500MB/week" help:"upload quota for members"`
+	QuotaTrusted       UploadQuota `key:"quotas.trusted" env:"UPLOAD_QUOTA_TRUSTED" default:"200/day,1000/week,1GB/day,4GB/week" help:"upload quota for trusted uploaders"`
+	TrustMemberAt      int         `key:"quotas.trust_member_approved" env:"TRUST_MEMBER_APPROVED" default:"3" help:"approved uploads to become a member"`
+	TrustTrustedAt     int         `key:"quotas.trust_trusted_approved" env:"TRUST_TRUSTED_APPROVED" default:"20" help:"approved uploads to become trusted"`
+	TrustMinApproval   int         `key:"quotas.trust_min_approval_percent" env:"TRUST_MIN_APPROVAL_PERCENT" default:"90" help:"percentage of uploads that must have been approved to be trusted"`
+	AutoApproveTrusted bool        `key:"quotas.auto_approve_trusted" env:"AUTO_APPROVE_TRUSTED" default:"false" help:"publish trusted uploads that name a category without review"`
+
+	ReportThreshold int `key:"moderation.report_threshold" env:"REPORT_THRESHOLD" default:"3" help:"open reports from signed-in users that send an image back to review"`
+	StatsFlushSecs  int `key:"stats.flush_seconds" env:"STATS_FLUSH_SECONDS" default:"30" help:"how often buffered view/share counts are written"`
+
+	MetricsListen string `key:"metrics.listen" env:"METRICS_LISTEN" help:"serve /metrics on this address only (e.g. 127.0.0.1:9100) instead of the main port"`
+	MetricsToken  string `key:"metrics.token" env:"METRICS_TOKEN" secret:"true" help:"bearer token required to scrape /metrics"`
+
+	LogFormat string `key:"log.format" env:"LOG_FORMAT" default:"json" help:"json or text"`
+	LogLevel  string `key:"log.level" env:"LOG_LEVEL" default:"info" help:"debug, info, warn or error"`
+	LogLevels string `key:"log.levels" env:"LOG_LEVELS" help:"per-subsystem levels, e.g. http=warn,db=debug"`
+
+	// sources records where each key's value came from, for `config print`
+	sources map[string]string
+	file    string
 }
 
 var AppConfig *Config
 
-func Load() {
-	AppConfig = &Config{
-		AdminPassword: getEnv("ADMIN_PASSWORD", "admin123"),
-		JWTSecret:     getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
-		DatabasePath:  getEnv("DATABASE_PATH", "./memes.db"),
-		UploadDir:     getEnv("UPLOAD_DIR", "./uploads"),
-		Port:          getEnv("PORT", "3000"),
+var configLog = logging.For("config")
+
+// Load builds AppConfig from defaults, the config file, the environment and
+// the leading flags of args, and returns the remaining arguments. The config
+// file is named by -config or CONFIG_FILE; a .toml extension selects TOML,
+// anything else YAML.
+func Load(args []string) ([]string, error) {
+	cfg := &Config{sources: make(map[string]string)}
+	fields := configFields(cfg)
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "config file (YAML or TOML)")
+	flagValues := make(map[string]*flagValue)
+	for _, f := range fields {
+		v := &flagValue{isBool: f.value.Kind() == boolKind}
+		flagValues[f.key] = v
+		usage := f.help
+		if f.def != "" {
+			usage += fmt.Sprintf(" (default %q, env %s)", f.def, f.env)
+		} else {
+			usage += fmt.Sprintf(" (env %s)", f.env)
+		}
+		fs.Var(v, f.key, usage)
+	}
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: server [-config file] [-section.key value ...] [command]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	var fileValues map[string]string
+	if *configFile != "" {
+		data, err := os.ReadFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(*configFile, ".toml") {
+			fileValues, err = parseTOML(string(data))
+		} else {
+			fileValues, err = parseYAML(string(data))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", *configFile, err)
+		}
+		cfg.file = *configFile
+	}
+
+	known := make(map[string]bool)
+	var errs []error
+	for _, f := range fields {
+		known[f.key] = true
+
+		raw, source := f.def, "default"
+		if v, ok := fileValues[f.key]; ok {
+			raw, source = v, "file"
+		}
+		if v, ok := os.LookupEnv(f.env); ok && v != "" {
+			raw, source = v, "env "+f.env
+		}
+		if v := flagValues[f.key]; v.set {
+			raw, source = v.raw, "flag"
+		}
+
+		if err := f.set(raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): %w", f.key, source, err))
+		}
+		cfg.sources[f.key] = source
+	}
+	for key := range fileValues {
+		if !known[key] {
+			errs = append(errs, fmt.Errorf("%s: unknown key %q", *configFile, key))
+		}
 	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	AppConfig = cfg
+	return fs.Args(), nil
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// Production reports whether the server runs in production mode.
+func (c *Config) Production() bool {
+	return c.Mode == "production"
+}
+
+// placeholder is the value config.example.yaml gives secrets; production
+// mode refuses it like the built-in defaults.
+const placeholder = "change-me"
+
+// Validate checks that the configuration is usable. Insecure defaults are
+// errors in production mode and are logged as warnings otherwise.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Mode == "development" || c.Mode == "production", "server.mode must be development or production")
+	port, err := strconv.Atoi(c.Port)
+	check(err == nil && port > 0 && port < 65536, "server.port must be a port number")
+	check(c.BodyLimitMB > 0, "server.body_limit_mb must be positive")
+	check(len(c.CORSOrigins) > 0, "server.cors_origins must not be empty")
+	check(c.DatabasePath != "", "storage.database_path must be set")
+	check(c.UploadDir != "", "storage.upload_dir must be set")
+	check(c.AccessTokenMins > 0, "auth.access_token_minutes must be positive")
+	check(c.RefreshTokenDays > 0, "auth.refresh_token_days must be positive")
+	if c.AdminTOTPSecret != "" {
+		_, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(strings.TrimRight(c.AdminTOTPSecret, "=")))
+		check(err == nil, "auth.admin_totp_secret must be base32")
+	}
+	check(c.WebPQuality >= 0 && c.WebPQuality <= 100, "images.webp_quality must be between 0 and 100")
+	check(c.DefaultPageSize > 0, "images.default_page_size must be positive")
+	check(c.MaxPageSize >= c.DefaultPageSize, "images.max_page_size must be at least images.default_page_size")
+	check(c.RateLimitStore == "memory" || c.RateLimitStore == "sqlite", "rate_limits.store must be memory or sqlite")
+	for key, limit := range map[string]int{
+		"rate_limits.random": c.RandomRateLimit, "rate_limits.comment": c.CommentRateLimit,
+		"rate_limits.report": c.ReportRateLimit, "rate_limits.login": c.LoginRateLimit,
+		"rate_limits.register": c.RegisterRateLimit, "rate_limits.upload": c.UploadRateLimit,
+		"rate_limits.two_factor":        c.TwoFactorRateLimit,
+		"rate_limits.lockout_threshold": c.LockoutThreshold, "rate_limits.lockout_minutes": c.LockoutMins,
+		"stats.flush_seconds": c.StatsFlushSecs, "moderation.report_threshold": c.ReportThreshold,
+		"server.shutdown_timeout_seconds": c.ShutdownSecs,
+	} {
+		check(limit > 0, "%s must be positive", key)
+	}
+	check(c.LockoutMaxMins >= c.LockoutMins, "rate_limits.lockout_max_minutes must be at least rate_limits.lockout_minutes")
+	check(c.TrustMemberAt >= 0 && c.TrustTrustedAt >= c.TrustMemberAt, "quotas.trust_trusted_approved must be at least quotas.trust_member_approved")
+	check(c.LogFormat == "json" || c.LogFormat == "text", "log.format must be json or text")
+	_, err = logging.ParseLevel(c.LogLevel)
+	check(err == nil, "log.level must be debug, info, warn or error")
+	_, err = logging.ParseLevels(c.LogLevels)
+	check(err == nil, "log.levels: %v", err)
+	check(c.TrustMinApproval >= 0 && c.TrustMinApproval <= 100, "quotas.trust_min_approval_percent must be between 0 and 100")
+
+	var insecure []string
+	switch c.AdminPassword {
+	case "":
+		insecure = append(insecure, "auth.admin_password is empty")
+	case defaultOf("AdminPassword"), placeholder:
+		insecure = append(insecure, "auth.admin_password is a placeholder")
+	}
+	if c.JWTSecret == defaultOf("JWTSecret") || c.JWTSecret == placeholder {
+		insecure = append(insecure, "auth.jwt_secret is a placeholder")
+	} else if len(c.JWTSecret) < 32 {
+		insecure = append(insecure, "auth.jwt_secret is shorter than 32 characters")
 	}
-	return defaultValue
+	if len(c.CORSOrigins) == 1 && c.CORSOrigins[0] == "*" && c.Production() {
+		configLog.Warn("server.cors_origins allows any origin")
+	}
+	if c.MetricsListen == "" && c.MetricsToken == "" && c.Production() {
+		configLog.Warn("/metrics is public, set metrics.token or metrics.listen")
+	}
+	for _, problem := range insecure {
+		if c.Production() {
+			errs = append(errs, errors.New(problem+", refusing to start in production mode"))
+		} else {
+			configLog.Warn(problem + ", set it before deploying")
+		}
+	}
+
+	return errors.Join(errs...)
 }
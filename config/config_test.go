@@ -0,0 +1,128 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+server:
+  port: "4000"
+  body_limit_mb: 10
+images:
+  webp_quality: 80
+  default_page_size: 30
+`)
+	t.Setenv("CONFIG_FILE", file)
+	t.Setenv("PORT", "5000")
+	t.Setenv("WEBP_QUALITY", "90")
+	t.Setenv("DEFAULT_PAGE_SIZE", "") // empty variables do not override
+	t.Setenv("COMMENT_RATE_LIMIT", "")
+
+	rest, err := Load([]string{"-server.port", "6000", "migrate", "-x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rest, []string{"migrate", "-x"}) {
+		t.Errorf("remaining args = %q, want the command and its flags", rest)
+	}
+
+	tests := []struct {
+		key    string
+		got    interface{}
+		want   interface{}
+		source string
+	}{
+		{"server.port", AppConfig.Port, "6000", "flag"},
+		{"images.webp_quality", AppConfig.WebPQuality, 90, "env WEBP_QUALITY"},
+		{"server.body_limit_mb", AppConfig.BodyLimitMB, 10, "file"},
+		{"images.default_page_size", AppConfig.DefaultPageSize, 30, "file"},
+		{"rate_limits.comment", AppConfig.CommentRateLimit, 5, "default"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.key, tt.got, tt.want)
+		}
+		if got := AppConfig.sources[tt.key]; got != tt.source {
+			t.Errorf("%s came from %q, want %q", tt.key, got, tt.source)
+		}
+	}
+}
+
+func TestLoadConfigFlagAndTOML(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeFile(t, "ignored.yaml", "server:\n  port: \"4000\"\n"))
+	t.Setenv("PORT", "")
+	file := writeFile(t, "config.toml", "[server]\nport = \"7000\"\ncors_origins = [\"https://a.example\", \"https://b.example\"]\n")
+
+	if _, err := Load([]string{"-config", file}); err != nil {
+		t.Fatal(err)
+	}
+	if AppConfig.Port != "7000" {
+		t.Errorf("port = %q, want the -config file's 7000", AppConfig.Port)
+	}
+	if want := []string{"https://a.example", "https://b.example"}; !reflect.DeepEqual(AppConfig.CORSOrigins, want) {
+		t.Errorf("cors_origins = %q, want %q", AppConfig.CORSOrigins, want)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+	}{
+		{"unknown key", "server:\n  prot: 3000\n", nil},
+		{"bad value in file", "images:\n  webp_quality: high\n", nil},
+		{"bad value in env", "", map[string]string{"WEBP_QUALITY": "high"}},
+		{"syntax error", "server:\n  port 3000\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", writeFile(t, "config.yaml", tt.file))
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			if _, err := Load(nil); err == nil {
+				t.Error("Load succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestValidateRefusesPlaceholdersInProduction(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("APP_ENV", "production")
+	if _, err := Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	secret := "0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		password, jwtSecret string
+		ok                  bool
+	}{
+		{"admin123", secret, false},
+		{"change-me", secret, false},
+		{"", secret, false},
+		{"a-real-password", "change-me", false},
+		{"a-real-password", "too-short", false},
+		{"a-real-password", secret, true},
+	}
+	for _, tt := range tests {
+		AppConfig.AdminPassword, AppConfig.JWTSecret = tt.password, tt.jwtSecret
+		if err := AppConfig.Validate(); (err == nil) != tt.ok {
+			t.Errorf("admin_password %q, jwt_secret %q: Validate() = %v, want ok %v", tt.password, tt.jwtSecret, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const boolKind = reflect.Bool
+
+var quotaType = reflect.TypeOf(UploadQuota{})
+
+// field is one tunable of Config, described by its struct tags.
+type field struct {
+	name   string
+	key    string
+	env    string
+	def    string
+	help   string
+	secret bool
+	value  reflect.Value
+}
+
+// configFields lists the fields of cfg in declaration order.
+func configFields(cfg *Config) []field {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key, ok := sf.Tag.Lookup("key")
+		if !ok {
+			continue
+		}
+		fields = append(fields, field{
+			name:   sf.Name,
+			key:    key,
+			env:    sf.Tag.Get("env"),
+			def:    sf.Tag.Get("default"),
+			help:   sf.Tag.Get("help"),
+			secret: sf.Tag.Get("secret") == "true",
+			value:  v.Field(i),
+		})
+	}
+	return fields
+}
+
+// defaultOf returns the default of the named field, as written in its tag.
+func defaultOf(name string) string {
+	sf, _ := reflect.TypeOf(Config{}).FieldByName(name)
+	return sf.Tag.Get("default")
+}
+
+// set parses raw into the field.
+func (f field) set(raw string) error {
+	switch {
+	case f.value.Type() == quotaType:
+		q, err := ParseUploadQuota(raw)
+		if err != nil {
+			return err
+		}
+		f.value.Set(reflect.ValueOf(q))
+	case f.value.Kind() == reflect.String:
+		f.value.SetString(raw)
+	case f.value.Kind() == reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		f.value.SetInt(int64(n))
+	case f.value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", raw)
+		}
+		f.value.SetBool(b)
+	case f.value.Kind() == reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", f.value.Type())
+	}
+	return nil
+}
+
+// format renders the field's value in config file syntax.
+func (f field) format() string {
+	switch v := f.value.Interface().(type) {
+	case string:
+		return strconv.Quote(v)
+	case []string:
+		quoted := make([]string, len(v))
+		for i, s := range v {
+			quoted[i] = strconv.Quote(s)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	case UploadQuota:
+		return strconv.Quote(v.String())
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// flagValue collects a flag's raw value; it is parsed along with the other
+// sources once the config file has been read.
+type flagValue struct {
+	raw    string
+	set    bool
+	isBool bool
+}
+
+func (v *flagValue) String() string     { return v.raw }
+func (v *flagValue) IsBoolFlag() bool   { return v.isBool }
+func (v *flagValue) Set(s string) error { v.raw, v.set = s, true; return nil }
+
+// Print writes the effective configuration as YAML, noting where each value
+// came from. Secrets are redacted.
+func (c *Config) Print(w io.Writer) {
+	if c.file != "" {
+		fmt.Fprintf(w, "# config file: %s\n", c.file)
+	}
+	section := ""
+	for _, f := range configFields(c) {
+		sec, name, _ := strings.Cut(f.key, ".")
+		if sec != section {
+			if section != "" {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "%s:\n", sec)
+			section = sec
+		}
+
+		value := f.format()
+		if f.secret && !f.value.IsZero() {
+			value = `"<redacted>"`
+		}
+		fmt.Fprintf(w, "  %s: %s  # %s\n", name, value, c.sources[f.key])
+	}
+}
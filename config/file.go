@@ -0,0 +1,204 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The config file parsers cover the subset of YAML and TOML a flat settings
+// file needs: one level of sections, scalar values, lists of scalars and
+// comments. Both return values keyed by "section.name", with lists joined by
+// commas.
+
+// parseYAML reads sections of "name: value" pairs:
+//
+//	server:
+//	  port: 3000
+//	  cors_origins: ["https://a.example", "https://b.example"]
+//	storage:
+//	  upload_dir: /data/uploads
+//
+// A list may also be written as "- item" lines under an empty value.
+func parseYAML(data string) (map[string]string, error) {
+	values := make(map[string]string)
+	section := ""
+	listKey := ""
+
+	for n, line := range strings.Split(data, "\n") {
+		lineNo := n + 1
+		line = strings.TrimRight(stripComment(line), " \r")
+		if strings.TrimSpace(line) == "" || strings.TrimSpace(line) == "---" {
+			continue
+		}
+		if strings.Contains(line, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", lineNo)
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		content := strings.TrimSpace(line)
+
+		if strings.HasPrefix(content, "- ") || content == "-" {
+			if listKey == "" || indent == 0 {
+				return nil, fmt.Errorf("line %d: list item outside a list", lineNo)
+			}
+			item, err := scalar(strings.TrimSpace(strings.TrimPrefix(content, "-")))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			if values[listKey] != "" {
+				values[listKey] += ","
+			}
+			values[listKey] += item
+			continue
+		}
+		listKey = ""
+
+		name, value, ok := strings.Cut(content, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"name: value\"", lineNo)
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+
+		if indent == 0 {
+			if value != "" {
+				return nil, fmt.Errorf("line %d: top-level keys are sections, put %q under one", lineNo, name)
+			}
+			section = name
+			continue
+		}
+		if section == "" {
+			return nil, fmt.Errorf("line %d: indented key outside a section", lineNo)
+		}
+
+		key := section + "." + name
+		if _, dup := values[key]; dup {
+			return nil, fmt.Errorf("line %d: %s is set twice", lineNo, key)
+		}
+		if value == "" {
+			// Either an empty value or the start of a block list
+			values[key] = ""
+			listKey = key
+			continue
+		}
+		parsed, err := scalar(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		values[key] = parsed
+	}
+	return values, nil
+}
+
+// parseTOML reads "[section]" tables of "name = value" pairs.
+func parseTOML(data string) (map[string]string, error) {
+	values := make(map[string]string)
+	section := ""
+
+	for n, line := range strings.Split(data, "\n") {
+		lineNo := n + 1
+		content := strings.TrimSpace(stripComment(line))
+		if content == "" {
+			continue
+		}
+
+		if strings.HasPrefix(content, "[") && strings.HasSuffix(content, "]") {
+			section = strings.TrimSpace(content[1 : len(content)-1])
+			if section == "" || strings.Contains(section, ".") {
+				return nil, fmt.Errorf("line %d: invalid table name", lineNo)
+			}
+			continue
+		}
+
+		name, value, ok := strings.Cut(content, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"name = value\"", lineNo)
+		}
+		if section == "" {
+			return nil, fmt.Errorf("line %d: key outside a [section]", lineNo)
+		}
+
+		key := section + "." + strings.TrimSpace(name)
+		if _, dup := values[key]; dup {
+			return nil, fmt.Errorf("line %d: %s is set twice", lineNo, key)
+		}
+		parsed, err := scalar(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		values[key] = parsed
+	}
+	return values, nil
+}
+
+// scalar decodes a quoted or bare value, or a flow list "[a, b]".
+func scalar(value string) (string, error) {
+	if strings.HasPrefix(value, "[") {
+		if !strings.HasSuffix(value, "]") {
+			return "", fmt.Errorf("unterminated list %s", value)
+		}
+		inner := strings.TrimSpace(value[1 : len(value)-1])
+		if inner == "" {
+			return "", nil
+		}
+		var items []string
+		for _, item := range splitList(inner) {
+			parsed, err := scalar(strings.TrimSpace(item))
+			if err != nil {
+				return "", err
+			}
+			items = append(items, parsed)
+		}
+		return strings.Join(items, ","), nil
+	}
+
+	switch {
+	case strings.HasPrefix(value, `"`):
+		s, err := strconv.Unquote(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", value)
+		}
+		return s, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("invalid string %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	}
+	return value, nil
+}
+
+// splitList splits a flow list on commas outside quotes.
+func splitList(s string) []string {
+	var items []string
+	var quote rune
+	start := 0
+	for i, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
+
+// stripComment removes a # comment that is outside quotes and starts the
+// line or follows whitespace.
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStripComment(t *testing.T) {
+	tests := []struct {
+		line, want string
+	}{
+		{"# whole line", ""},
+		{"port: 3000 # trailing", "port: 3000 "},
+		{"port: 3000\t# after a tab", "port: 3000\t"},
+		{`secret: "a # b"`, `secret: "a # b"`},
+		{`secret: 'a # b' # real`, `secret: 'a # b' `},
+		{"url: http://x/#anchor", "url: http://x/#anchor"},
+		{`mixed: "it's" # c`, `mixed: "it's" `},
+	}
+	for _, tt := range tests {
+		if got := stripComment(tt.line); got != tt.want {
+			t.Errorf("stripComment(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "sections and comments",
+			data: "# settings\n---\nserver:\n  port: 3000 # http\n\n  mode: production\nstorage:\n  upload_dir: /data/uploads\n",
+			want: map[string]string{"server.port": "3000", "server.mode": "production", "storage.upload_dir": "/data/uploads"},
+		},
+		{
+			name: "quoted strings",
+			data: "auth:\n  jwt_secret: \"a # not a comment\"\n  admin_password: 'it''s'\n  escaped: \"tab\\there\"\n",
+			want: map[string]string{"auth.jwt_secret": "a # not a comment", "auth.admin_password": "it's", "auth.escaped": "tab\there"},
+		},
+		{
+			name: "flow list",
+			data: "server:\n  cors_origins: [\"https://a.example\", 'https://b,c.example', bare]\n  empty: []\n",
+			want: map[string]string{"server.cors_origins": "https://a.example,https://b,c.example,bare", "server.empty": ""},
+		},
+		{
+			name: "block list",
+			data: "server:\n  cors_origins:\n    - https://a.example\n    - \"https://b.example\" # second\n  port: 3000\n",
+			want: map[string]string{"server.cors_origins": "https://a.example,https://b.example", "server.port": "3000"},
+		},
+		{
+			name: "empty value",
+			data: "server:\n  frontend_dir:\n",
+			want: map[string]string{"server.frontend_dir": ""},
+		},
+		{name: "duplicate key", data: "server:\n  port: 1\n  port: 2\n", wantErr: true},
+		{name: "duplicate key across repeated section", data: "server:\n  port: 1\nserver:\n  port: 2\n", wantErr: true},
+		{name: "tab indentation", data: "server:\n\tport: 1\n", wantErr: true},
+		{name: "top-level value", data: "port: 3000\n", wantErr: true},
+		{name: "key outside a section", data: "  port: 3000\n", wantErr: true},
+		{name: "list item outside a list", data: "server:\n  port: 1\n  - x\n", wantErr: true},
+		{name: "unterminated flow list", data: "server:\n  cors_origins: [a, b\n", wantErr: true},
+		{name: "unterminated string", data: "server:\n  mode: \"prod\n", wantErr: true},
+		{name: "missing colon", data: "server:\n  port 3000\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseYAML = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseYAML = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "tables and comments",
+			data: "# settings\n[server]\nport = 3000 # http\nmode = \"production\"\n\n[storage]\nupload_dir = '/data/uploads'\n",
+			want: map[string]string{"server.port": "3000", "server.mode": "production", "storage.upload_dir": "/data/uploads"},
+		},
+		{
+			name: "quoted strings",
+			data: "[auth]\njwt_secret = \"a # b = c\"\nadmin_password = 'x#y'\n",
+			want: map[string]string{"auth.jwt_secret": "a # b = c", "auth.admin_password": "x#y"},
+		},
+		{
+			name: "lists",
+			data: "[server]\ncors_origins = [\"https://a.example\", \"https://b.example\"]\nempty = []\n",
+			want: map[string]string{"server.cors_origins": "https://a.example,https://b.example", "server.empty": ""},
+		},
+		{name: "duplicate key", data: "[server]\nport = 1\nport = 2\n", wantErr: true},
+		{name: "duplicate key across repeated table", data: "[server]\nport = 1\n[server]\nport = 2\n", wantErr: true},
+		{name: "key outside a table", data: "port = 3000\n", wantErr: true},
+		{name: "nested table", data: "[server.tls]\ncert = x\n", wantErr: true},
+		{name: "empty table name", data: "[ ]\n", wantErr: true},
+		{name: "missing equals", data: "[server]\nport 3000\n", wantErr: true},
+		{name: "unterminated string", data: "[server]\nmode = 'prod\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTOML(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseTOML = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTOML = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
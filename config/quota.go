@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// UploadQuota caps uploads over rolling one-day and seven-day windows. Zero
+// means unlimited.
+type UploadQuota struct {
+	DailyCount  int64
+	WeeklyCount int64
+	DailyBytes  int64
+	WeeklyBytes int64
+}
+
+// ParseUploadQuota reads a quota such as "5/day,20/week,25MB/day,100MB/week".
+// Counts are plain numbers and sizes carry a KB, MB or GB suffix; limits that
+// are left out are unlimited.
+func ParseUploadQuota(spec string) (UploadQuota, error) {
+	var q UploadQuota
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		amount, period, ok := strings.Cut(part, "/")
+		if !ok {
+			return q, fmt.Errorf("%q: expected <amount>/day or <amount>/week", part)
+		}
+
+		amount = strings.ToUpper(strings.TrimSpace(amount))
+		isBytes := false
+		multiplier := int64(1)
+		for _, unit := range []struct {
+			suffix string
+			size   int64
+		}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}} {
+			if strings.HasSuffix(amount, unit.suffix) {
+				amount = strings.TrimSuffix(amount, unit.suffix)
+				isBytes, multiplier = true, unit.size
+				break
+			}
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(amount), 10, 64)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("%q: invalid amount", part)
+		}
+		n *= multiplier
+
+		switch {
+		case period == "day" && isBytes:
+			q.DailyBytes = n
+		case period == "day":
+			q.DailyCount = n
+		case period == "week" && isBytes:
+			q.WeeklyBytes = n
+		case period == "week":
+			q.WeeklyCount = n
+		default:
+			return q, fmt.Errorf("%q: period must be day or week", part)
+		}
+	}
+	return q, nil
+}
+
+// String formats the quota in the syntax ParseUploadQuota reads.
+func (q UploadQuota) String() string {
+	var parts []string
+	add := func(n int64, bytes bool, period string) {
+		if n == 0 {
+			return
+		}
+		amount := strconv.FormatInt(n, 10)
+		if bytes {
+			for _, unit := range []struct {
+				suffix string
+				size   int64
+			}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+				if n%unit.size == 0 {
+					amount = strconv.FormatInt(n/unit.size, 10) + unit.suffix
+					break
+				}
+			}
+			// Byte counts that are not whole kilobytes would read back as
+			// upload counts, so round them up
+			if n%(1<<10) != 0 {
+				amount = strconv.FormatInt((n+1<<10-1)>>10, 10) + "KB"
+			}
+		}
+		parts = append(parts, amount+"/"+period)
+	}
+	add(q.DailyCount, false, "day")
+	add(q.WeeklyCount, false, "week")
+	add(q.DailyBytes, true, "day")
+	add(q.WeeklyBytes, true, "week")
+	return strings.Join(parts, ",")
+}
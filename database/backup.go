@@ -0,0 +1,167 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Snapshot writes a consistent copy of the database to path, which must not
+// exist yet. It reads inside a single transaction, so it is safe to run while
+// the server is writing.
+func Snapshot(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	_, err := DB.Exec("VACUUM INTO ?", path)
+	return err
+}
+
+// CheckSnapshot opens the database file at path read-only and verifies that
+// it is intact and looks like a database of this application.
+func CheckSnapshot(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	src, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var result string
+	if err := src.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return fmt.Errorf("not a readable database: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+	for _, table := range []string{"users", "images"} {
+		var n int
+		src.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&n)
+		if n == 0 {
+			return fmt.Errorf("missing table %s", table)
+		}
+	}
+	return nil
+}
+
+// Restore replaces the contents of every table with those of the snapshot at
+// path. The copy runs in one transaction on the live database, so the server
+// can stay up: requests see either the old data or the restored data. Tables
+// the snapshot predates are emptied, and only columns both sides share are
+// copied, so older snapshots restore into the current schema.
+func Restore(path string) error {
+	if err := CheckSnapshot(path); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS snapshot", "file:"+path+"?mode=ro"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "DETACH DATABASE snapshot")
+
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return err
+	}
+	if err := restoreTables(ctx, conn); err != nil {
+		conn.ExecContext(ctx, "ROLLBACK")
+		return err
+	}
+	_, err = conn.ExecContext(ctx, "COMMIT")
+	return err
+}
+
+func restoreTables(ctx context.Context, conn *sql.Conn) error {
+	names := func(query string, args ...interface{}) ([]string, error) {
+		rows, err := conn.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var list []string
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return nil, err
+			}
+			list = append(list, name)
+		}
+		return list, rows.Err()
+	}
+
+	// Triggers would fire on every copied row, so they are dropped for the
+	// copy and recreated from their saved definitions afterwards
+	var triggers []string
+	rows, err := conn.QueryContext(ctx, "SELECT name, sql FROM main.sqlite_master WHERE type = 'trigger'")
+	if err != nil {
+		return err
+	}
+	var triggerNames []string
+	for rows.Next() {
+		var name, def string
+		if err := rows.Scan(&name, &def); err != nil {
+			rows.Close()
+			return err
+		}
+		triggerNames = append(triggerNames, name)
+		triggers = append(triggers, def)
+	}
+	rows.Close()
+	for _, name := range triggerNames {
+		if _, err := conn.ExecContext(ctx, `DROP TRIGGER "`+name+`"`); err != nil {
+			return err
+		}
+	}
+
+	// The search index is a virtual table and is rebuilt from the restored
+	// rows rather than copied along with its internal tables
+	tables, err := names("SELECT name FROM main.sqlite_master WHERE type = 'table' AND name NOT LIKE 'images_fts%' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return err
+	}
+	tables = append(tables, "sqlite_sequence")
+
+	for _, table := range tables {
+		if _, err := conn.ExecContext(ctx, `DELETE FROM main."`+table+`"`); err != nil {
+			return fmt.Errorf("clear %s: %w", table, err)
+		}
+		columns, err := names(`SELECT m.name FROM pragma_table_info(?1, 'main') m JOIN pragma_table_info(?1, 'snapshot') s ON s.name = m.name ORDER BY m.cid`, table)
+		if err != nil {
+			return err
+		}
+		if len(columns) == 0 {
+			continue
+		}
+		list := `"` + strings.Join(columns, `", "`) + `"`
+		copyRows := `INSERT INTO main."` + table + `" (` + list + `) SELECT ` + list + ` FROM snapshot."` + table + `"`
+		if _, err := conn.ExecContext(ctx, copyRows); err != nil {
+			return fmt.Errorf("restore %s: %w", table, err)
+		}
+	}
+
+	if _, err := conn.ExecContext(ctx, "DELETE FROM images_fts"); err != nil {
+		return err
+	}
+	backfill := "INSERT INTO images_fts (rowid, " + strings.Join(searchColumns, ", ") + ") " +
+		"SELECT id, " + searchSourceExprs("images.id") + " FROM images"
+	if _, err := conn.ExecContext(ctx, backfill); err != nil {
+		return err
+	}
+
+	for _, def := range triggers {
+		if _, err := conn.ExecContext(ctx, def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
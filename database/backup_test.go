@@ -0,0 +1,59 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"hyw-webpics/config"
+)
+
+func TestCheckSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("DATABASE_PATH", filepath.Join(dir, "test.db"))
+	if _, err := config.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	Connect()
+	t.Cleanup(Close)
+
+	good := filepath.Join(dir, "snapshot.db")
+	if err := Snapshot(good); err != nil {
+		t.Fatal(err)
+	}
+	if err := Snapshot(good); err == nil {
+		t.Error("Snapshot overwrote an existing file")
+	}
+
+	garbage := filepath.Join(dir, "garbage.db")
+	os.WriteFile(garbage, []byte("not a database"), 0644)
+	other := filepath.Join(dir, "other.db")
+	if _, err := DB.Exec("VACUUM INTO ?", other); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite", other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("DROP TABLE images"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{good, true},
+		{garbage, false},
+		{other, false},
+		{filepath.Join(dir, "missing.db"), false},
+	}
+	for _, tt := range tests {
+		if err := CheckSnapshot(tt.path); (err == nil) != tt.ok {
+			t.Errorf("CheckSnapshot(%s) = %v, want ok %v", filepath.Base(tt.path), err, tt.ok)
+		}
+	}
+}
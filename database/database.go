@@ -2,28 +2,39 @@ package database
 
 import (
 	"database/sql"
-	"log"
+	"os"
+	"strings"
 
 	"hyw-webpics/config"
-
-	_ "modernc.org/sqlite"
+	"hyw-webpics/logging"
 )
 
 var DB *sql.DB
 
 func Connect() {
 	var err error
-	DB, err = sql.Open("sqlite", config.AppConfig.DatabasePath)
+	// Wait for competing writers instead of failing with SQLITE_BUSY, and
+	// use WAL so maintenance commands and backups can run next to the
+	// server without blocking its readers
+	dsn := config.AppConfig.DatabasePath
+	if strings.Contains(dsn, "?") {
+		dsn += "&"
+	} else {
+		dsn += "?"
+	}
+	dsn += "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+
+	DB, err = sql.Open(driverName, dsn)
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		fatal("Failed to connect to database", err)
 	}
 
 	if err = DB.Ping(); err != nil {
-		log.Fatal("Failed to ping database:", err)
+		fatal("Failed to ping database", err)
 	}
 
 	createTables()
-	log.Println("Database connected successfully")
+	dbLog.Info("Database connected", "path", config.AppConfig.DatabasePath)
 }
 
 func createTables() {
@@ -57,34 +68,448 @@ func createTables() {
 	);`
 
 	if _, err := DB.Exec(usersTable); err != nil {
-		log.Fatal("Failed to create users table:", err)
+		fatal("Failed to create users table", err)
 	}
 
 	if _, err := DB.Exec(categoriesTable); err != nil {
-		log.Fatal("Failed to create categories table:", err)
+		fatal("Failed to create categories table", err)
 	}
 
+	tagsTable := `
+	CREATE TABLE IF NOT EXISTS tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE
+	);`
+
+	imageTagsTable := `
+	CREATE TABLE IF NOT EXISTS image_tags (
+		image_id INTEGER NOT NULL,
+		tag_id INTEGER NOT NULL,
+		PRIMARY KEY (image_id, tag_id),
+		FOREIGN KEY (image_id) REFERENCES images(id),
+		FOREIGN KEY (tag_id) REFERENCES tags(id)
+	);`
+
+	favoritesTable := `
+	CREATE TABLE IF NOT EXISTS favorites (
+		user_id INTEGER NOT NULL,
+		image_id INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, image_id),
+		FOREIGN KEY (user_id) REFERENCES users(id),
+		FOREIGN KEY (image_id) REFERENCES images(id)
+	);`
+
+	statsTable := `
+	CREATE TABLE IF NOT EXISTS image_stats_hourly (
+		image_id INTEGER NOT NULL,
+		hour TEXT NOT NULL,
+		views INTEGER NOT NULL DEFAULT 0,
+		shares INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (image_id, hour),
+		FOREIGN KEY (image_id) REFERENCES images(id)
+	);`
+
+	collectionsTable := `
+	CREATE TABLE IF NOT EXISTS collections (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		slug TEXT NOT NULL UNIQUE,
+		description TEXT NOT NULL DEFAULT '',
+		visibility TEXT NOT NULL DEFAULT 'private',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	collectionItemsTable := `
+	CREATE TABLE IF NOT EXISTS collection_items (
+		collection_id INTEGER NOT NULL,
+		image_id INTEGER NOT NULL,
+		position INTEGER NOT NULL,
+		added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (collection_id, image_id),
+		FOREIGN KEY (collection_id) REFERENCES collections(id),
+		FOREIGN KEY (image_id) REFERENCES images(id)
+	);`
+
+	commentsTable := `
+	CREATE TABLE IF NOT EXISTS comments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		image_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		parent_id INTEGER,
+		body TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'visible',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		edited_at DATETIME,
+		FOREIGN KEY (image_id) REFERENCES images(id),
+		FOREIGN KEY (user_id) REFERENCES users(id),
+		FOREIGN KEY (parent_id) REFERENCES comments(id)
+	);`
+
+	moderationActionsTable := `
+	CREATE TABLE IF NOT EXISTS moderation_actions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		moderator TEXT NOT NULL,
+		action TEXT NOT NULL,
+		target_type TEXT NOT NULL,
+		target_id INTEGER NOT NULL,
+		image_id INTEGER,
+		reason TEXT NOT NULL DEFAULT '',
+		details TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	reportsTable := `
+	CREATE TABLE IF NOT EXISTS reports (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		image_id INTEGER NOT NULL,
+		user_id INTEGER,
+		reporter TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		details TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'open',
+		resolution TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		resolved_at DATETIME,
+		FOREIGN KEY (image_id) REFERENCES images(id)
+	);`
+
+	refreshTokensTable := `
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		family TEXT NOT NULL,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		revoked_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	apiKeysTable := `
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		key_hash TEXT NOT NULL UNIQUE,
+		scopes TEXT NOT NULL,
+		expires_at DATETIME,
+		last_used_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	recoveryCodesTable := `
+	CREATE TABLE IF NOT EXISTS recovery_codes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		code_hash TEXT NOT NULL,
+		used_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	// Shared rate limit state, used when RATE_LIMIT_STORE=sqlite. Times are
+	// fractional unix seconds.
+	rateLimitsTable := `
+	CREATE TABLE IF NOT EXISTS rate_limits (
+		key TEXT PRIMARY KEY,
+		tokens REAL NOT NULL,
+		allowed INTEGER NOT NULL DEFAULT 1,
+		updated_at REAL NOT NULL,
+		full_at REAL NOT NULL
+	);`
+
+	loginFailuresTable := `
+	CREATE TABLE IF NOT EXISTS login_failures (
+		key TEXT PRIMARY KEY,
+		failures INTEGER NOT NULL,
+		locked_until REAL NOT NULL DEFAULT 0,
+		expires_at REAL NOT NULL
+	);`
+
+	// One row per upload, kept after the image itself is gone so quotas and
+	// trust levels cannot be reset by getting uploads rejected. outcome is
+	// pending, approved, rejected (deleted before approval) or removed
+	// (deleted after approval).
+	uploadHistoryTable := `
+	CREATE TABLE IF NOT EXISTS upload_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		image_id INTEGER,
+		bytes INTEGER NOT NULL DEFAULT 0,
+		outcome TEXT NOT NULL DEFAULT 'pending',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
 	if _, err := DB.Exec(imagesTable); err != nil {
-		log.Fatal("Failed to create images table:", err)
+		fatal("Failed to create images table", err)
+	}
+
+	if _, err := DB.Exec(tagsTable); err != nil {
+		fatal("Failed to create tags table", err)
+	}
+
+	if _, err := DB.Exec(imageTagsTable); err != nil {
+		fatal("Failed to create image_tags table", err)
+	}
+
+	if _, err := DB.Exec(favoritesTable); err != nil {
+		fatal("Failed to create favorites table", err)
+	}
+
+	if _, err := DB.Exec(statsTable); err != nil {
+		fatal("Failed to create image_stats_hourly table", err)
+	}
+
+	if _, err := DB.Exec(collectionsTable); err != nil {
+		fatal("Failed to create collections table", err)
+	}
+
+	if _, err := DB.Exec(collectionItemsTable); err != nil {
+		fatal("Failed to create collection_items table", err)
+	}
+
+	if _, err := DB.Exec(commentsTable); err != nil {
+		fatal("Failed to create comments table", err)
+	}
+
+	if _, err := DB.Exec(moderationActionsTable); err != nil {
+		fatal("Failed to create moderation_actions table", err)
+	}
+
+	if _, err := DB.Exec(reportsTable); err != nil {
+		fatal("Failed to create reports table", err)
+	}
+
+	if _, err := DB.Exec(refreshTokensTable); err != nil {
+		fatal("Failed to create refresh_tokens table", err)
+	}
+
+	if _, err := DB.Exec(apiKeysTable); err != nil {
+		fatal("Failed to create api_keys table", err)
+	}
+
+	if _, err := DB.Exec(recoveryCodesTable); err != nil {
+		fatal("Failed to create recovery_codes table", err)
+	}
+
+	if _, err := DB.Exec(rateLimitsTable); err != nil {
+		fatal("Failed to create rate_limits table", err)
+	}
+
+	if _, err := DB.Exec(loginFailuresTable); err != nil {
+		fatal("Failed to create login_failures table", err)
+	}
+
+	var historyExists int
+	DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'upload_history'").Scan(&historyExists)
+	if _, err := DB.Exec(uploadHistoryTable); err != nil {
+		fatal("Failed to create upload_history table", err)
+	}
+	if historyExists == 0 {
+		// Start trust levels from the uploads that still exist
+		if _, err := DB.Exec(`
+			INSERT INTO upload_history (user_id, image_id, outcome, created_at)
+			SELECT uploader_id, id, CASE WHEN status = 'pending' THEN 'pending' ELSE 'approved' END, created_at
+			FROM images WHERE uploader_id > 0`); err != nil {
+			dbLog.Warn("Failed to backfill upload history", "err", err)
+		}
 	}
 
 	// Migration: Check if category_id exists in images table
 	var count int
 	err := DB.QueryRow("SELECT COUNT(*) FROM pragma_table_info('images') WHERE name='category_id'").Scan(&count)
 	if err == nil && count == 0 {
-		log.Println("Migrating: Adding category_id column to images table...")
+		dbLog.Info("Migrating: adding column", "table", "images", "column", "category_id")
 		_, err = DB.Exec("ALTER TABLE images ADD COLUMN category_id INTEGER REFERENCES categories(id)")
 		if err != nil {
-			log.Printf("Warning: Failed to add category_id column: %v", err)
+			dbLog.Warn("Failed to add column", "table", "images", "column", "category_id", "err", err)
 		}
 	}
 
+	addColumnIfMissing("images", "title", "TEXT NOT NULL DEFAULT ''")
+	addColumnIfMissing("images", "ocr_text", "TEXT NOT NULL DEFAULT ''")
+	addColumnIfMissing("images", "ocr_edited", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing("images", "favorite_count", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing("images", "view_count", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing("images", "share_count", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing("images", "animated", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing("images", "random_key", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing("images", "comment_count", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing("users", "display_name", "TEXT NOT NULL DEFAULT ''")
+	addColumnIfMissing("users", "avatar", "TEXT NOT NULL DEFAULT ''")
+	addColumnIfMissing("users", "token_version", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing("users", "role", "TEXT NOT NULL DEFAULT 'user'")
+	addColumnIfMissing("users", "totp_secret", "TEXT NOT NULL DEFAULT ''")
+	addColumnIfMissing("users", "totp_enabled", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing("users", "totp_last_step", "INTEGER NOT NULL DEFAULT 0")
+
+	if _, err := DB.Exec("UPDATE images SET random_key = abs(random() % 2147483646) + 1 WHERE random_key = 0"); err != nil {
+		dbLog.Warn("Failed to assign random keys", "err", err)
+	}
+	normalizeApprovedAt()
+
+	// Indexes backing the keyset pagination sort orders and random walks
+	indexes := []string{
+		"CREATE INDEX IF NOT EXISTS idx_images_status_approved ON images (status, approved_at, id)",
+		"CREATE INDEX IF NOT EXISTS idx_images_status_created ON images (status, created_at, id)",
+		"CREATE INDEX IF NOT EXISTS idx_images_status_favorites ON images (status, favorite_count, id)",
+		"CREATE INDEX IF NOT EXISTS idx_images_status_views ON images (status, view_count, id)",
+		"CREATE INDEX IF NOT EXISTS idx_images_status_random ON images (status, random_key, id)",
+		"CREATE INDEX IF NOT EXISTS idx_images_category_random ON images (status, category_id, random_key, id)",
+		"CREATE INDEX IF NOT EXISTS idx_images_uploader ON images (uploader_id, status, approved_at, id)",
+		"CREATE INDEX IF NOT EXISTS idx_image_tags_tag ON image_tags (tag_id, image_id)",
+		"CREATE INDEX IF NOT EXISTS idx_favorites_image ON favorites (image_id)",
+		"CREATE INDEX IF NOT EXISTS idx_favorites_user_created ON favorites (user_id, created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_image_stats_hour ON image_stats_hourly (hour)",
+		"CREATE INDEX IF NOT EXISTS idx_collections_user ON collections (user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_collections_visibility ON collections (visibility, updated_at)",
+		"CREATE INDEX IF NOT EXISTS idx_collection_items_image ON collection_items (image_id)",
+		"CREATE INDEX IF NOT EXISTS idx_collection_items_position ON collection_items (collection_id, position)",
+		"CREATE INDEX IF NOT EXISTS idx_comments_image ON comments (image_id, parent_id, created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_comments_parent ON comments (parent_id)",
+		"CREATE INDEX IF NOT EXISTS idx_comments_status ON comments (status, created_at)",
+		// A client can only have one open report per image
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_reports_open_reporter ON reports (image_id, reporter) WHERE status = 'open'",
+		"CREATE INDEX IF NOT EXISTS idx_reports_status ON reports (status, image_id)",
+		"CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user ON refresh_tokens (user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens (family)",
+		"CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys (user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_upload_history_user ON upload_history (user_id, created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_upload_history_image ON upload_history (image_id)",
+		"CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes (user_id, code_hash)",
+		"CREATE INDEX IF NOT EXISTS idx_moderation_actions_created ON moderation_actions (created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_moderation_actions_target ON moderation_actions (target_type, target_id)",
+	}
+	for _, idx := range indexes {
+		if _, err := DB.Exec(idx); err != nil {
+			dbLog.Warn("Failed to create index", "sql", idx, "err", err)
+		}
+	}
+
+	createTriggers()
+	createSearchIndex()
 	seedCategories()
 }
 
+func createTriggers() {
+	triggers := []string{
+		// Every image gets a fixed random position used by the random endpoint
+		`CREATE TRIGGER IF NOT EXISTS images_random_key AFTER INSERT ON images WHEN new.random_key = 0 BEGIN
+			UPDATE images SET random_key = abs(random() % 2147483646) + 1 WHERE id = new.id;
+		END;`,
+		// Dependent rows are not covered by foreign key enforcement, so clean them up here
+		`CREATE TRIGGER IF NOT EXISTS images_tags_cleanup AFTER DELETE ON images BEGIN
+			DELETE FROM image_tags WHERE image_id = old.id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS images_favorites_cleanup AFTER DELETE ON images BEGIN
+			DELETE FROM favorites WHERE image_id = old.id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS images_stats_cleanup AFTER DELETE ON images BEGIN
+			DELETE FROM image_stats_hourly WHERE image_id = old.id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS images_collections_cleanup AFTER DELETE ON images BEGIN
+			DELETE FROM collection_items WHERE image_id = old.id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS collections_items_cleanup AFTER DELETE ON collections BEGIN
+			DELETE FROM collection_items WHERE collection_id = old.id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS images_comments_cleanup AFTER DELETE ON images BEGIN
+			DELETE FROM comments WHERE image_id = old.id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS images_reports_cleanup AFTER DELETE ON images BEGIN
+			DELETE FROM reports WHERE image_id = old.id;
+		END;`,
+		// A deleted account takes its personal data with it; uploads are
+		// handled by the caller since the user chooses what happens to them
+		`CREATE TRIGGER IF NOT EXISTS users_cleanup AFTER DELETE ON users BEGIN
+			DELETE FROM favorites WHERE user_id = old.id;
+			DELETE FROM comments WHERE user_id = old.id;
+			DELETE FROM collections WHERE user_id = old.id;
+			UPDATE reports SET user_id = NULL WHERE user_id = old.id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS users_refresh_tokens_cleanup AFTER DELETE ON users BEGIN
+			DELETE FROM refresh_tokens WHERE user_id = old.id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS users_api_keys_cleanup AFTER DELETE ON users BEGIN
+			DELETE FROM api_keys WHERE user_id = old.id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS users_recovery_codes_cleanup AFTER DELETE ON users BEGIN
+			DELETE FROM recovery_codes WHERE user_id = old.id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS users_upload_history_cleanup AFTER DELETE ON users BEGIN
+			DELETE FROM upload_history WHERE user_id = old.id;
+		END;`,
+		// Upload outcomes follow the image, feeding trust levels
+		`CREATE TRIGGER IF NOT EXISTS images_upload_approved AFTER UPDATE OF status ON images WHEN new.status = 'approved' BEGIN
+			UPDATE upload_history SET outcome = 'approved' WHERE image_id = new.id AND outcome = 'pending';
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS images_upload_deleted AFTER DELETE ON images BEGIN
+			UPDATE upload_history SET outcome = CASE WHEN outcome = 'approved' THEN 'removed' ELSE 'rejected' END
+			WHERE image_id = old.id AND outcome IN ('pending', 'approved');
+		END;`,
+		// Replies go with the comment they answer
+		`CREATE TRIGGER IF NOT EXISTS comments_replies_cleanup AFTER DELETE ON comments BEGIN
+			DELETE FROM comments WHERE parent_id = old.id;
+		END;`,
+		// comment_count only counts visible comments, so hiding and
+		// unhiding moves it as well
+		`CREATE TRIGGER IF NOT EXISTS comments_count_ai AFTER INSERT ON comments WHEN new.status = 'visible' BEGIN
+			UPDATE images SET comment_count = comment_count + 1 WHERE id = new.image_id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS comments_count_ad AFTER DELETE ON comments WHEN old.status = 'visible' BEGIN
+			UPDATE images SET comment_count = comment_count - 1 WHERE id = old.image_id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS comments_count_au AFTER UPDATE OF status ON comments WHEN old.status != new.status BEGIN
+			UPDATE images SET comment_count = comment_count + (new.status = 'visible') - (old.status = 'visible') WHERE id = new.image_id;
+		END;`,
+		// Favorite counts change in the same statement as the favorite row,
+		// so they stay exact under concurrent toggles
+		`CREATE TRIGGER IF NOT EXISTS favorites_count_ai AFTER INSERT ON favorites BEGIN
+			UPDATE images SET favorite_count = favorite_count + 1 WHERE id = new.image_id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS favorites_count_ad AFTER DELETE ON favorites BEGIN
+			UPDATE images SET favorite_count = favorite_count - 1 WHERE id = old.image_id;
+		END;`,
+	}
+
+	for _, trigger := range triggers {
+		if _, err := DB.Exec(trigger); err != nil {
+			fatal("Failed to create trigger", err)
+		}
+	}
+}
+
+// addColumnIfMissing adds a column to an existing table on databases created
+// before the column was introduced.
+func addColumnIfMissing(table, column, definition string) {
+	var count int
+	err := DB.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count)
+	if err != nil {
+		dbLog.Warn("Failed to inspect table", "table", table, "err", err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+
+	dbLog.Info("Migrating: adding column", "table", table, "column", column)
+	if _, err := DB.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition); err != nil {
+		dbLog.Warn("Failed to add column", "table", table, "column", column, "err", err)
+	}
+}
+
 func seedCategories() {
 	var count int
-	DB.QueryRow("SELECT COUNT(*) FROM categories").Scan(&count)
+	if err := DB.QueryRow("SELECT COUNT(*) FROM categories").Scan(&count); err != nil {
+		dbLog.Warn("Failed to count categories", "err", err)
+		return
+	}
 	if count == 0 {
 		categories := []struct {
 			Name string
@@ -102,14 +527,27 @@ func seedCategories() {
 			if c.Slug == "all" {
 				continue
 			}
-			DB.Exec("INSERT INTO categories (name, slug) VALUES (?, ?)", c.Name, c.Slug)
+			if _, err := DB.Exec("INSERT INTO categories (name, slug) VALUES (?, ?)", c.Name, c.Slug); err != nil {
+				dbLog.Warn("Failed to seed category", "slug", c.Slug, "err", err)
+			}
 		}
-		log.Println("Seeded default categories")
+		dbLog.Info("Seeded default categories")
 	}
 }
 
 func Close() {
 	if DB != nil {
-		DB.Close()
+		if err := DB.Close(); err != nil {
+			dbLog.Error("Failed to close database", "err", err)
+		}
 	}
 }
+
+var dbLog = logging.For("db")
+
+// fatal logs a failed migration step and exits, as the server cannot run on
+// a half-migrated schema.
+func fatal(msg string, err error) {
+	dbLog.Error(msg, "err", err)
+	os.Exit(1)
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"hyw-webpics/metrics"
+
+	"modernc.org/sqlite"
+)
+
+// driverName is the SQLite driver wrapped to time every statement into
+// metrics.DBQuery, so no call site has to.
+const driverName = "sqlite-timed"
+
+func init() {
+	sql.Register(driverName, timedDriver{&sqlite.Driver{}})
+}
+
+// sqliteConn is the set of connection interfaces the SQLite driver
+// implements and database/sql looks for.
+type sqliteConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+type timedDriver struct {
+	driver.Driver
+}
+
+func (d timedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := conn.(sqliteConn); ok {
+		return timedConn{c}, nil
+	}
+	return conn, nil
+}
+
+type timedConn struct {
+	sqliteConn
+}
+
+func (c timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	defer metrics.DBQuery.Since(time.Now(), "exec")
+	return c.sqliteConn.ExecContext(ctx, query, args)
+}
+
+func (c timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	defer metrics.DBQuery.Since(time.Now(), "query")
+	return c.sqliteConn.QueryContext(ctx, query, args)
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"strings"
+)
+
+// searchColumns are the columns of the images_fts index, in order. The
+// trigram tokenizer is used because unicode61 treats a run of CJK characters
+// as a single token, which makes Chinese text unsearchable by substring.
+var searchColumns = []string{"title", "original_name", "tags", "ocr_text"}
+
+var searchTriggers = []string{
+	"images_fts_ai",
+	"images_fts_au",
+	"images_fts_ad",
+	"image_tags_fts_ai",
+	"image_tags_fts_ad",
+}
+
+const imageTagsExpr = `(SELECT COALESCE(group_concat(t.name, ' '), '') FROM image_tags it JOIN tags t ON t.id = it.tag_id WHERE it.image_id = %s)`
+
+func createSearchIndex() {
+	var existing []string
+	rows, err := DB.Query("SELECT name FROM pragma_table_info('images_fts') ORDER BY cid")
+	if err == nil {
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				dbLog.Warn("Failed to read search index columns", "err", err)
+				continue
+			}
+			existing = append(existing, name)
+		}
+		rows.Close()
+	}
+
+	if strings.Join(existing, ",") != strings.Join(searchColumns, ",") {
+		if len(existing) > 0 {
+			dbLog.Info("Migrating: rebuilding images_fts search index")
+		}
+		rebuildSearchIndex()
+	}
+
+	createSearchTriggers()
+}
+
+func rebuildSearchIndex() {
+	for _, name := range searchTriggers {
+		if _, err := DB.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+			dbLog.Warn("Failed to drop search trigger", "trigger", name, "err", err)
+		}
+	}
+	if _, err := DB.Exec("DROP TABLE IF EXISTS images_fts"); err != nil {
+		fatal("Failed to drop search index", err)
+	}
+
+	createTable := "CREATE VIRTUAL TABLE images_fts USING fts5(" +
+		strings.Join(searchColumns, ", ") + ", tokenize = 'trigram')"
+	if _, err := DB.Exec(createTable); err != nil {
+		fatal("Failed to create search index", err)
+	}
+
+	backfill := "INSERT INTO images_fts (rowid, " + strings.Join(searchColumns, ", ") + ") " +
+		"SELECT id, " + searchSourceExprs("images.id") + " FROM images"
+	if _, err := DB.Exec(backfill); err != nil {
+		fatal("Failed to populate search index", err)
+	}
+}
+
+// searchSourceExprs returns the expressions that produce each search column
+// for the image identified by idExpr, with images columns unqualified.
+func searchSourceExprs(idExpr string) string {
+	exprs := make([]string, len(searchColumns))
+	for i, col := range searchColumns {
+		if col == "tags" {
+			exprs[i] = strings.Replace(imageTagsExpr, "%s", idExpr, 1)
+		} else {
+			exprs[i] = col
+		}
+	}
+	return strings.Join(exprs, ", ")
+}
+
+func createSearchTriggers() {
+	var insertCols, newValues, updateSets, watched []string
+	for _, col := range searchColumns {
+		if col == "tags" {
+			continue
+		}
+		insertCols = append(insertCols, col)
+		newValues = append(newValues, "new."+col)
+		updateSets = append(updateSets, col+" = new."+col)
+		watched = append(watched, col)
+	}
+
+	tagsFor := func(id string) string {
+		return "UPDATE images_fts SET tags = " + strings.Replace(imageTagsExpr, "%s", id, 1) + " WHERE rowid = " + id + ";"
+	}
+
+	triggers := []string{
+		`CREATE TRIGGER IF NOT EXISTS images_fts_ai AFTER INSERT ON images BEGIN
+			INSERT INTO images_fts (rowid, ` + strings.Join(insertCols, ", ") + `) VALUES (new.id, ` + strings.Join(newValues, ", ") + `);
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS images_fts_au AFTER UPDATE OF ` + strings.Join(watched, ", ") + ` ON images BEGIN
+			UPDATE images_fts SET ` + strings.Join(updateSets, ", ") + ` WHERE rowid = new.id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS images_fts_ad AFTER DELETE ON images BEGIN
+			DELETE FROM images_fts WHERE rowid = old.id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS image_tags_fts_ai AFTER INSERT ON image_tags BEGIN
+			` + tagsFor("new.image_id") + `
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS image_tags_fts_ad AFTER DELETE ON image_tags BEGIN
+			` + tagsFor("old.image_id") + `
+		END;`,
+	}
+
+	for _, trigger := range triggers {
+		if _, err := DB.Exec(trigger); err != nil {
+			fatal("Failed to create search trigger", err)
+		}
+	}
+}
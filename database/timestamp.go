@@ -0,0 +1,71 @@
+package database
+
+import (
+	"strings"
+	"time"
+)
+
+// TimeLayout is how timestamps written from Go are stored: UTC to the
+// second, the same text SQLite's CURRENT_TIMESTAMP produces, so values
+// written either way compare and sort correctly as text.
+const TimeLayout = "2006-01-02 15:04:05"
+
+// Timestamp formats t in TimeLayout. Pass its result instead of a
+// time.Time, which the driver would store as t.String().
+func Timestamp(t time.Time) string {
+	return t.UTC().Format(TimeLayout)
+}
+
+// normalizeApprovedAt rewrites approved_at values stored by older versions
+// as time.String() ("2006-01-02 15:04:05.999 +0800 CST m=+0.1") in
+// TimeLayout, and fills in the missing ones of published images with their
+// upload time, so listings keyed on approved_at can page through them.
+func normalizeApprovedAt() {
+	rows, err := DB.Query(`SELECT id, CAST(approved_at AS TEXT) FROM images
+		WHERE approved_at IS NOT NULL AND approved_at NOT GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9] [0-9][0-9]:[0-9][0-9]:[0-9][0-9]'`)
+	if err != nil {
+		dbLog.Warn("Failed to read approval times", "err", err)
+		return
+	}
+	fixed := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var raw string
+		if err := rows.Scan(&id, &raw); err != nil {
+			dbLog.Warn("Failed to read approval time", "err", err)
+			continue
+		}
+		t, err := parseStoredTime(raw)
+		if err != nil {
+			dbLog.Warn("Unreadable approval time", "image_id", id, "value", raw)
+			continue
+		}
+		fixed[id] = Timestamp(t)
+	}
+	rows.Close()
+
+	for id, ts := range fixed {
+		if _, err := DB.Exec("UPDATE images SET approved_at = ? WHERE id = ?", ts, id); err != nil {
+			dbLog.Warn("Failed to normalize approval time", "image_id", id, "err", err)
+		}
+	}
+	if len(fixed) > 0 {
+		dbLog.Info("Migrating: normalized approval times", "images", len(fixed))
+	}
+
+	if _, err := DB.Exec("UPDATE images SET approved_at = created_at WHERE approved_at IS NULL AND status IN ('approved', 'review')"); err != nil {
+		dbLog.Warn("Failed to fill in approval times", "err", err)
+	}
+}
+
+// parseStoredTime reads a time written as time.String() or in RFC 3339.
+func parseStoredTime(s string) (time.Time, error) {
+	if i := strings.Index(s, " m="); i >= 0 {
+		s = s[:i]
+	}
+	t, err := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", s)
+	if err != nil {
+		return time.Parse(time.RFC3339Nano, s)
+	}
+	return t, nil
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"hyw-webpics/config"
+)
+
+func TestNormalizeApprovedAt(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("DATABASE_PATH", filepath.Join(t.TempDir(), "test.db"))
+	if _, err := config.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	Connect()
+	t.Cleanup(Close)
+
+	tests := []struct {
+		status     string
+		approvedAt interface{}
+		want       sql.NullString
+	}{
+		{"approved", "2024-05-01 20:00:00.123456789 +0800 CST m=+12.345678901", sql.NullString{String: "2024-05-01 12:00:00", Valid: true}},
+		{"approved", "2024-05-01 12:00:00.5 +0000 UTC", sql.NullString{String: "2024-05-01 12:00:00", Valid: true}},
+		{"review", "2024-05-01T14:00:00+02:00", sql.NullString{String: "2024-05-01 12:00:00", Valid: true}},
+		{"approved", "2024-05-01 12:00:00", sql.NullString{String: "2024-05-01 12:00:00", Valid: true}},
+		// Published without an approval time: the upload time stands in
+		{"approved", nil, sql.NullString{String: "2023-01-01 00:00:00", Valid: true}},
+		{"pending", nil, sql.NullString{}},
+	}
+	for i, tt := range tests {
+		if _, err := DB.Exec(
+			"INSERT INTO images (id, filename, original_name, uploader_id, status, approved_at, created_at) VALUES (?, ?, 'x.png', 0, ?, ?, '2023-01-01 00:00:00')",
+			i+1, string(rune('a'+i))+".webp", tt.status, tt.approvedAt,
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	normalizeApprovedAt()
+
+	for i, tt := range tests {
+		var got sql.NullString
+		if err := DB.QueryRow("SELECT CAST(approved_at AS TEXT) FROM images WHERE id = ?", i+1).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%v (%s) became %v, want %v", tt.approvedAt, tt.status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"database/sql"
+
+	"hyw-webpics/database"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// checkPassword verifies the current user's password. On failure it returns
+// the status and message to respond with.
+func checkPassword(userID int64, password string) (int, string) {
+	var hash string
+	if err := database.DB.QueryRow("SELECT password FROM users WHERE id = ?", userID).Scan(&hash); err != nil {
+		return fiber.StatusInternalServerError, "Database error"
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return fiber.StatusUnauthorized, "Current password is incorrect"
+	}
+	return 0, ""
+}
+
+// ChangePassword sets a new password and revokes every session. The response
+// carries a fresh session so the current client stays signed in.
+func ChangePassword(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+
+	var req ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if len(req.NewPassword) < 6 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Password must be at least 6 characters"})
+	}
+	if status, msg := checkPassword(userID, req.CurrentPassword); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	if err := setPassword(tx, userID, req.NewPassword); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update password"})
+	}
+
+	var username string
+	var tokenVersion int64
+	scanRow(c, "read session user", tx.QueryRow("SELECT username, token_version FROM users WHERE id = ?", userID), &username, &tokenVersion)
+
+	session, err := newSession(tx, userID, username, tokenVersion, "")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update password"})
+	}
+
+	session["message"] = "Password changed"
+	return c.JSON(session)
+}
+
+// setPassword stores a new password and signs the user out everywhere.
+func setPassword(db execer, userID int64, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec("UPDATE users SET password = ? WHERE id = ?", string(hashedPassword), userID); err != nil {
+		return err
+	}
+	return revokeAllSessions(db, userID)
+}
+
+// ResetPassword sets a user's password without knowing the old one, for the
+// user reset-password command. Every session of the user is revoked.
+func ResetPassword(username, password string) error {
+	if len(password) < 6 {
+		return errWeakCredentials
+	}
+
+	var userID int64
+	err := database.DB.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return errUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setPassword(tx, userID, password); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+	Uploads  string `json:"uploads"` // "anonymize" or "remove"
+}
+
+// DeleteAccount removes the current user. Approved uploads are either kept
+// without an uploader or removed, as the user chooses; uploads that were
+// never published are always removed.
+func DeleteAccount(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+
+	var req DeleteAccountRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Uploads != "anonymize" && req.Uploads != "remove" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "uploads must be anonymize or remove"})
+	}
+	if status, msg := checkPassword(userID, req.Password); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	removeWhere := "uploader_id = ?"
+	if req.Uploads == "anonymize" {
+		removeWhere += " AND status != 'approved'"
+	}
+
+	var files []string
+	rows, err := tx.Query("SELECT filename FROM images WHERE "+removeWhere, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	for rows.Next() {
+		var filename string
+		if err := rows.Scan(&filename); err != nil {
+			logScanError(c, "account files", err)
+			continue
+		}
+		files = append(files, filename)
+	}
+	rows.Close()
+
+	var avatar string
+	scanRow(c, "read avatar", tx.QueryRow("SELECT avatar FROM users WHERE id = ?", userID), &avatar)
+
+	steps := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"DELETE FROM images WHERE " + removeWhere, []interface{}{userID}},
+		{"UPDATE images SET uploader_id = 0 WHERE uploader_id = ?", []interface{}{userID}},
+		{"DELETE FROM users WHERE id = ?", []interface{}{userID}},
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step.query, step.args...); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete account"})
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete account"})
+	}
+
+	for _, filename := range files {
+		removeImageFiles(filename)
+	}
+	if avatar != "" {
+		removeImageFiles(avatar)
+	}
+
+	return c.JSON(fiber.Map{
+		"message":        "Account deleted",
+		"removed_images": len(files),
+	})
+}
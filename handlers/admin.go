@@ -1,20 +1,32 @@
 package handlers
 
 import (
+	"crypto/subtle"
 	"database/sql"
-	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"hyw-webpics/config"
 	"hyw-webpics/database"
+	"hyw-webpics/middleware"
 	"hyw-webpics/models"
+	"hyw-webpics/totp"
+	"hyw-webpics/utils"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type AdminLoginRequest struct {
 	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// adminLastStep is the last TOTP step accepted for the shared admin login, so
+// a code cannot be replayed within its window.
+var adminLastStep struct {
+	sync.Mutex
+	step int64
 }
 
 func AdminLogin(c *fiber.Ctx) error {
@@ -25,25 +37,58 @@ func AdminLogin(c *fiber.Ctx) error {
 		})
 	}
 
-	if req.Password != config.AppConfig.AdminPassword {
-		// DEBUG LOGGING
-		// fmt.Printf("DEBUG LOGIN: Received '%s', Expected '%s'\n", req.Password, config.AppConfig.AdminPassword)
+	// The shared admin login has no account to lock, so lock out the client
+	lockKey := "admin:" + c.IP()
+	if wait := middleware.LoginLockedFor(lockKey); wait > 0 {
+		return middleware.TooManyRequests(c, wait, "Too many failed sign-in attempts, try again later")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(req.Password), []byte(config.AppConfig.AdminPassword)) != 1 {
+		middleware.LoginFailed(lockKey)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid admin password",
 		})
 	}
 
-	// Set admin session cookie
+	if secret := config.AppConfig.AdminTOTPSecret; secret != "" {
+		step, ok := totp.Validate(secret, req.Code, totp.Now())
+		adminLastStep.Lock()
+		if ok && step <= adminLastStep.step {
+			ok = false
+		}
+		if ok {
+			adminLastStep.step = step
+		}
+		adminLastStep.Unlock()
+		if !ok {
+			middleware.LoginFailed(lockKey)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":               "Invalid two-factor code",
+				"two_factor_required": true,
+			})
+		}
+	} else if config.AppConfig.Require2FA {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Password-only admin login is disabled, set ADMIN_TOTP_SECRET or sign in as a user with the admin role",
+		})
+	}
+
+	middleware.LoginSucceeded(lockKey)
+
+	// Set admin session cookie, signed so it cannot be forged
+	expires := time.Now().Add(24 * time.Hour)
+	session := middleware.AdminSessionValue(expires)
 	c.Cookie(&fiber.Cookie{
 		Name:     "admin_session",
-		Value:    "authenticated",
-		Expires:  time.Now().Add(24 * time.Hour),
+		Value:    session,
+		Expires:  expires,
 		HTTPOnly: true,
 		SameSite: "Strict",
 	})
 
 	return c.JSON(fiber.Map{
-		"message": "Admin login successful",
+		"message":     "Admin login successful",
+		"admin_token": middleware.AdminToken(session),
 	})
 }
 
@@ -63,8 +108,7 @@ func AdminLogout(c *fiber.Ctx) error {
 
 func GetPendingImages(c *fiber.Ctx) error {
 	rows, err := database.DB.Query(
-		`SELECT id, filename, original_name, uploader_id, category_id, status, created_at 
-		 FROM images WHERE status = 'pending' ORDER BY created_at ASC`,
+		"SELECT " + imageColumns + " FROM images WHERE status = 'pending' ORDER BY created_at ASC",
 	)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -75,13 +119,15 @@ func GetPendingImages(c *fiber.Ctx) error {
 
 	var images []models.Image
 	for rows.Next() {
-		var img models.Image
-		err := rows.Scan(&img.ID, &img.Filename, &img.OriginalName, &img.UploaderID, &img.CategoryID, &img.Status, &img.CreatedAt)
+		img, err := scanImage(rows)
 		if err != nil {
+			logScanError(c, "pending images", err)
 			continue
 		}
 		images = append(images, img)
 	}
+	attachTags(c, images)
+	attachUploaders(c, images)
 
 	return c.JSON(fiber.Map{
 		"images": images,
@@ -111,7 +157,7 @@ func ApproveImage(c *fiber.Ctx) error {
 
 	result, err := database.DB.Exec(
 		"UPDATE images SET status = 'approved', approved_at = ?, category_id = ? WHERE id = ? AND status = 'pending'",
-		time.Now(), req.CategoryID, id,
+		database.Timestamp(time.Now()), req.CategoryID, id,
 	)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -158,76 +204,69 @@ func RejectImage(c *fiber.Ctx) error {
 		})
 	}
 
-	// Delete file from disk
-	filePath := filepath.Join(config.AppConfig.UploadDir, filename)
-	os.Remove(filePath)
+	removeImageFiles(filename)
 
 	return c.JSON(fiber.Map{
 		"message": "Image and file deleted successfully",
 	})
 }
 
+// removeImageFiles deletes an image's upload and cached variants from disk.
+func removeImageFiles(filename string) {
+	removeFile(nil, filepath.Join(config.AppConfig.UploadDir, filename))
+	utils.RemoveVariants(filename)
+}
+
 // Updated GetAdminImages to support listing all images with pagination
 func GetAdminImages(c *fiber.Ctx) error {
-	page := c.QueryInt("page", 1)
-	limit := c.QueryInt("limit", 20)
-	offset := (page - 1) * limit
-	status := c.Query("status") // "pending", "approved", or empty for all
-
-	// Build query
-	var query string
-	var countQuery string
-	var args []interface{}
+	req, err := parsePageRequest(c, "created_at")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	status := c.Query("status") // "pending", "approved", "review", or empty for all
 
+	where := "1 = 1"
+	var args []interface{}
 	if status != "" {
-		query = "SELECT id, filename, original_name, uploader_id, category_id, status, created_at FROM images WHERE status = ? ORDER BY created_at DESC LIMIT ? OFFSET ?"
-		countQuery = "SELECT COUNT(*) FROM images WHERE status = ?"
+		where = "status = ?"
 		args = append(args, status)
-	} else {
-		query = "SELECT id, filename, original_name, uploader_id, category_id, status, created_at FROM images ORDER BY created_at DESC LIMIT ? OFFSET ?"
-		countQuery = "SELECT COUNT(*) FROM images"
 	}
 
-	// Execute count query
-	var total int
-	database.DB.QueryRow(countQuery, args...).Scan(&total)
-
-	// Execute data query
-	args = append(args, limit, offset)
-	rows, err := database.DB.Query(query, args...)
+	images, nextCursor, err := queryImagePage(c, req, "FROM images", where, args)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch images"})
 	}
-	defer rows.Close()
+	attachTags(c, images)
+	attachUploaders(c, images)
 
-	var images []models.Image
-	for rows.Next() {
-		var img models.Image
-		if err := rows.Scan(&img.ID, &img.Filename, &img.OriginalName, &img.UploaderID, &img.CategoryID, &img.Status, &img.CreatedAt); err == nil {
-			images = append(images, img)
-		}
+	var total int
+	if !req.cursorMode {
+		scanRow(c, "count images", database.DB.QueryRow("SELECT COUNT(*) FROM images WHERE "+where, args...), &total)
 	}
 
-	return c.JSON(fiber.Map{
-		"images": images,
-		"total":  total,
-		"page":   page,
-		"limit":  limit,
-	})
+	return c.JSON(imagePageResponse(req, images, nextCursor, total))
 }
 
 func GetAdminStats(c *fiber.Ctx) error {
-	var totalImages, pendingImages, approvedImages, totalCategories int
+	var totalImages, pendingImages, approvedImages, totalCategories, totalComments, hiddenComments, reviewImages, openReports int
 
-	database.DB.QueryRow("SELECT COUNT(*) FROM images").Scan(&totalImages)
-	database.DB.QueryRow("SELECT COUNT(*) FROM images WHERE status = 'pending'").Scan(&pendingImages)
-	database.DB.QueryRow("SELECT COUNT(*) FROM images WHERE status = 'approved'").Scan(&approvedImages)
-	database.DB.QueryRow("SELECT COUNT(*) FROM categories").Scan(&totalCategories)
+	scanRow(c, "count images", database.DB.QueryRow("SELECT COUNT(*) FROM images"), &totalImages)
+	scanRow(c, "count images", database.DB.QueryRow("SELECT COUNT(*) FROM images WHERE status = 'pending'"), &pendingImages)
+	scanRow(c, "count images", database.DB.QueryRow("SELECT COUNT(*) FROM images WHERE status = 'approved'"), &approvedImages)
+	scanRow(c, "count images", database.DB.QueryRow("SELECT COUNT(*) FROM images WHERE status = 'review'"), &reviewImages)
+	scanRow(c, "count categories", database.DB.QueryRow("SELECT COUNT(*) FROM categories"), &totalCategories)
+	scanRow(c, "count comments", database.DB.QueryRow("SELECT COUNT(*) FROM comments"), &totalComments)
+	scanRow(c, "count comments", database.DB.QueryRow("SELECT COUNT(*) FROM comments WHERE status = 'hidden'"), &hiddenComments)
+	scanRow(c, "count reports", database.DB.QueryRow("SELECT COUNT(*) FROM reports WHERE status = 'open'"), &openReports)
 
 	return c.JSON(fiber.Map{
 		"total_images":     totalImages,
 		"pending_images":   pendingImages,
 		"approved_images":  approvedImages,
 		"total_categories": totalCategories,
+		"total_comments":   totalComments,
+		"hidden_comments":  hiddenComments,
+		"review_images":    reviewImages,
+		"open_reports":     openReports,
 	})
 }
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"hyw-webpics/database"
+	"hyw-webpics/models"
+	"hyw-webpics/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// apiKeyScopes are the scopes a key can be granted. Routes opt in to API keys
+// by naming the scope they need in middleware.UserAuth.
+var apiKeyScopes = map[string]bool{"upload": true, "read": true, "favorite": true}
+
+const (
+	maxAPIKeysPerUser = 20
+	maxAPIKeyName     = 100
+	apiKeyPrefixLen   = len(utils.APIKeyPrefix) + 6
+)
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"` // 0 never expires
+}
+
+// CreateAPIKey issues a new key for the current user. The key is returned in
+// this response only; afterwards just its prefix is shown.
+func CreateAPIKey(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+
+	var req CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxAPIKeyName {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Name must be between 1 and 100 characters"})
+	}
+	if req.ExpiresInDays < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "expires_in_days must not be negative"})
+	}
+
+	seen := make(map[string]bool)
+	var scopes []string
+	for _, scope := range req.Scopes {
+		if !apiKeyScopes[scope] {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unknown scope: " + scope})
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "At least one scope is required"})
+	}
+	sort.Strings(scopes)
+
+	var count int
+	scanRow(c, "count api keys", database.DB.QueryRow("SELECT COUNT(*) FROM api_keys WHERE user_id = ?", userID), &count)
+	if count >= maxAPIKeysPerUser {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "API key limit reached"})
+	}
+
+	secret, err := utils.RandomToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate key"})
+	}
+	key := utils.APIKeyPrefix + secret
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().UTC().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+		expiresAt = &t
+	}
+
+	result, err := database.DB.Exec(
+		"INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, name, key[:apiKeyPrefixLen], utils.HashToken(key), strings.Join(scopes, ","), expiresAt,
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create key"})
+	}
+
+	id, _ := result.LastInsertId()
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"id":         id,
+		"name":       name,
+		"prefix":     key[:apiKeyPrefixLen],
+		"scopes":     scopes,
+		"expires_at": expiresAt,
+		"key":        key,
+	})
+}
+
+func GetMyAPIKeys(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+
+	rows, err := database.DB.Query(
+		"SELECT id, name, prefix, scopes, expires_at, last_used_at, created_at FROM api_keys WHERE user_id = ? ORDER BY created_at DESC, id DESC",
+		userID,
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch keys"})
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var k models.APIKey
+		var scopes string
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &scopes, &k.ExpiresAt, &k.LastUsedAt, &k.CreatedAt); err != nil {
+			logScanError(c, "api keys", err)
+			continue
+		}
+		k.Scopes = strings.Split(scopes, ",")
+		keys = append(keys, k)
+	}
+
+	return c.JSON(fiber.Map{"keys": keys})
+}
+
+func RevokeAPIKey(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+
+	result, err := database.DB.Exec("DELETE FROM api_keys WHERE id = ? AND user_id = ?", c.Params("id"), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke key"})
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "API key not found"})
+	}
+
+	return c.JSON(fiber.Map{"message": "API key revoked"})
+}
@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"errors"
+	"strings"
 	"time"
 
 	"hyw-webpics/config"
 	"hyw-webpics/database"
+	"hyw-webpics/middleware"
 	"hyw-webpics/models"
 
 	"github.com/gofiber/fiber/v2"
@@ -30,46 +33,23 @@ func Register(c *fiber.Ctx) error {
 		})
 	}
 
-	if len(req.Username) < 3 || len(req.Password) < 6 {
+	id, err := CreateUser(req.Username, req.Password, "user")
+	switch err {
+	case nil:
+	case errWeakCredentials:
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Username must be at least 3 characters, password at least 6 characters",
 		})
-	}
-
-	// Check if username exists
-	var exists int
-	err := database.DB.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", req.Username).Scan(&exists)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Database error",
-		})
-	}
-	if exists > 0 {
+	case errUsernameTaken:
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
 			"error": "Username already exists",
 		})
-	}
-
-	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to hash password",
-		})
-	}
-
-	// Insert user
-	result, err := database.DB.Exec(
-		"INSERT INTO users (username, password) VALUES (?, ?)",
-		req.Username, string(hashedPassword),
-	)
-	if err != nil {
+	default:
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create user",
 		})
 	}
 
-	id, _ := result.LastInsertId()
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "User created successfully",
 		"user": fiber.Map{
@@ -79,6 +59,47 @@ func Register(c *fiber.Ctx) error {
 	})
 }
 
+var (
+	errWeakCredentials = errors.New("username must be at least 3 characters, password at least 6 characters")
+	errUsernameTaken   = errors.New("username already exists")
+	errInvalidRole     = errors.New("role must be user, moderator or admin")
+	errUserNotFound    = errors.New("user not found")
+)
+
+// CreateUser adds an account with the given role. It is shared by
+// registration and the user create command.
+func CreateUser(username, password, role string) (int64, error) {
+	if len(username) < 3 || len(password) < 6 {
+		return 0, errWeakCredentials
+	}
+	if role != "user" && !privilegedRoles[role] {
+		return 0, errInvalidRole
+	}
+
+	// Check if username exists
+	var exists int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", username).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if exists > 0 {
+		return 0, errUsernameTaken
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := database.DB.Exec(
+		"INSERT INTO users (username, password, role) VALUES (?, ?, ?)",
+		username, string(hashedPassword), role,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
 func Login(c *fiber.Ctx) error {
 	var req LoginRequest
 	if err := c.BodyParser(&req); err != nil {
@@ -87,53 +108,165 @@ func Login(c *fiber.Ctx) error {
 		})
 	}
 
+	// Failed attempts lock the account out, whether or not it exists, so
+	// lockouts do not reveal which usernames are taken
+	lockKey := loginLockKey(req.Username)
+	if wait := middleware.LoginLockedFor(lockKey); wait > 0 {
+		return middleware.TooManyRequests(c, wait, "Too many failed sign-in attempts, try again later")
+	}
+
 	var user models.User
+	var tokenVersion int64
+	var twoFactor bool
 	err := database.DB.QueryRow(
-		"SELECT id, username, password FROM users WHERE username = ?",
+		"SELECT id, username, password, token_version, totp_enabled FROM users WHERE username = ?",
 		req.Username,
-	).Scan(&user.ID, &user.Username, &user.Password)
+	).Scan(&user.ID, &user.Username, &user.Password, &tokenVersion, &twoFactor)
 
 	if err != nil {
+		middleware.LoginFailed(lockKey)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid credentials",
 		})
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		middleware.LoginFailed(lockKey)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid credentials",
 		})
 	}
 
-	// Generate JWT
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"exp":      time.Now().Add(24 * 7 * time.Hour).Unix(),
-	})
+	// With two-factor authentication the password only earns a challenge,
+	// exchanged for a session at /auth/login/2fa
+	if twoFactor {
+		challenge, err := issueChallenge(user.ID, tokenVersion)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to generate token",
+			})
+		}
+		return c.JSON(fiber.Map{
+			"two_factor_required": true,
+			"challenge":           challenge,
+		})
+	}
 
-	tokenString, err := token.SignedString([]byte(config.AppConfig.JWTSecret))
+	middleware.LoginSucceeded(lockKey)
+	return loginResponse(c, user.ID, user.Username, tokenVersion)
+}
+
+func loginLockKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+type LoginTwoFactorRequest struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+// LoginTwoFactor completes a sign-in started by Login, given the challenge it
+// returned and a TOTP or recovery code.
+func LoginTwoFactor(c *fiber.Ctx) error {
+	var req LoginTwoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	userID, version, ok := parseChallenge(req.Challenge)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired challenge, please sign in again",
+		})
+	}
+
+	var username string
+	var tokenVersion int64
+	err := database.DB.QueryRow("SELECT username, token_version FROM users WHERE id = ?", userID).Scan(&username, &tokenVersion)
+	if err != nil || tokenVersion != version {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired challenge, please sign in again",
+		})
+	}
+
+	lockKey := loginLockKey(username)
+	if wait := middleware.LoginLockedFor(lockKey); wait > 0 {
+		return middleware.TooManyRequests(c, wait, "Too many failed sign-in attempts, try again later")
+	}
+	if !verifySecondFactor(userID, req.Code) {
+		middleware.LoginFailed(lockKey)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid code",
+		})
+	}
+
+	middleware.LoginSucceeded(lockKey)
+	return loginResponse(c, userID, username, tokenVersion)
+}
+
+func loginResponse(c *fiber.Ctx, userID int64, username string, tokenVersion int64) error {
+	session, err := newSession(database.DB, userID, username, tokenVersion, "")
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to generate token",
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"token": tokenString,
-		"user": fiber.Map{
-			"id":       user.ID,
-			"username": user.Username,
-		},
-	})
+	session["user"] = fiber.Map{
+		"id":       userID,
+		"username": username,
+	}
+	return c.JSON(session)
 }
 
-func GetMe(c *fiber.Ctx) error {
-	userID := c.Locals("user_id").(int64)
-	username := c.Locals("username").(string)
-
-	return c.JSON(fiber.Map{
-		"id":       userID,
+// issueToken signs a short-lived access token. tokenVersion must match the user's current
+// token_version for the token to be accepted, so bumping it revokes every
+// token issued before.
+func issueToken(userID int64, username string, tokenVersion int64) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":  userID,
 		"username": username,
+		"tv":       tokenVersion,
+		"exp":      time.Now().Add(time.Duration(config.AppConfig.AccessTokenMins) * time.Minute).Unix(),
 	})
+	return token.SignedString([]byte(config.AppConfig.JWTSecret))
+}
+
+// issueChallenge signs the short-lived token that stands between a correct
+// password and the second factor. Its typ claim keeps it from being accepted
+// as an access token.
+func issueChallenge(userID int64, tokenVersion int64) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"typ":     "2fa",
+		"user_id": userID,
+		"tv":      tokenVersion,
+		"exp":     time.Now().Add(5 * time.Minute).Unix(),
+	})
+	return token.SignedString([]byte(config.AppConfig.JWTSecret))
+}
+
+func parseChallenge(challenge string) (int64, int64, bool) {
+	token, err := jwt.Parse(challenge, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.AppConfig.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return 0, 0, false
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != "2fa" {
+		return 0, 0, false
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, 0, false
+	}
+	version, _ := claims["tv"].(float64)
+	return int64(userID), int64(version), true
+}
+
+func GetMe(c *fiber.Ctx) error {
+	return currentUserSummary(c, c.Locals("user_id").(int64))
 }
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"path/filepath"
+
+	"hyw-webpics/backup"
+	"hyw-webpics/config"
+	"hyw-webpics/logging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type CreateBackupRequest struct {
+	Incremental bool `json:"incremental"`
+}
+
+// CreateBackup writes a backup archive to the backup directory. An
+// incremental backup builds on the newest archive already there.
+func CreateBackup(c *fiber.Ctx) error {
+	var req CreateBackupRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	var base *backup.Manifest
+	var err error
+	if req.Incremental {
+		if base, err = backup.Latest(config.AppConfig.BackupDir); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read previous backup"})
+		}
+	}
+
+	m, err := backup.Create("", base)
+	if err == backup.ErrBusy {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		logging.Request(c, adminLog).Error("Backup failed", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Backup failed: " + err.Error()})
+	}
+
+	logging.Request(c, adminLog).Info("Backup created", "id", m.ID, "base", m.Base, "media", len(m.Media))
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"name":     backup.FileName(m.ID),
+		"id":       m.ID,
+		"base":     m.Base,
+		"media":    len(m.Media),
+		"included": m.Included(),
+		"missing":  m.Missing,
+	})
+}
+
+// GetBackups lists the archives in the backup directory.
+func GetBackups(c *fiber.Ctx) error {
+	list, err := backup.List(config.AppConfig.BackupDir)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list backups"})
+	}
+	return c.JSON(fiber.Map{"backups": list})
+}
+
+// DownloadBackup sends one archive, for copying it off the server.
+func DownloadBackup(c *fiber.Ctx) error {
+	name := c.Params("name")
+	if name != filepath.Base(name) || filepath.Ext(name) != ".gz" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Backup not found"})
+	}
+	return c.Download(filepath.Join(config.AppConfig.BackupDir, name), name)
+}
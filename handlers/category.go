@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"fmt"
+
 	"hyw-webpics/database"
 	"hyw-webpics/models"
 
@@ -20,6 +22,7 @@ func GetCategories(c *fiber.Ctx) error {
 	for rows.Next() {
 		var cat models.Category
 		if err := rows.Scan(&cat.ID, &cat.Name, &cat.Slug); err != nil {
+			logScanError(c, "categories", err)
 			continue
 		}
 		categories = append(categories, cat)
@@ -70,7 +73,7 @@ func DeleteCategory(c *fiber.Ctx) error {
 	id := c.Params("id")
 	// Check if used
 	var count int
-	database.DB.QueryRow("SELECT COUNT(*) FROM images WHERE category_id = ?", id).Scan(&count)
+	scanRow(c, "count images", database.DB.QueryRow("SELECT COUNT(*) FROM images WHERE category_id = ?", id), &count)
 	if count > 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot delete category used by images"})
 	}
@@ -81,3 +84,53 @@ func DeleteCategory(c *fiber.Ctx) error {
 	}
 	return c.JSON(fiber.Map{"message": "Category deleted"})
 }
+
+// ExportCategories returns every category as name and slug, in the format
+// ImportCategories reads.
+func ExportCategories() ([]CreateCategoryRequest, error) {
+	rows, err := database.DB.Query("SELECT name, slug FROM categories ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []CreateCategoryRequest{}
+	for rows.Next() {
+		var cat CreateCategoryRequest
+		if err := rows.Scan(&cat.Name, &cat.Slug); err != nil {
+			return nil, err
+		}
+		categories = append(categories, cat)
+	}
+	return categories, rows.Err()
+}
+
+// ImportCategories creates the given categories, renaming existing ones with
+// the same slug. It is all or nothing.
+func ImportCategories(categories []CreateCategoryRequest) (created, updated int, err error) {
+	for i, cat := range categories {
+		if cat.Name == "" || cat.Slug == "" {
+			return 0, 0, fmt.Errorf("category %d: name and slug are required", i+1)
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	for _, cat := range categories {
+		var exists int
+		scanRow(nil, "check category", tx.QueryRow("SELECT COUNT(*) FROM categories WHERE slug = ?", cat.Slug), &exists)
+		if _, err := tx.Exec("INSERT INTO categories (name, slug) VALUES (?, ?) ON CONFLICT(slug) DO UPDATE SET name = excluded.name", cat.Name, cat.Slug); err != nil {
+			return 0, 0, fmt.Errorf("category %s: %w", cat.Slug, err)
+		}
+		if exists > 0 {
+			updated++
+		} else {
+			created++
+		}
+	}
+	return created, updated, tx.Commit()
+}
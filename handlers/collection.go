@@ -0,0 +1,436 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"strings"
+	"unicode/utf8"
+
+	"hyw-webpics/database"
+	"hyw-webpics/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	maxCollectionName        = 100
+	maxCollectionDescription = 1000
+	maxCollectionsPerUser    = 100
+	maxCollectionItems       = 500
+)
+
+var collectionVisibilities = map[string]bool{"private": true, "unlisted": true, "public": true}
+
+const collectionColumns = `collections.id, collections.user_id, collections.name, collections.slug, collections.description, collections.visibility,
+	(SELECT COUNT(*) FROM collection_items ci JOIN images i ON i.id = ci.image_id WHERE ci.collection_id = collections.id AND i.status = 'approved'),
+	collections.created_at, collections.updated_at`
+
+func scanCollection(row rowScanner) (models.Collection, error) {
+	var col models.Collection
+	err := row.Scan(&col.ID, &col.UserID, &col.Name, &col.Slug, &col.Description, &col.Visibility, &col.ImageCount, &col.CreatedAt, &col.UpdatedAt)
+	return col, err
+}
+
+// newCollectionSlug derives a URL slug from the ASCII part of the name plus a
+// random suffix, so Chinese-only names still get unique, shareable slugs.
+func newCollectionSlug(name string) string {
+	var b strings.Builder
+	lastDash := true
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z' || r >= '0' && r <= '9':
+			b.WriteRune(r)
+			lastDash = false
+		case !lastDash:
+			b.WriteByte('-')
+			lastDash = true
+		}
+		if b.Len() >= 40 {
+			break
+		}
+	}
+
+	suffix := make([]byte, 5)
+	rand.Read(suffix)
+	random := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(suffix))
+
+	base := strings.Trim(b.String(), "-")
+	if base == "" {
+		return random
+	}
+	return base + "-" + random
+}
+
+type CollectionRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Visibility  *string `json:"visibility"`
+}
+
+// validate checks the provided fields; on create every required field must be set.
+func (req CollectionRequest) validate(create bool) string {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || utf8.RuneCountInString(name) > maxCollectionName {
+			return "Name must be between 1 and 100 characters"
+		}
+	} else if create {
+		return "Name is required"
+	}
+	if req.Description != nil && utf8.RuneCountInString(*req.Description) > maxCollectionDescription {
+		return "Description must be at most 1000 characters"
+	}
+	if req.Visibility != nil && !collectionVisibilities[*req.Visibility] {
+		return "Visibility must be private, unlisted or public"
+	}
+	return ""
+}
+
+func CreateCollection(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+
+	var req CollectionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if msg := req.validate(true); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	var count int
+	scanRow(c, "count collections", database.DB.QueryRow("SELECT COUNT(*) FROM collections WHERE user_id = ?", userID), &count)
+	if count >= maxCollectionsPerUser {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Collection limit reached"})
+	}
+
+	name := strings.TrimSpace(*req.Name)
+	description, visibility := "", "private"
+	if req.Description != nil {
+		description = strings.TrimSpace(*req.Description)
+	}
+	if req.Visibility != nil {
+		visibility = *req.Visibility
+	}
+
+	slug := newCollectionSlug(name)
+	result, err := database.DB.Exec(
+		"INSERT INTO collections (user_id, name, slug, description, visibility) VALUES (?, ?, ?, ?, ?)",
+		userID, name, slug, description, visibility,
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create collection"})
+	}
+
+	id, _ := result.LastInsertId()
+	col, err := scanCollection(database.DB.QueryRow("SELECT "+collectionColumns+" FROM collections WHERE id = ?", id))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load collection"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(col)
+}
+
+// loadCollection finds a collection by slug, enforcing visibility: private
+// collections are only visible to their owner. ownerOnly restricts access to
+// the owner regardless of visibility, for modifications. On failure it
+// returns the status and message to respond with.
+func loadCollection(c *fiber.Ctx, ownerOnly bool) (models.Collection, int, string) {
+	col, err := scanCollection(database.DB.QueryRow(
+		"SELECT "+collectionColumns+" FROM collections WHERE slug = ?", c.Params("slug"),
+	))
+	if err == sql.ErrNoRows {
+		return col, fiber.StatusNotFound, "Collection not found"
+	}
+	if err != nil {
+		return col, fiber.StatusInternalServerError, "Failed to load collection"
+	}
+
+	userID, signedIn := currentUserID(c)
+	if signedIn && userID == col.UserID {
+		return col, 0, ""
+	}
+	if col.Visibility == "private" {
+		return col, fiber.StatusNotFound, "Collection not found"
+	}
+	if ownerOnly {
+		return col, fiber.StatusForbidden, "Not the collection owner"
+	}
+	return col, 0, ""
+}
+
+// GetCollection returns a collection with a page of its images in order.
+func GetCollection(c *fiber.Ctx) error {
+	col, status, msg := loadCollection(c, false)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := clampLimit(c.QueryInt("limit", defaultPageLimit()))
+
+	rows, err := database.DB.Query(
+		"SELECT "+imageColumns+" FROM collection_items JOIN images ON images.id = collection_items.image_id "+
+			"WHERE collection_items.collection_id = ? AND images.status = 'approved' "+
+			"ORDER BY collection_items.position, collection_items.image_id LIMIT ? OFFSET ?",
+		col.ID, limit, (page-1)*limit,
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch images"})
+	}
+	defer rows.Close()
+
+	images := []models.Image{}
+	for rows.Next() {
+		img, err := scanImage(rows)
+		if err != nil {
+			logScanError(c, "collection images", err)
+			continue
+		}
+		images = append(images, img)
+	}
+	decorateImages(c, images)
+
+	return c.JSON(fiber.Map{
+		"collection": col,
+		"images":     images,
+		"total":      col.ImageCount,
+		"page":       page,
+		"limit":      limit,
+	})
+}
+
+// listCollections returns a page of collections matching where, most
+// recently updated first.
+func listCollections(c *fiber.Ctx, where string, args ...interface{}) error {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := clampLimit(c.QueryInt("limit", defaultPageLimit()))
+
+	var total int
+	scanRow(c, "count collections", database.DB.QueryRow("SELECT COUNT(*) FROM collections WHERE "+where, args...), &total)
+
+	rows, err := database.DB.Query(
+		"SELECT "+collectionColumns+" FROM collections WHERE "+where+" ORDER BY collections.updated_at DESC, collections.id DESC LIMIT ? OFFSET ?",
+		append(args, limit, (page-1)*limit)...,
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch collections"})
+	}
+	defer rows.Close()
+
+	collections := []models.Collection{}
+	for rows.Next() {
+		col, err := scanCollection(rows)
+		if err != nil {
+			logScanError(c, "collections", err)
+			continue
+		}
+		collections = append(collections, col)
+	}
+
+	return c.JSON(fiber.Map{
+		"collections": collections,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+	})
+}
+
+// GetPublicCollections lists collections marked public.
+func GetPublicCollections(c *fiber.Ctx) error {
+	return listCollections(c, "collections.visibility = 'public'")
+}
+
+// GetMyCollections lists the current user's collections of any visibility.
+func GetMyCollections(c *fiber.Ctx) error {
+	return listCollections(c, "collections.user_id = ?", c.Locals("user_id").(int64))
+}
+
+func UpdateCollection(c *fiber.Ctx) error {
+	col, status, msg := loadCollection(c, true)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	var req CollectionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if msg := req.validate(false); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	if req.Name != nil {
+		col.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		col.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Visibility != nil {
+		col.Visibility = *req.Visibility
+	}
+	_, err := database.DB.Exec(
+		"UPDATE collections SET name = ?, description = ?, visibility = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		col.Name, col.Description, col.Visibility, col.ID,
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update collection"})
+	}
+
+	col, err = scanCollection(database.DB.QueryRow("SELECT "+collectionColumns+" FROM collections WHERE id = ?", col.ID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load collection"})
+	}
+	return c.JSON(col)
+}
+
+func DeleteCollection(c *fiber.Ctx) error {
+	col, status, msg := loadCollection(c, true)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	if _, err := database.DB.Exec("DELETE FROM collections WHERE id = ?", col.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete collection"})
+	}
+	return c.JSON(fiber.Map{"message": "Collection deleted"})
+}
+
+type CollectionImageRequest struct {
+	ImageID int64 `json:"image_id"`
+}
+
+// AddCollectionImage appends an approved image to the end of a collection.
+func AddCollectionImage(c *fiber.Ctx) error {
+	col, status, msg := loadCollection(c, true)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	var req CollectionImageRequest
+	if err := c.BodyParser(&req); err != nil || req.ImageID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "image_id is required"})
+	}
+
+	var exists int
+	scanRow(c, "count images", database.DB.QueryRow("SELECT COUNT(*) FROM images WHERE id = ? AND status = 'approved'", req.ImageID), &exists)
+	if exists == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Image not found"})
+	}
+
+	var items int
+	scanRow(c, "count collection items", database.DB.QueryRow("SELECT COUNT(*) FROM collection_items WHERE collection_id = ?", col.ID), &items)
+	if items >= maxCollectionItems {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Collection is full"})
+	}
+
+	result, err := database.DB.Exec(`
+		INSERT OR IGNORE INTO collection_items (collection_id, image_id, position)
+		SELECT ?, ?, COALESCE(MAX(position), 0) + 1 FROM collection_items WHERE collection_id = ?`,
+		col.ID, req.ImageID, col.ID,
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add image"})
+	}
+
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		touchCollection(col.ID)
+	}
+	return c.JSON(fiber.Map{"message": "Image added to collection"})
+}
+
+func RemoveCollectionImage(c *fiber.Ctx) error {
+	col, status, msg := loadCollection(c, true)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	result, err := database.DB.Exec(
+		"DELETE FROM collection_items WHERE collection_id = ? AND image_id = ?", col.ID, c.Params("imageId"),
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove image"})
+	}
+
+	affected, _ := result.RowsAffected()
+	if affected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Image not in collection"})
+	}
+	touchCollection(col.ID)
+	return c.JSON(fiber.Map{"message": "Image removed from collection"})
+}
+
+type ReorderCollectionRequest struct {
+	ImageIDs []int64 `json:"image_ids"`
+}
+
+// ReorderCollection sets the order of a collection. image_ids must list
+// every image in the collection exactly once.
+func ReorderCollection(c *fiber.Ctx) error {
+	col, status, msg := loadCollection(c, true)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	var req ReorderCollectionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	current := make(map[int64]bool)
+	rows, err := tx.Query("SELECT image_id FROM collection_items WHERE collection_id = ?", col.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			logScanError(c, "collection items", err)
+			continue
+		}
+		current[id] = true
+	}
+	rows.Close()
+
+	seen := make(map[int64]bool)
+	for _, id := range req.ImageIDs {
+		if !current[id] || seen[id] {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "image_ids must list each image in the collection once"})
+		}
+		seen[id] = true
+	}
+	if len(seen) != len(current) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "image_ids must list each image in the collection once"})
+	}
+
+	for i, id := range req.ImageIDs {
+		if _, err := tx.Exec("UPDATE collection_items SET position = ? WHERE collection_id = ? AND image_id = ?", i+1, col.ID, id); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reorder collection"})
+		}
+	}
+	if _, err := tx.Exec("UPDATE collections SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", col.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reorder collection"})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reorder collection"})
+	}
+	return c.JSON(fiber.Map{"message": "Collection reordered"})
+}
+
+func touchCollection(id int64) {
+	if _, err := database.DB.Exec("UPDATE collections SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", id); err != nil {
+		dbLog.Warn("Failed to touch collection", "collection_id", id, "err", err)
+	}
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"database/sql"
+	"strings"
+	"unicode/utf8"
+
+	"hyw-webpics/database"
+	"hyw-webpics/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxCommentLength = 1000
+
+// commentColumns is the column list scanned by scanComment. Queries must join
+// users with LEFT JOIN so comments outlive their author's row.
+const commentColumns = "comments.id, comments.image_id, comments.user_id, COALESCE(users.username, ''), comments.parent_id, comments.body, comments.status, comments.created_at, comments.edited_at"
+
+func scanComment(row rowScanner) (models.Comment, error) {
+	var cm models.Comment
+	var parentID sql.NullInt64
+	var editedAt sql.NullTime
+	err := row.Scan(&cm.ID, &cm.ImageID, &cm.UserID, &cm.Username, &parentID, &cm.Body, &cm.Status, &cm.CreatedAt, &editedAt)
+	if parentID.Valid {
+		cm.ParentID = &parentID.Int64
+	}
+	if editedAt.Valid {
+		cm.EditedAt = &editedAt.Time
+	}
+	return cm, err
+}
+
+func queryComments(query string, args ...interface{}) ([]models.Comment, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []models.Comment{}
+	for rows.Next() {
+		if cm, err := scanComment(rows); err == nil {
+			comments = append(comments, cm)
+		}
+	}
+	return comments, rows.Err()
+}
+
+func validateCommentBody(body string) (string, string) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", "Comment cannot be empty"
+	}
+	if utf8.RuneCountInString(body) > maxCommentLength {
+		return "", "Comment must be at most 1000 characters"
+	}
+	return body, ""
+}
+
+func imageApproved(id int) bool {
+	var exists int
+	scanRow(nil, "check image", database.DB.QueryRow("SELECT COUNT(*) FROM images WHERE id = ? AND status = 'approved'", id), &exists)
+	return exists > 0
+}
+
+// GetImageComments returns a page of top-level comments on an image, newest
+// first, each with its replies in posting order. A hidden comment that still
+// has visible replies is kept as an empty placeholder so the thread reads.
+func GetImageComments(c *fiber.Ctx) error {
+	imageID, err := c.ParamsInt("id")
+	if err != nil || !imageApproved(imageID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Image not found"})
+	}
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := clampLimit(c.QueryInt("limit", defaultPageLimit()))
+
+	where := `comments.image_id = ? AND comments.parent_id IS NULL AND (comments.status = 'visible'
+		OR EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = comments.id AND r.status = 'visible'))`
+
+	var total int
+	scanRow(c, "count comments", database.DB.QueryRow("SELECT COUNT(*) FROM comments WHERE "+where, imageID), &total)
+
+	threads, err := queryComments(
+		"SELECT "+commentColumns+" FROM comments LEFT JOIN users ON users.id = comments.user_id WHERE "+where+
+			" ORDER BY comments.created_at DESC, comments.id DESC LIMIT ? OFFSET ?",
+		imageID, limit, (page-1)*limit,
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch comments"})
+	}
+
+	if len(threads) > 0 {
+		index := make(map[int64]int, len(threads))
+		ids := make([]int64, len(threads))
+		for i := range threads {
+			index[threads[i].ID] = i
+			ids[i] = threads[i].ID
+			if threads[i].Status != "visible" {
+				threads[i].Body = ""
+			}
+		}
+
+		replies, err := queryComments(
+			"SELECT "+commentColumns+" FROM comments LEFT JOIN users ON users.id = comments.user_id "+
+				"WHERE comments.status = 'visible' AND comments.parent_id IN ("+placeholders(len(ids))+") "+
+				"ORDER BY comments.created_at, comments.id",
+			idsToInterfaces(ids)...,
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch comments"})
+		}
+		for _, reply := range replies {
+			i := index[*reply.ParentID]
+			threads[i].Replies = append(threads[i].Replies, reply)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"comments": threads,
+		"total":    total,
+		"page":     page,
+		"limit":    limit,
+	})
+}
+
+type CommentRequest struct {
+	Body     string `json:"body"`
+	ParentID *int64 `json:"parent_id"`
+}
+
+// CreateComment posts a comment on an approved image. Threads are one level
+// deep, so a reply to a reply is attached to the top-level comment.
+func CreateComment(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+	imageID, err := c.ParamsInt("id")
+	if err != nil || !imageApproved(imageID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Image not found"})
+	}
+
+	var req CommentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	body, msg := validateCommentBody(req.Body)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	var parentID interface{}
+	if req.ParentID != nil {
+		var parentImage int
+		var rootID sql.NullInt64
+		var status string
+		err := database.DB.QueryRow(
+			"SELECT image_id, parent_id, status FROM comments WHERE id = ?", *req.ParentID,
+		).Scan(&parentImage, &rootID, &status)
+		if err != nil || parentImage != imageID || status != "visible" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Parent comment not found"})
+		}
+		parentID = *req.ParentID
+		if rootID.Valid {
+			parentID = rootID.Int64
+		}
+	}
+
+	result, err := database.DB.Exec(
+		"INSERT INTO comments (image_id, user_id, parent_id, body) VALUES (?, ?, ?, ?)",
+		imageID, userID, parentID, body,
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to post comment"})
+	}
+
+	id, _ := result.LastInsertId()
+	cm, err := scanComment(database.DB.QueryRow(
+		"SELECT "+commentColumns+" FROM comments LEFT JOIN users ON users.id = comments.user_id WHERE comments.id = ?", id,
+	))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load comment"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(cm)
+}
+
+// ownComment loads a comment for modification by its author. On failure it
+// returns the status and message to respond with.
+func ownComment(c *fiber.Ctx) (models.Comment, int, string) {
+	cm, err := scanComment(database.DB.QueryRow(
+		"SELECT "+commentColumns+" FROM comments LEFT JOIN users ON users.id = comments.user_id WHERE comments.id = ?", c.Params("id"),
+	))
+	if err == sql.ErrNoRows {
+		return cm, fiber.StatusNotFound, "Comment not found"
+	}
+	if err != nil {
+		return cm, fiber.StatusInternalServerError, "Database error"
+	}
+	if cm.UserID != c.Locals("user_id").(int64) {
+		return cm, fiber.StatusForbidden, "Not the comment author"
+	}
+	return cm, 0, ""
+}
+
+func UpdateComment(c *fiber.Ctx) error {
+	cm, status, msg := ownComment(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	var req CommentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	body, msg := validateCommentBody(req.Body)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	if _, err := database.DB.Exec("UPDATE comments SET body = ?, edited_at = CURRENT_TIMESTAMP WHERE id = ?", body, cm.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update comment"})
+	}
+
+	cm, err := scanComment(database.DB.QueryRow(
+		"SELECT "+commentColumns+" FROM comments LEFT JOIN users ON users.id = comments.user_id WHERE comments.id = ?", cm.ID,
+	))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load comment"})
+	}
+	return c.JSON(cm)
+}
+
+// DeleteComment removes the author's own comment along with its replies.
+func DeleteComment(c *fiber.Ctx) error {
+	cm, status, msg := ownComment(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	if _, err := database.DB.Exec("DELETE FROM comments WHERE id = ?", cm.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete comment"})
+	}
+	return c.JSON(fiber.Map{"message": "Comment deleted"})
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"database/sql"
+
+	"hyw-webpics/database"
+	"hyw-webpics/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// currentUserID returns the authenticated user, if any.
+func currentUserID(c *fiber.Ctx) (int64, bool) {
+	id, ok := c.Locals("user_id").(int64)
+	return id, ok
+}
+
+// decorateImages fills in the per-response fields of a page of images: tags,
+// uploaders and, for signed-in users, whether they have favorited each image.
+func decorateImages(c *fiber.Ctx, images []models.Image) {
+	attachTags(c, images)
+	attachUploaders(c, images)
+
+	userID, ok := currentUserID(c)
+	if !ok || len(images) == 0 {
+		return
+	}
+
+	index := make(map[int64]int, len(images))
+	ids := make([]int64, len(images))
+	for i := range images {
+		index[images[i].ID] = i
+		ids[i] = images[i].ID
+		favorited := false
+		images[i].Favorited = &favorited
+	}
+
+	rows, err := database.DB.Query(
+		"SELECT image_id FROM favorites WHERE user_id = ? AND image_id IN ("+placeholders(len(ids))+")",
+		append([]interface{}{userID}, idsToInterfaces(ids)...)...,
+	)
+	if err != nil {
+		logQueryError(c, "favorites", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var imageID int64
+		if err := rows.Scan(&imageID); err != nil {
+			logScanError(c, "favorites", err)
+			continue
+		}
+		if i, ok := index[imageID]; ok {
+			favorited := true
+			images[i].Favorited = &favorited
+		}
+	}
+}
+
+func AddFavorite(c *fiber.Ctx) error {
+	return setFavorite(c, true)
+}
+
+func RemoveFavorite(c *fiber.Ctx) error {
+	return setFavorite(c, false)
+}
+
+func setFavorite(c *fiber.Ctx, favorite bool) error {
+	userID := c.Locals("user_id").(int64)
+	imageID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid image ID"})
+	}
+
+	var status string
+	err = database.DB.QueryRow("SELECT status FROM images WHERE id = ?", imageID).Scan(&status)
+	if err == sql.ErrNoRows || (err == nil && status != "approved") {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Image not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	// The count triggers only fire when a row is actually inserted or
+	// deleted, so repeated toggles are idempotent
+	if favorite {
+		_, err = database.DB.Exec("INSERT OR IGNORE INTO favorites (user_id, image_id) VALUES (?, ?)", userID, imageID)
+	} else {
+		_, err = database.DB.Exec("DELETE FROM favorites WHERE user_id = ? AND image_id = ?", userID, imageID)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update favorite"})
+	}
+
+	var count int64
+	scanRow(c, "read favorite count", database.DB.QueryRow("SELECT favorite_count FROM images WHERE id = ?", imageID), &count)
+
+	return c.JSON(fiber.Map{
+		"image_id":       imageID,
+		"favorited":      favorite,
+		"favorite_count": count,
+	})
+}
+
+// GetMyFavorites lists the images the current user has favorited, most
+// recently favorited first by default.
+func GetMyFavorites(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+
+	req, err := parsePageRequest(c, "approved_at")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	switch req.sortName {
+	case "newest":
+		req.sort = sortMode{key: "favorites.created_at", desc: true}
+	case "oldest":
+		req.sort = sortMode{key: "favorites.created_at"}
+	}
+
+	from := "FROM favorites JOIN images ON images.id = favorites.image_id"
+	where := "favorites.user_id = ? AND images.status = 'approved'"
+	args := []interface{}{userID}
+
+	images, nextCursor, err := queryImagePage(c, req, from, where, args)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch favorites"})
+	}
+	decorateImages(c, images)
+
+	var total int
+	if !req.cursorMode {
+		scanRow(c, "count favorites", database.DB.QueryRow("SELECT COUNT(*) "+from+" WHERE "+where, args...), &total)
+	}
+
+	return c.JSON(imagePageResponse(req, images, nextCursor, total))
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"io/fs"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// notBuiltPage is served when the binary was built without the frontend.
+const notBuiltPage = `<!doctype html>
+<title>Frontend not built</title>
+<p>This server was built without the frontend. Run <code>npm run build</code> in <code>web/</code> and rebuild, or start it with <code>-server.frontend_dir web/dist</code>.</p>
+`
+
+// precompressed lists the encodings a file may have been stored in next to
+// itself, in order of preference.
+var precompressed = []struct{ encoding, ext string }{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// Frontend serves the single page app from fsys. Files under assets/ carry
+// a content hash in their name and are cached forever; index.html must be
+// revalidated so a deploy takes effect. Paths that are not files are client
+// side routes and get index.html, except ones with an extension, which are
+// missing files.
+func Frontend(fsys fs.FS) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		name := strings.TrimPrefix(path.Clean("/"+c.Params("*")), "/")
+		if stat, err := fs.Stat(fsys, name); name == "" || err != nil || stat.IsDir() {
+			if path.Ext(name) != "" {
+				return c.SendStatus(fiber.StatusNotFound)
+			}
+			name = "index.html"
+		}
+
+		switch {
+		case name == "index.html":
+			c.Set(fiber.HeaderCacheControl, "no-cache")
+		case strings.HasPrefix(name, "assets/"):
+			c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+		default:
+			c.Set(fiber.HeaderCacheControl, "public, max-age=3600")
+		}
+		c.Set(fiber.HeaderContentType, mime.TypeByExtension(path.Ext(name)))
+		c.Vary(fiber.HeaderAcceptEncoding)
+
+		for _, p := range precompressed {
+			if !acceptsEncoding(c, p.encoding) {
+				continue
+			}
+			if data, err := fs.ReadFile(fsys, name+p.ext); err == nil {
+				c.Set(fiber.HeaderContentEncoding, p.encoding)
+				return c.Send(data)
+			}
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			if name == "index.html" {
+				return c.Type("html").SendString(notBuiltPage)
+			}
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		return c.Send(data)
+	}
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header lists encoding
+// without refusing it with q=0.
+func acceptsEncoding(c *fiber.Ctx, encoding string) bool {
+	for _, part := range strings.Split(c.Get(fiber.HeaderAcceptEncoding), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
+
+// APINotFound answers unknown /api paths with JSON rather than the app.
+func APINotFound(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Not found"})
+}
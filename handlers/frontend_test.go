@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func frontendApp() *fiber.App {
+	dist := fstest.MapFS{
+		"index.html":            {Data: []byte("<!doctype html>app")},
+		"index.html.gz":         {Data: []byte("gzipped index")},
+		"favicon.ico":           {Data: []byte("icon")},
+		"assets/app-1a2b.js":    {Data: []byte("plain js")},
+		"assets/app-1a2b.js.br": {Data: []byte("brotli js")},
+		"assets/app-1a2b.js.gz": {Data: []byte("gzipped js")},
+	}
+	app := fiber.New()
+	app.Get("/api/health", func(c *fiber.Ctx) error { return c.JSON(fiber.Map{"status": "ok"}) })
+	app.All("/api/*", APINotFound)
+	app.Get("/*", Frontend(dist))
+	return app
+}
+
+func TestFrontend(t *testing.T) {
+	app := frontendApp()
+	immutable := "public, max-age=31536000, immutable"
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		status         int
+		body           string
+		cacheControl   string
+		encoding       string
+	}{
+		{"root", "/", "", 200, "<!doctype html>app", "no-cache", ""},
+		{"client route", "/images/42", "", 200, "<!doctype html>app", "no-cache", ""},
+		{"nested client route", "/u/alice/favorites", "", 200, "<!doctype html>app", "no-cache", ""},
+		{"directory", "/assets", "", 200, "<!doctype html>app", "no-cache", ""},
+		{"missing file", "/assets/gone-9z9z.js", "", 404, "", "", ""},
+		{"hashed asset", "/assets/app-1a2b.js", "", 200, "plain js", immutable, ""},
+		{"other file", "/favicon.ico", "", 200, "icon", "public, max-age=3600", ""},
+		{"brotli preferred", "/assets/app-1a2b.js", "gzip, deflate, br", 200, "brotli js", immutable, "br"},
+		{"gzip only", "/assets/app-1a2b.js", "gzip", 200, "gzipped js", immutable, "gzip"},
+		{"brotli refused", "/assets/app-1a2b.js", "br;q=0, gzip", 200, "gzipped js", immutable, "gzip"},
+		{"unknown encoding", "/assets/app-1a2b.js", "deflate", 200, "plain js", immutable, ""},
+		{"no brotli variant", "/images/42", "br, gzip", 200, "gzipped index", "no-cache", "gzip"},
+		{"path escaping the root", "/../../etc/passwd", "", 200, "<!doctype html>app", "no-cache", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set(fiber.HeaderAcceptEncoding, tt.acceptEncoding)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.status != 200 {
+				return
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.body {
+				t.Errorf("body %q, want %q", body, tt.body)
+			}
+			if got := resp.Header.Get(fiber.HeaderCacheControl); got != tt.cacheControl {
+				t.Errorf("Cache-Control %q, want %q", got, tt.cacheControl)
+			}
+			if got := resp.Header.Get(fiber.HeaderContentEncoding); got != tt.encoding {
+				t.Errorf("Content-Encoding %q, want %q", got, tt.encoding)
+			}
+			if got := resp.Header.Get(fiber.HeaderVary); got != fiber.HeaderAcceptEncoding {
+				t.Errorf("Vary %q, want Accept-Encoding", got)
+			}
+		})
+	}
+}
+
+func TestAPINotFound(t *testing.T) {
+	app := frontendApp()
+	for _, tt := range []struct{ method, path string }{
+		{http.MethodGet, "/api/nope"},
+		{http.MethodPost, "/api/images/1/nope"},
+		{http.MethodDelete, "/api/health/extra"},
+	} {
+		resp, err := app.Test(httptest.NewRequest(tt.method, tt.path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct {
+			Error string `json:"error"`
+		}
+		if resp.StatusCode != fiber.StatusNotFound || json.NewDecoder(resp.Body).Decode(&body) != nil || body.Error == "" {
+			t.Errorf("%s %s = %d with %+v, want a JSON 404", tt.method, tt.path, resp.StatusCode, body)
+		}
+	}
+	// Known API routes are unaffected
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/health", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Errorf("GET /api/health = %d, want 200", resp.StatusCode)
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+	"hyw-webpics/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// readyTimeout bounds the database ping, so a locked database fails the
+// probe instead of hanging it.
+const readyTimeout = 2 * time.Second
+
+// Healthz reports that the process is up and serving requests.
+func Healthz(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// Readyz reports whether the server can handle uploads: the database
+// answers, the upload directory is writable and the WebP encoder is
+// installed. Any failing check answers 503 with its error.
+func Readyz(c *fiber.Ctx) error {
+	checks := fiber.Map{}
+	ready := true
+	record := func(name string, err error) {
+		if err != nil {
+			checks[name] = err.Error()
+			ready = false
+			return
+		}
+		checks[name] = "ok"
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), readyTimeout)
+	defer cancel()
+	record("database", database.DB.PingContext(ctx))
+	record("uploads", checkWritable(config.AppConfig.UploadDir))
+	record("encoder", utils.CheckEncoder())
+
+	if !ready {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"status": "unavailable", "checks": checks})
+	}
+	return c.JSON(fiber.Map{"status": "ok", "checks": checks})
+}
+
+// checkWritable creates and removes a file in dir.
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".ready-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
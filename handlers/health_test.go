@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestReadyz(t *testing.T) {
+	// A stand-in cwebp, so only the checks under test fail
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "cwebp"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	tests := []struct {
+		name   string
+		fault  func(t *testing.T)
+		status int
+		failed string
+	}{
+		{"ready", func(*testing.T) {}, fiber.StatusOK, ""},
+		{"database closed", func(*testing.T) { database.Close() }, fiber.StatusServiceUnavailable, "database"},
+		{"upload dir not writable", func(t *testing.T) {
+			// Root ignores permissions, so the upload dir is a plain file
+			file := filepath.Join(t.TempDir(), "uploads")
+			if err := os.WriteFile(file, nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			config.AppConfig.UploadDir = file
+		}, fiber.StatusServiceUnavailable, "uploads"},
+		{"upload dir missing", func(t *testing.T) {
+			config.AppConfig.UploadDir = filepath.Join(t.TempDir(), "missing")
+		}, fiber.StatusServiceUnavailable, "uploads"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			if err := os.MkdirAll(config.AppConfig.UploadDir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			tt.fault(t)
+
+			app := fiber.New()
+			app.Get("/readyz", Readyz)
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var body struct {
+				Checks map[string]string `json:"checks"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("status %d, want %d (checks %v)", resp.StatusCode, tt.status, body.Checks)
+			}
+			for name, result := range body.Checks {
+				if failed := result != "ok"; failed != (name == tt.failed) {
+					t.Errorf("check %s = %q", name, result)
+				}
+			}
+		})
+	}
+}
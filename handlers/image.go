@@ -2,17 +2,47 @@ package handlers
 
 import (
 	"database/sql"
-	"math/rand"
 	"path/filepath"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"hyw-webpics/config"
 	"hyw-webpics/database"
+	"hyw-webpics/metrics"
 	"hyw-webpics/models"
 	"hyw-webpics/utils"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+const maxTitleLength = 200
+
+// allowedUploadExts are the source formats accepted for conversion to WebP.
+var allowedUploadExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+
+// imageColumns is the column list scanned by scanImage.
+const imageColumns = "images.id, images.filename, images.original_name, images.title, images.ocr_text, images.animated, images.favorite_count, images.view_count, images.share_count, images.comment_count, images.uploader_id, images.category_id, images.status, images.created_at, images.approved_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanImage scans a row selected with imageColumns, followed by any extra
+// destinations for additional selected columns.
+func scanImage(row rowScanner, extra ...interface{}) (models.Image, error) {
+	var img models.Image
+	var approvedAt sql.NullTime
+	dest := []interface{}{&img.ID, &img.Filename, &img.OriginalName, &img.Title, &img.OCRText, &img.Animated, &img.FavoriteCount, &img.ViewCount, &img.ShareCount, &img.CommentCount, &img.UploaderID, &img.CategoryID, &img.Status, &img.CreatedAt, &approvedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return img, err
+	}
+	if approvedAt.Valid {
+		img.ApprovedAt = &approvedAt.Time
+	}
+	return img, nil
+}
+
 func UploadImage(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(int64)
 
@@ -31,16 +61,50 @@ func UploadImage(c *fiber.Ctx) error {
 	}
 
 	categoryID := c.FormValue("category_id")
+	title := strings.TrimSpace(c.FormValue("title"))
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Title must be at most 200 characters",
+		})
+	}
+	tags := parseTags(c.FormValue("tags"))
+
+	quota, err := loadUploadQuota(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load upload quota",
+		})
+	}
+
+	// Trusted uploaders can publish straight into the category they chose
+	var catArg interface{}
+	autoApprove := false
+	if categoryID != "" {
+		catArg = categoryID
+		if quota.level == trustTrusted && config.AppConfig.AutoApproveTrusted {
+			var exists int
+			scanRow(c, "count categories", database.DB.QueryRow("SELECT COUNT(*) FROM categories WHERE id = ?", categoryID), &exists)
+			autoApprove = exists > 0
+		}
+	}
+
 	var uploadedImages []fiber.Map
 	var errors []string
-
-	allowedExts := map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+	overQuota := false
 
 	for _, file := range files {
 		// Validate file type
-		ext := filepath.Ext(file.Filename)
-		if !allowedExts[ext] {
+		ext := strings.ToLower(filepath.Ext(file.Filename))
+		if !allowedUploadExts[ext] {
 			errors = append(errors, file.Filename+": Only JPG, PNG, and GIF files are allowed")
+			metrics.Uploads.Inc("invalid")
+			continue
+		}
+
+		if !quota.fits(file.Size) {
+			errors = append(errors, file.Filename+": Upload quota exceeded")
+			overQuota = true
+			metrics.Uploads.Inc("over_quota")
 			continue
 		}
 
@@ -48,6 +112,7 @@ func UploadImage(c *fiber.Ctx) error {
 		src, err := file.Open()
 		if err != nil {
 			errors = append(errors, file.Filename+": Failed to read file")
+			metrics.Uploads.Inc("failed")
 			continue
 		}
 
@@ -56,36 +121,62 @@ func UploadImage(c *fiber.Ctx) error {
 		src.Close() // Close early
 		if err != nil {
 			errors = append(errors, file.Filename+": "+err.Error())
+			metrics.Uploads.Inc("conversion_failed")
 			continue
 		}
 
 		// Save to database
-		var query string
-		var args []interface{}
-		if categoryID != "" {
-			query = "INSERT INTO images (filename, original_name, uploader_id, category_id) VALUES (?, ?, ?, ?)"
-			args = []interface{}{filename, file.Filename, userID, categoryID}
-		} else {
-			query = "INSERT INTO images (filename, original_name, uploader_id) VALUES (?, ?, ?)"
-			args = []interface{}{filename, file.Filename, userID}
+		upload := newImage{
+			Filename:     filename,
+			OriginalName: file.Filename,
+			Title:        title,
+			UploaderID:   userID,
+			CategoryID:   catArg,
+			Tags:         tags,
+			Animated:     utils.IsAnimatedWebP(filepath.Join(config.AppConfig.UploadDir, filename)),
+			Bytes:        file.Size,
+			Quota:        quota.limit,
+			Approved:     autoApprove,
+		}
+		id, err := insertImage(upload)
+		if err == errQuotaExceeded {
+			removeFile(c, filepath.Join(config.AppConfig.UploadDir, filename))
+			errors = append(errors, file.Filename+": Upload quota exceeded")
+			overQuota = true
+			metrics.Uploads.Inc("over_quota")
+			continue
 		}
-
-		result, err := database.DB.Exec(query, args...)
 		if err != nil {
+			removeFile(c, filepath.Join(config.AppConfig.UploadDir, filename))
 			errors = append(errors, file.Filename+": Failed to save record")
+			metrics.Uploads.Inc("failed")
 			continue
 		}
+		quota.add(file.Size)
+		queueOCR(id, filename)
 
-		id, _ := result.LastInsertId()
+		status := "pending"
+		if autoApprove {
+			status = "approved"
+			metrics.Uploads.Inc("auto_approved")
+		} else {
+			metrics.Uploads.Inc("pending")
+		}
 		uploadedImages = append(uploadedImages, fiber.Map{
 			"id":       id,
 			"filename": filename,
 			"name":     file.Filename,
+			"title":    title,
+			"tags":     tags,
+			"animated": upload.Animated,
+			"status":   status,
 		})
 	}
 
 	status := fiber.StatusCreated
-	if len(uploadedImages) == 0 && len(errors) > 0 {
+	if len(uploadedImages) == 0 && overQuota {
+		status = fiber.StatusTooManyRequests
+	} else if len(uploadedImages) == 0 && len(errors) > 0 {
 		status = fiber.StatusInternalServerError
 	}
 
@@ -93,9 +184,78 @@ func UploadImage(c *fiber.Ctx) error {
 		"message":  "Batch upload complete",
 		"uploaded": uploadedImages,
 		"errors":   errors,
+		"quota":    quota.remaining(),
 	})
 }
 
+// newImage is an uploaded image about to be stored.
+type newImage struct {
+	Filename     string
+	OriginalName string
+	Title        string
+	UploaderID   int64
+	CategoryID   interface{}
+	Tags         []string
+	Animated     bool
+	Bytes        int64              // upload size, counted against the uploader's quota
+	Quota        config.UploadQuota // limits the upload must fit, zero for unlimited
+	Approved     bool               // publish immediately instead of queueing for review
+}
+
+// insertImage stores a new image together with its tags and records it in
+// the uploader's history. It returns errQuotaExceeded, storing nothing, if
+// the upload takes the uploader over img.Quota.
+func insertImage(img newImage) (int64, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	status, outcome := "pending", "pending"
+	var approvedAt interface{}
+	if img.Approved {
+		status, outcome = "approved", "approved"
+		approvedAt = database.Timestamp(time.Now())
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO images (filename, original_name, title, uploader_id, category_id, animated, status, approved_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		img.Filename, img.OriginalName, img.Title, img.UploaderID, img.CategoryID, img.Animated, status, approvedAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := setImageTags(tx, id, img.Tags); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(
+		"INSERT INTO upload_history (user_id, image_id, bytes, outcome) VALUES (?, ?, ?, ?)",
+		img.UploaderID, id, img.Bytes, outcome,
+	); err != nil {
+		return 0, err
+	}
+
+	// The inserts above took SQLite's write lock, so the sums include every
+	// upload committed before this one and no other can commit until it ends
+	used, err := quotaUsage(tx, img.UploaderID)
+	if err != nil {
+		return 0, err
+	}
+	if !withinQuota(used, img.Quota) {
+		return 0, errQuotaExceeded
+	}
+
+	return id, tx.Commit()
+}
+
 type BulkActionRequest struct {
 	IDs        []int64 `json:"ids"`
 	CategoryID *int64  `json:"category_id,omitempty"`
@@ -115,7 +275,7 @@ func BulkApproveImages(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Category ID is required for approval"})
 	}
 
-	return bulkExec(c, "UPDATE images SET status = 'approved', category_id = ?, approved_at = ? WHERE id IN (", req.IDs, *req.CategoryID, time.Now())
+	return bulkExec(c, "UPDATE images SET status = 'approved', category_id = ?, approved_at = ? WHERE id IN (", req.IDs, *req.CategoryID, database.Timestamp(time.Now()))
 }
 
 // Helper for bulk operations to avoid SQL injection and boilerplate
@@ -124,15 +284,7 @@ func bulkExec(c *fiber.Ctx, prefix string, ids []int64, extraArgs ...interface{}
 		return c.JSON(fiber.Map{"message": "No items to process"})
 	}
 
-	placeholders := ""
-	for i := range ids {
-		if i > 0 {
-			placeholders += ","
-		}
-		placeholders += "?"
-	}
-
-	query := prefix + placeholders + ")"
+	query := prefix + placeholders(len(ids)) + ")"
 	args := append(extraArgs, idsToInterfaces(ids)...)
 
 	_, err := database.DB.Exec(query, args...)
@@ -143,6 +295,10 @@ func bulkExec(c *fiber.Ctx, prefix string, ids []int64, extraArgs ...interface{}
 	return c.JSON(fiber.Map{"message": "Bulk operation successful", "count": len(ids)})
 }
 
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
 func idsToInterfaces(ids []int64) []interface{} {
 	ifaces := make([]interface{}, len(ids))
 	for i, v := range ids {
@@ -164,101 +320,34 @@ func BulkDeleteImages(c *fiber.Ctx) error {
 }
 
 func GetApprovedImages(c *fiber.Ctx) error {
-	page := c.QueryInt("page", 1)
-	limit := c.QueryInt("limit", 20)
-	offset := (page - 1) * limit
-
-	categoryID := c.Query("category_id")
-
-	baseQuery := "SELECT id, filename, original_name, uploader_id, category_id, status, created_at, approved_at FROM images WHERE status = 'approved'"
-	countQuery := "SELECT COUNT(*) FROM images WHERE status = 'approved'"
-	var args []interface{}
-
-	if categoryID != "" {
-		baseQuery += " AND category_id = ?"
-		countQuery += " AND category_id = ?"
-		args = append(args, categoryID)
-	}
-
-	baseQuery += " ORDER BY approved_at DESC LIMIT ? OFFSET ?"
-
-	// Append pagination args
-	queryArgs := append(args, limit, offset)
-
-	rows, err := database.DB.Query(baseQuery, queryArgs...)
+	req, err := parsePageRequest(c, "approved_at")
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch images",
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
 		})
 	}
-	defer rows.Close()
 
-	var images []models.Image
-	for rows.Next() {
-		var img models.Image
-		var approvedAt sql.NullTime
-		err := rows.Scan(&img.ID, &img.Filename, &img.OriginalName, &img.UploaderID, &img.CategoryID, &img.Status, &img.CreatedAt, &approvedAt)
-		if err != nil {
-			continue
-		}
-		if approvedAt.Valid {
-			img.ApprovedAt = &approvedAt.Time
-		}
-		images = append(images, img)
-	}
-
-	// Get total count
-	var total int
-	database.DB.QueryRow(countQuery, args...).Scan(&total)
-
-	return c.JSON(fiber.Map{
-		"images": images,
-		"total":  total,
-		"page":   page,
-		"limit":  limit,
-	})
-}
-
-func GetRandomImage(c *fiber.Ctx) error {
-	categoryID := c.Query("category_id")
-
-	countQuery := "SELECT COUNT(*) FROM images WHERE status = 'approved'"
-	baseQuery := "SELECT id, filename, original_name, uploader_id, category_id, status, created_at, approved_at FROM images WHERE status = 'approved'"
+	where := "status = 'approved'"
 	var args []interface{}
 
-	if categoryID != "" {
-		countQuery += " AND category_id = ?"
-		baseQuery += " AND category_id = ?"
+	if categoryID := c.Query("category_id"); categoryID != "" {
+		where += " AND category_id = ?"
 		args = append(args, categoryID)
 	}
 
-	var count int
-	err := database.DB.QueryRow(countQuery, args...).Scan(&count)
-	if err != nil || count == 0 {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "No approved images found",
-		})
-	}
-
-	rand.Seed(time.Now().UnixNano())
-	offset := rand.Intn(count)
-
-	baseQuery += " LIMIT 1 OFFSET ?"
-	args = append(args, offset)
-
-	var img models.Image
-	var approvedAt sql.NullTime
-	err = database.DB.QueryRow(baseQuery, args...).Scan(&img.ID, &img.Filename, &img.OriginalName, &img.UploaderID, &img.CategoryID, &img.Status, &img.CreatedAt, &approvedAt)
-
+	images, nextCursor, err := queryImagePage(c, req, "FROM images", where, args)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch random image",
+			"error": "Failed to fetch images",
 		})
 	}
+	decorateImages(c, images)
 
-	if approvedAt.Valid {
-		img.ApprovedAt = &approvedAt.Time
+	// Counting is skipped in cursor mode, which never needs a total
+	var total int
+	if !req.cursorMode {
+		scanRow(c, "count images", database.DB.QueryRow("SELECT COUNT(*) FROM images WHERE "+where, args...), &total)
 	}
 
-	return c.JSON(img)
+	return c.JSON(imagePageResponse(req, images, nextCursor, total))
 }
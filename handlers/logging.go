@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"database/sql"
+	"os"
+
+	"hyw-webpics/logging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	authLog       = logging.For("auth")
+	imagesLog     = logging.For("images")
+	adminLog      = logging.For("admin")
+	moderationLog = logging.For("moderation")
+	ocrLog        = logging.For("ocr")
+	dbLog         = logging.For("db")
+)
+
+// scanRow scans a single-row query whose failure the caller tolerates by
+// carrying on with zero values. The error is logged with the request's
+// context instead of being dropped; a missing row is expected and is not.
+func scanRow(c *fiber.Ctx, what string, row *sql.Row, dest ...interface{}) error {
+	err := row.Scan(dest...)
+	if err != nil && err != sql.ErrNoRows {
+		logging.Request(c, dbLog).Error("Failed to "+what, "err", err)
+	}
+	return err
+}
+
+// logScanError records a row skipped from a listing because it could not be
+// read.
+func logScanError(c *fiber.Ctx, what string, err error) {
+	logging.Request(c, dbLog).Error("Skipping unreadable row", "listing", what, "err", err)
+}
+
+// logQueryError records a query for extra data, such as the tags of a page
+// of images, that failed while the response goes out without it.
+func logQueryError(c *fiber.Ctx, what string, err error) {
+	logging.Request(c, dbLog).Error("Failed to load "+what, "err", err)
+}
+
+// removeFile deletes a file whose removal failing leaves only clutter, such
+// as a replaced avatar or a deleted image. The failure is logged.
+func removeFile(c *fiber.Ctx, path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		logging.Request(c, imagesLog).Warn("Failed to remove file", "path", path, "err", err)
+	}
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+	"hyw-webpics/utils"
+)
+
+// ReprocessResult summarises a ReprocessImages run.
+type ReprocessResult struct {
+	Processed int
+	Missing   []string // images whose file is gone
+	Failed    int
+}
+
+// ReprocessImages rebuilds what is derived from image files: the animated
+// flag and the variant cache, and with ocr also the extracted text. imageID 0
+// reprocesses every image.
+func ReprocessImages(imageID int64, ocr, force bool) (ReprocessResult, error) {
+	var result ReprocessResult
+
+	query := "SELECT id, filename FROM images"
+	var args []interface{}
+	if imageID != 0 {
+		query += " WHERE id = ?"
+		args = append(args, imageID)
+	}
+	rows, err := database.DB.Query(query+" ORDER BY id", args...)
+	if err != nil {
+		return result, err
+	}
+	type target struct {
+		id       int64
+		filename string
+	}
+	var targets []target
+	for rows.Next() {
+		var t target
+		if err := rows.Scan(&t.id, &t.filename); err != nil {
+			logScanError(nil, "images to reprocess", err)
+			continue
+		}
+		targets = append(targets, t)
+	}
+	rows.Close()
+
+	for _, t := range targets {
+		path := filepath.Join(config.AppConfig.UploadDir, t.filename)
+		if _, err := os.Stat(path); err != nil {
+			result.Missing = append(result.Missing, t.filename)
+			continue
+		}
+
+		utils.RemoveVariants(t.filename)
+		if _, err := database.DB.Exec("UPDATE images SET animated = ? WHERE id = ?", utils.IsAnimatedWebP(path), t.id); err != nil {
+			imagesLog.Error("Reprocess failed", "image_id", t.id, "err", err)
+			result.Failed++
+			continue
+		}
+		if ocr && utils.OCREnabled() {
+			if err := extractImageText(t.id, t.filename, force); err != nil {
+				ocrLog.Error("OCR failed", "image_id", t.id, "err", err)
+				result.Failed++
+				continue
+			}
+		}
+		result.Processed++
+	}
+	return result, nil
+}
+
+// GCResult summarises a CollectGarbage run.
+type GCResult struct {
+	OrphanFiles   []string
+	OrphanBytes   int64
+	Variants      int
+	ExpiredTokens int64
+}
+
+// CollectGarbage removes upload files no image or avatar refers to, cached
+// variants of images that are gone, and expired refresh tokens. Files newer
+// than grace are kept, since an upload's file is written before its row.
+// With dryRun nothing is removed.
+func CollectGarbage(grace time.Duration, dryRun bool) (GCResult, error) {
+	var result GCResult
+
+	referenced := make(map[string]bool)
+	rows, err := database.DB.Query("SELECT filename FROM images UNION SELECT avatar FROM users WHERE avatar != ''")
+	if err != nil {
+		return result, err
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			// An unreadable reference could make a live file look orphaned
+			rows.Close()
+			return result, err
+		}
+		referenced[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	bases := make(map[string]bool, len(referenced))
+	for name := range referenced {
+		bases[strings.TrimSuffix(name, filepath.Ext(name))] = true
+	}
+
+	cutoff := time.Now().Add(-grace)
+	remove := func(path string) {
+		if !dryRun {
+			removeFile(nil, path)
+		}
+	}
+
+	entries, err := os.ReadDir(config.AppConfig.UploadDir)
+	if err != nil {
+		return result, err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || referenced[entry.Name()] || info.ModTime().After(cutoff) {
+			continue
+		}
+		result.OrphanFiles = append(result.OrphanFiles, entry.Name())
+		result.OrphanBytes += info.Size()
+		remove(filepath.Join(config.AppConfig.UploadDir, entry.Name()))
+	}
+
+	variants, _ := filepath.Glob(filepath.Join(config.AppConfig.UploadDir, "variants", "*", "*"))
+	for _, path := range variants {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() || info.ModTime().After(cutoff) {
+			continue
+		}
+		name := filepath.Base(path)
+		if bases[strings.TrimSuffix(name, filepath.Ext(name))] && !strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		result.Variants++
+		remove(path)
+	}
+
+	if dryRun {
+		scanRow(nil, "count expired sessions", database.DB.QueryRow("SELECT COUNT(*) FROM refresh_tokens WHERE expires_at < ?", time.Now().UTC()), &result.ExpiredTokens)
+	} else {
+		res, err := database.DB.Exec("DELETE FROM refresh_tokens WHERE expires_at < ?", time.Now().UTC())
+		if err != nil {
+			return result, err
+		}
+		result.ExpiredTokens, _ = res.RowsAffected()
+	}
+
+	return result, nil
+}
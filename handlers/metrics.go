@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+	"hyw-webpics/jobs"
+	"hyw-webpics/metrics"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// storageRefresh is how long a disk usage measurement is reused, since it
+// walks the whole upload directory.
+const storageRefresh = time.Minute
+
+var registerGauges sync.Once
+
+// RegisterMetrics registers the gauges read from the database, the job
+// queue and the disk.
+func RegisterMetrics() {
+	registerGauges.Do(func() {
+		metrics.NewGaugeFunc("webpics_job_queue_depth", "Background jobs (OCR and the like) waiting for a worker.", nil,
+			func(set func(float64, ...string)) { set(float64(jobs.Depth())) })
+
+		metrics.NewGaugeFunc("webpics_images", "Images by moderation status.", []string{"status"},
+			func(set func(float64, ...string)) {
+				rows, err := database.DB.Query("SELECT status, COUNT(*) FROM images GROUP BY status")
+				if err != nil {
+					return
+				}
+				defer rows.Close()
+				for rows.Next() {
+					var status string
+					var n float64
+					if err := rows.Scan(&status, &n); err != nil {
+						logScanError(nil, "image status counts", err)
+						continue
+					}
+					set(n, status)
+				}
+			})
+
+		metrics.NewGaugeFunc("webpics_storage_bytes", "Disk space used, by kind: uploads, variants, database, backups.", []string{"kind"},
+			func(set func(float64, ...string)) {
+				for kind, n := range storageUsage() {
+					set(float64(n), kind)
+				}
+			})
+	})
+}
+
+var storage struct {
+	sync.Mutex
+	measured time.Time
+	bytes    map[string]int64
+}
+
+func storageUsage() map[string]int64 {
+	storage.Lock()
+	defer storage.Unlock()
+	if time.Since(storage.measured) < storageRefresh {
+		return storage.bytes
+	}
+
+	variants := filepath.Join(config.AppConfig.UploadDir, "variants")
+	usage := map[string]int64{
+		"uploads":  0,
+		"variants": dirSize(variants),
+		"database": 0,
+		"backups":  dirSize(config.AppConfig.BackupDir),
+	}
+	usage["uploads"] = dirSize(config.AppConfig.UploadDir) - usage["variants"]
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if stat, err := os.Stat(config.AppConfig.DatabasePath + suffix); err == nil {
+			usage["database"] += stat.Size()
+		}
+	}
+
+	storage.measured, storage.bytes = time.Now(), usage
+	return usage
+}
+
+func dirSize(dir string) int64 {
+	var total int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
+
+// GetMetrics writes every metric in the Prometheus text format.
+func GetMetrics(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, metrics.ContentType)
+	metrics.Write(c)
+	return nil
+}
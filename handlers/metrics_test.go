@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"hyw-webpics/metrics"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestGetMetrics(t *testing.T) {
+	setupTestDB(t)
+	userID, err := CreateUser("alice", "password123", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, approved := range []bool{true, true, false} {
+		if _, err := insertImage(newImage{Filename: string(rune('a'+i)) + ".webp", OriginalName: "x.png", UploaderID: userID, Approved: approved}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	RegisterMetrics()
+
+	app := fiber.New()
+	app.Get("/metrics", GetMetrics)
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Header.Get(fiber.HeaderContentType); got != metrics.ContentType {
+		t.Errorf("Content-Type %q, want %q", got, metrics.ContentType)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		`webpics_images{status="approved"} 2`,
+		`webpics_images{status="pending"} 1`,
+		"webpics_job_queue_depth 0",
+		"# TYPE webpics_storage_bytes gauge",
+	} {
+		if !strings.Contains(string(body), want+"\n") {
+			t.Errorf("metrics have no line %s", want)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"database/sql"
+	"strings"
+
+	"hyw-webpics/database"
+	"hyw-webpics/logging"
+	"hyw-webpics/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// moderatorName identifies who performed a moderation action: the username
+// of a moderator or admin account, or "admin" for the shared admin password.
+func moderatorName(c *fiber.Ctx) string {
+	if name, ok := c.Locals("moderator").(string); ok && name != "" {
+		return name
+	}
+	return "admin"
+}
+
+// systemModerator records actions taken automatically rather than by a person.
+const systemModerator = "system"
+
+// recordModeration appends an entry to the moderation audit log.
+func recordModeration(db execer, moderator, action, targetType string, targetID int64, imageID interface{}, reason, details string) error {
+	_, err := db.Exec(
+		"INSERT INTO moderation_actions (moderator, action, target_type, target_id, image_id, reason, details) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		moderator, action, targetType, targetID, imageID, reason, details,
+	)
+	return err
+}
+
+type ModerationRequest struct {
+	Reason string `json:"reason"`
+}
+
+// moderationReason reads the optional reason from the request body.
+func moderationReason(c *fiber.Ctx) string {
+	var req ModerationRequest
+	if len(c.Body()) > 0 {
+		c.BodyParser(&req)
+	}
+	return truncateRunes(strings.TrimSpace(req.Reason), 500)
+}
+
+// GetAdminComments lists comments newest first for moderation, optionally
+// filtered by status and image.
+func GetAdminComments(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := clampLimit(c.QueryInt("limit", defaultPageLimit()))
+
+	where := []string{"1 = 1"}
+	var args []interface{}
+	if status := c.Query("status"); status != "" {
+		where = append(where, "comments.status = ?")
+		args = append(args, status)
+	}
+	if imageID := c.QueryInt("image_id"); imageID > 0 {
+		where = append(where, "comments.image_id = ?")
+		args = append(args, imageID)
+	}
+	cond := strings.Join(where, " AND ")
+
+	var total int
+	scanRow(c, "count comments", database.DB.QueryRow("SELECT COUNT(*) FROM comments WHERE "+cond, args...), &total)
+
+	comments, err := queryComments(
+		"SELECT "+commentColumns+" FROM comments LEFT JOIN users ON users.id = comments.user_id WHERE "+cond+
+			" ORDER BY comments.created_at DESC, comments.id DESC LIMIT ? OFFSET ?",
+		append(args, limit, (page-1)*limit)...,
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch comments"})
+	}
+
+	return c.JSON(fiber.Map{
+		"comments": comments,
+		"total":    total,
+		"page":     page,
+		"limit":    limit,
+	})
+}
+
+func HideComment(c *fiber.Ctx) error {
+	return setCommentStatus(c, "hidden", "hide")
+}
+
+func UnhideComment(c *fiber.Ctx) error {
+	return setCommentStatus(c, "visible", "unhide")
+}
+
+func setCommentStatus(c *fiber.Ctx, status, action string) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid comment ID"})
+	}
+	reason := moderationReason(c)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	var imageID int64
+	var current string
+	err = tx.QueryRow("SELECT image_id, status FROM comments WHERE id = ?", id).Scan(&imageID, &current)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Comment not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	if current == status {
+		return c.JSON(fiber.Map{"message": "Comment already " + status})
+	}
+
+	if _, err := tx.Exec("UPDATE comments SET status = ? WHERE id = ?", status, id); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update comment"})
+	}
+	if err := recordModeration(tx, moderatorName(c), action, "comment", int64(id), imageID, reason, ""); err != nil {
+		logging.Request(c, moderationLog).Error("Failed to record moderation action", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record moderation action"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update comment"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Comment " + status})
+}
+
+// AdminDeleteComment removes any comment and its replies. The deleted text is
+// kept in the audit log.
+func AdminDeleteComment(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid comment ID"})
+	}
+	reason := moderationReason(c)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	var imageID int64
+	var body string
+	err = tx.QueryRow("SELECT image_id, body FROM comments WHERE id = ?", id).Scan(&imageID, &body)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Comment not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	if _, err := tx.Exec("DELETE FROM comments WHERE id = ?", id); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete comment"})
+	}
+	if err := recordModeration(tx, moderatorName(c), "delete", "comment", int64(id), imageID, reason, body); err != nil {
+		logging.Request(c, moderationLog).Error("Failed to record moderation action", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record moderation action"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete comment"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Comment deleted"})
+}
+
+// GetModerationLog lists moderation actions newest first, optionally
+// filtered by target type or image.
+func GetModerationLog(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := clampLimit(c.QueryInt("limit", defaultPageLimit()))
+
+	where := []string{"1 = 1"}
+	var args []interface{}
+	if targetType := c.Query("target_type"); targetType != "" {
+		where = append(where, "target_type = ?")
+		args = append(args, targetType)
+	}
+	if imageID := c.QueryInt("image_id"); imageID > 0 {
+		where = append(where, "image_id = ?")
+		args = append(args, imageID)
+	}
+	cond := strings.Join(where, " AND ")
+
+	var total int
+	scanRow(c, "count moderation actions", database.DB.QueryRow("SELECT COUNT(*) FROM moderation_actions WHERE "+cond, args...), &total)
+
+	rows, err := database.DB.Query(
+		"SELECT id, moderator, action, target_type, target_id, image_id, reason, details, created_at FROM moderation_actions WHERE "+cond+
+			" ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?",
+		append(args, limit, (page-1)*limit)...,
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch moderation log"})
+	}
+	defer rows.Close()
+
+	actions := []models.ModerationAction{}
+	for rows.Next() {
+		var a models.ModerationAction
+		if err := rows.Scan(&a.ID, &a.Moderator, &a.Action, &a.TargetType, &a.TargetID, &a.ImageID, &a.Reason, &a.Details, &a.CreatedAt); err != nil {
+			logScanError(c, "moderation log", err)
+			continue
+		}
+		actions = append(actions, a)
+	}
+
+	return c.JSON(fiber.Map{
+		"actions": actions,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+type SetUserRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// SetUserRole grants or revokes the moderator and admin roles.
+func SetUserRole(c *fiber.Ctx) error {
+	var req SetUserRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	_, err := ChangeRole(c.Params("username"), req.Role, moderatorName(c))
+	switch err {
+	case nil:
+	case errInvalidRole:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "role must be user, moderator or admin"})
+	case errUserNotFound:
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update role"})
+	}
+
+	return c.JSON(fiber.Map{"username": c.Params("username"), "role": req.Role})
+}
+
+// ChangeRole sets a user's role, recording the change in the moderation log,
+// and returns the previous role.
+func ChangeRole(username, role, moderator string) (string, error) {
+	if role != "user" && !privilegedRoles[role] {
+		return "", errInvalidRole
+	}
+
+	var userID int64
+	var previous string
+	err := database.DB.QueryRow("SELECT id, role FROM users WHERE username = ?", username).Scan(&userID, &previous)
+	if err == sql.ErrNoRows {
+		return "", errUserNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET role = ? WHERE id = ?", role, userID); err != nil {
+		return "", err
+	}
+	if err := recordModeration(tx, moderator, "set_role", "user", userID, nil, "", previous+" -> "+role); err != nil {
+		return "", err
+	}
+	return previous, tx.Commit()
+}
+
+// UserListing is one row of the user list command.
+type UserListing struct {
+	ID        int64
+	Username  string
+	Role      string
+	TwoFactor bool
+	Images    int
+	CreatedAt string
+}
+
+// ListUsers returns every account with its role and upload count.
+func ListUsers() ([]UserListing, error) {
+	rows, err := database.DB.Query(`
+		SELECT u.id, u.username, u.role, u.totp_enabled,
+			(SELECT COUNT(*) FROM images WHERE uploader_id = u.id), COALESCE(u.created_at, '')
+		FROM users u ORDER BY u.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []UserListing
+	for rows.Next() {
+		var u UserListing
+		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.TwoFactor, &u.Images, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+	"hyw-webpics/jobs"
+	"hyw-webpics/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxOCRTextLength = 5000
+
+// queueOCR schedules text extraction for a freshly processed image.
+func queueOCR(imageID int64, filename string) {
+	if !utils.OCREnabled() {
+		return
+	}
+	jobs.Enqueue("ocr:"+strconv.FormatInt(imageID, 10), func() {
+		if err := extractImageText(imageID, filename, false); err != nil {
+			ocrLog.Error("OCR failed", "image_id", imageID, "err", err)
+		}
+	})
+}
+
+// extractImageText runs OCR on an image and stores the result. Text that a
+// moderator has corrected is left alone unless force is set.
+func extractImageText(imageID int64, filename string, force bool) error {
+	text, err := utils.Extractor.ExtractText(filepath.Join(config.AppConfig.UploadDir, filename))
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE images SET ocr_text = ?, ocr_edited = 0 WHERE id = ?"
+	if !force {
+		query += " AND ocr_edited = 0"
+	}
+	_, err = database.DB.Exec(query, truncateRunes(text, maxOCRTextLength), imageID)
+	return err
+}
+
+// RerunOCR extracts text for every image in the library and returns the
+// number of images processed and failed.
+func RerunOCR(force bool) (processed, failed int) {
+	query := "SELECT id, filename FROM images"
+	if !force {
+		query += " WHERE ocr_edited = 0"
+	}
+
+	rows, err := database.DB.Query(query + " ORDER BY id")
+	if err != nil {
+		ocrLog.Error("Failed to list images for OCR", "err", err)
+		return 0, 0
+	}
+
+	type target struct {
+		id       int64
+		filename string
+	}
+	var targets []target
+	for rows.Next() {
+		var t target
+		if err := rows.Scan(&t.id, &t.filename); err != nil {
+			logScanError(nil, "images for OCR", err)
+			continue
+		}
+		targets = append(targets, t)
+	}
+	rows.Close()
+
+	for _, t := range targets {
+		if err := extractImageText(t.id, t.filename, force); err != nil {
+			ocrLog.Error("OCR failed", "image_id", t.id, "err", err)
+			failed++
+			continue
+		}
+		processed++
+	}
+	return processed, failed
+}
+
+type UpdateImageTextRequest struct {
+	Text string `json:"text"`
+}
+
+// UpdateImageText lets a moderator correct the extracted text of an image.
+func UpdateImageText(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req UpdateImageTextRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	text := strings.TrimSpace(req.Text)
+	if len([]rune(text)) > maxOCRTextLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Text must be at most 5000 characters"})
+	}
+
+	result, err := database.DB.Exec("UPDATE images SET ocr_text = ?, ocr_edited = 1 WHERE id = ?", text, id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update image text"})
+	}
+
+	affected, _ := result.RowsAffected()
+	if affected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Image not found"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Image text updated", "ocr_text": text})
+}
+
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
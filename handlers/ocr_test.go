@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"hyw-webpics/database"
+	"hyw-webpics/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// fixedExtractor reads the same text from every image.
+type fixedExtractor string
+
+func (e fixedExtractor) ExtractText(string) (string, error) { return string(e), nil }
+
+func TestUpdateImageTextSurvivesRerun(t *testing.T) {
+	setupTestDB(t)
+	saved := utils.Extractor
+	utils.Extractor = fixedExtractor("机器识别")
+	t.Cleanup(func() { utils.Extractor = saved })
+
+	userID, err := CreateUser("alice", "password123", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, name := range []string{"a.webp", "b.webp"} {
+		id, err := insertImage(newImage{Filename: name, OriginalName: "x.png", UploaderID: userID, Approved: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	corrected, untouched := ids[0], ids[1]
+
+	app := fiber.New()
+	app.Put("/images/:id/text", UpdateImageText)
+	put := func(id int64, text string) (int, string) {
+		body, _ := json.Marshal(UpdateImageTextRequest{Text: text})
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/images/%d/text", id), strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result struct {
+			OCRText string `json:"ocr_text"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result.OCRText
+	}
+	stored := func(id int64) (string, bool) {
+		var text string
+		var edited bool
+		if err := database.DB.QueryRow("SELECT ocr_text, ocr_edited FROM images WHERE id = ?", id).Scan(&text, &edited); err != nil {
+			t.Fatal(err)
+		}
+		return text, edited
+	}
+
+	if status, _ := put(999, "x"); status != fiber.StatusNotFound {
+		t.Errorf("correcting a missing image = %d, want 404", status)
+	}
+	if status, _ := put(corrected, strings.Repeat("字", maxOCRTextLength+1)); status != fiber.StatusBadRequest {
+		t.Errorf("correcting with too long a text = %d, want 400", status)
+	}
+	if status, text := put(corrected, "  人工更正  "); status != fiber.StatusOK || text != "人工更正" {
+		t.Fatalf("correcting = %d with %q, want 200 with the trimmed text", status, text)
+	}
+	if text, edited := stored(corrected); text != "人工更正" || !edited {
+		t.Fatalf("after correcting: %q, edited %v; want the correction marked edited", text, edited)
+	}
+
+	if processed, failed := RerunOCR(false); processed != 1 || failed != 0 {
+		t.Errorf("RerunOCR(false) processed %d and failed %d, want 1 and 0", processed, failed)
+	}
+	if text, edited := stored(corrected); text != "人工更正" || !edited {
+		t.Errorf("after RerunOCR(false): %q, edited %v; want the correction kept", text, edited)
+	}
+	if text, _ := stored(untouched); text != "机器识别" {
+		t.Errorf("after RerunOCR(false) the other image has %q, want the extracted text", text)
+	}
+
+	if processed, _ := RerunOCR(true); processed != 2 {
+		t.Errorf("RerunOCR(true) processed %d, want 2", processed)
+	}
+	if text, edited := stored(corrected); text != "机器识别" || edited {
+		t.Errorf("after RerunOCR(true): %q, edited %v; want the extracted text, not edited", text, edited)
+	}
+}
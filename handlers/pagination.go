@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+	"hyw-webpics/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// randomModulus is the prime used by the seeded random ordering.
+const randomModulus = 2147483647
+
+// defaultPageLimit is the page size of listings that do not ask for one.
+func defaultPageLimit() int {
+	return config.AppConfig.DefaultPageSize
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// sortMode describes an ordering of an image listing. Every mode is keyed on
+// (key, id) so it can be resumed from a cursor.
+type sortMode struct {
+	key     string
+	desc    bool
+	numeric bool
+}
+
+// imageSortModes returns the supported orderings. timeColumn is the column
+// newest/oldest are keyed on (approved_at publicly, created_at for admins).
+func imageSortModes(timeColumn string, seed int64) map[string]sortMode {
+	h := mixSeed(seed)
+	a := 1 + int64(h%(randomModulus-1))
+	b := int64((h >> 32) % randomModulus)
+	return map[string]sortMode{
+		"newest":      {key: "images." + timeColumn, desc: true},
+		"oldest":      {key: "images." + timeColumn},
+		"random":      {key: randomKeyExpr(a, b), numeric: true},
+		"most-liked":  {key: "images.favorite_count", desc: true, numeric: true},
+		"most-viewed": {key: "images.view_count", desc: true, numeric: true},
+	}
+}
+
+// randomKeyExpr squares an affine hash of the id modulo a prime, which gives
+// an ordering without the visible strides of a purely linear hash.
+func randomKeyExpr(a, b int64) string {
+	x := fmt.Sprintf("((images.id * %d + %d) %% %d)", a, b, randomModulus)
+	return fmt.Sprintf("((%s * %s) %% %d)", x, x, randomModulus)
+}
+
+// mixSeed spreads a client seed over 64 bits (splitmix64 finaliser) so that
+// nearby seeds produce unrelated orderings.
+func mixSeed(seed int64) uint64 {
+	z := uint64(seed) + 0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// listCursor is the decoded form of the opaque cursor handed to clients.
+type listCursor struct {
+	Sort string `json:"s"`
+	Seed int64  `json:"r,omitempty"`
+	Text string `json:"t,omitempty"`
+	Null bool   `json:"z,omitempty"` // the text key was NULL
+	Num  int64  `json:"n,omitempty"`
+	ID   int64  `json:"i"`
+}
+
+func encodeCursor(cur listCursor) string {
+	data, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (listCursor, error) {
+	var cur listCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cur, errInvalidCursor
+	}
+	if err := json.Unmarshal(data, &cur); err != nil || cur.ID <= 0 {
+		return cur, errInvalidCursor
+	}
+	return cur, nil
+}
+
+// pageRequest holds the pagination parameters of a listing request. Cursor
+// mode is selected by passing a cursor parameter (empty for the first page);
+// otherwise the legacy page/offset mode is used.
+type pageRequest struct {
+	limit      int
+	page       int
+	cursorMode bool
+	cursor     *listCursor
+	sortName   string
+	sort       sortMode
+	seed       int64
+}
+
+func parsePageRequest(c *fiber.Ctx, timeColumn string) (pageRequest, error) {
+	req := pageRequest{
+		limit:    clampLimit(c.QueryInt("limit", defaultPageLimit())),
+		page:     c.QueryInt("page", 1),
+		sortName: c.Query("sort", "newest"),
+	}
+	if req.page < 1 {
+		req.page = 1
+	}
+
+	if c.Context().QueryArgs().Has("cursor") {
+		req.cursorMode = true
+		if raw := c.Query("cursor"); raw != "" {
+			cur, err := decodeCursor(raw)
+			if err != nil {
+				return req, err
+			}
+			req.cursor = &cur
+			req.sortName = cur.Sort
+			req.seed = cur.Seed
+		}
+	}
+
+	if req.sortName == "random" && req.cursor == nil {
+		if seed, err := strconv.ParseInt(c.Query("seed"), 10, 64); err == nil && seed > 0 {
+			req.seed = seed
+		} else {
+			req.seed = rand.Int63n(1<<31) + 1
+		}
+	}
+
+	mode, ok := imageSortModes(timeColumn, req.seed)[req.sortName]
+	if !ok {
+		return req, fmt.Errorf("unknown sort %q", req.sortName)
+	}
+	req.sort = mode
+	return req, nil
+}
+
+func clampLimit(limit int) int {
+	if limit < 1 {
+		return defaultPageLimit()
+	}
+	if max := config.AppConfig.MaxPageSize; limit > max {
+		return max
+	}
+	return limit
+}
+
+// queryImagePage fetches one page of images matching where, returning the
+// cursor for the following page (empty when there are no more rows).
+func queryImagePage(c *fiber.Ctx, req pageRequest, from, where string, args []interface{}) ([]models.Image, string, error) {
+	keyExpr := req.sort.key
+	if !req.sort.numeric {
+		keyExpr = "CAST(" + keyExpr + " AS TEXT)"
+	}
+
+	query := "SELECT " + imageColumns + ", " + keyExpr + " " + from + " WHERE " + where
+	queryArgs := append([]interface{}{}, args...)
+
+	if req.cursor != nil {
+		op := ">"
+		if req.sort.desc {
+			op = "<"
+		}
+		key := req.sort.key
+		// Numeric keys are never NULL. Text keys (timestamps) may be, and
+		// NULLs sort before every other value, so they need their own
+		// conditions to stay in the pages instead of failing to compare.
+		switch {
+		case req.sort.numeric:
+			query += fmt.Sprintf(" AND (%s %s ? OR (%s = ? AND images.id %s ?))", key, op, key, op)
+			queryArgs = append(queryArgs, req.cursor.Num, req.cursor.Num, req.cursor.ID)
+		case req.cursor.Null && req.sort.desc:
+			query += fmt.Sprintf(" AND %s IS NULL AND images.id < ?", key)
+			queryArgs = append(queryArgs, req.cursor.ID)
+		case req.cursor.Null:
+			query += fmt.Sprintf(" AND (%s IS NOT NULL OR images.id > ?)", key)
+			queryArgs = append(queryArgs, req.cursor.ID)
+		case req.sort.desc:
+			query += fmt.Sprintf(" AND (%s < ? OR (%s = ? AND images.id < ?) OR %s IS NULL)", key, key, key)
+			queryArgs = append(queryArgs, req.cursor.Text, req.cursor.Text, req.cursor.ID)
+		default:
+			query += fmt.Sprintf(" AND (%s > ? OR (%s = ? AND images.id > ?))", key, key)
+			queryArgs = append(queryArgs, req.cursor.Text, req.cursor.Text, req.cursor.ID)
+		}
+	}
+
+	dir := "ASC"
+	if req.sort.desc {
+		dir = "DESC"
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, images.id %s LIMIT ?", req.sort.key, dir, dir)
+	queryArgs = append(queryArgs, req.limit+1)
+	if !req.cursorMode {
+		query += " OFFSET ?"
+		queryArgs = append(queryArgs, (req.page-1)*req.limit)
+	}
+
+	rows, err := database.DB.Query(query, queryArgs...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var images []models.Image
+	var last listCursor
+	for rows.Next() {
+		var keyText sql.NullString
+		var keyNum int64
+		var keyDest interface{} = &keyText
+		if req.sort.numeric {
+			keyDest = &keyNum
+		}
+
+		img, err := scanImage(rows, keyDest)
+		if err != nil {
+			logScanError(c, "images", err)
+			continue
+		}
+		if len(images) == req.limit {
+			// The extra row only tells us another page exists
+			return images, encodeCursor(last), nil
+		}
+		images = append(images, img)
+		last = listCursor{Sort: req.sortName, Seed: req.seed, Text: keyText.String, Null: !req.sort.numeric && !keyText.Valid, Num: keyNum, ID: img.ID}
+	}
+
+	return images, "", rows.Err()
+}
+
+// imagePageResponse builds the JSON body shared by image listings.
+func imagePageResponse(req pageRequest, images []models.Image, nextCursor string, total int) fiber.Map {
+	if images == nil {
+		images = []models.Image{}
+	}
+
+	resp := fiber.Map{
+		"images":      images,
+		"limit":       req.limit,
+		"sort":        req.sortName,
+		"next_cursor": nextCursor,
+	}
+	if !req.cursorMode {
+		resp["total"] = total
+		resp["page"] = req.page
+	}
+	if req.sortName == "random" {
+		resp["seed"] = req.seed
+	}
+	return resp
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+
+	"hyw-webpics/database"
+	"hyw-webpics/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, cur := range []listCursor{
+		{Sort: "newest", Text: "2026-01-02 03:04:05", ID: 7},
+		{Sort: "oldest", Null: true, ID: 3},
+		{Sort: "random", Seed: 42, Num: 123456, ID: 9},
+	} {
+		got, err := decodeCursor(encodeCursor(cur))
+		if err != nil || got != cur {
+			t.Errorf("decodeCursor(encodeCursor(%+v)) = %+v, %v", cur, got, err)
+		}
+	}
+	for _, bad := range []string{"!!", "bm90IGpzb24", encodeCursor(listCursor{Sort: "newest"})} {
+		if _, err := decodeCursor(bad); err != errInvalidCursor {
+			t.Errorf("decodeCursor(%q) = %v, want errInvalidCursor", bad, err)
+		}
+	}
+}
+
+// seedPagination stores approved images whose approval times collide,
+// including ones written by insertImage and one with no approval time, and
+// returns the stored key of each.
+func seedPagination(t *testing.T) map[int64]sql.NullString {
+	t.Helper()
+	userID, err := CreateUser("alice", "password123", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	approvals := []interface{}{
+		database.Timestamp(base),
+		database.Timestamp(base),
+		database.Timestamp(base.Add(time.Hour)),
+		database.Timestamp(base.Add(-time.Hour)),
+		database.Timestamp(base),
+		nil,
+		database.Timestamp(base.Add(2 * time.Hour)),
+	}
+	for i, at := range approvals {
+		if _, err := database.DB.Exec(
+			"INSERT INTO images (filename, original_name, uploader_id, status, approved_at) VALUES (?, ?, ?, 'approved', ?)",
+			fmt.Sprintf("seed%d.webp", i), "seed.png", userID, at,
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := insertImage(newImage{Filename: fmt.Sprintf("new%d.webp", i), OriginalName: "new.png", UploaderID: userID, Approved: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys := make(map[int64]sql.NullString)
+	rows, err := database.DB.Query("SELECT id, CAST(approved_at AS TEXT) FROM images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var key sql.NullString
+		if err := rows.Scan(&id, &key); err != nil {
+			t.Fatal(err)
+		}
+		if key.Valid {
+			if _, err := time.Parse(database.TimeLayout, key.String); err != nil {
+				t.Errorf("image %d: approved_at %q is not in TimeLayout", id, key.String)
+			}
+		}
+		keys[id] = key
+	}
+	return keys
+}
+
+func TestCursorPagesVisitEveryImageOnce(t *testing.T) {
+	setupTestDB(t)
+	keys := seedPagination(t)
+	var ids []int64
+	for id := range keys {
+		ids = append(ids, id)
+	}
+
+	app := fiber.New()
+	app.Get("/images", GetApprovedImages)
+	page := func(query url.Values) ([]models.Image, string) {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/images?"+query.Encode(), nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /images?%s = %d", query.Encode(), resp.StatusCode)
+		}
+		var body struct {
+			Images     []models.Image `json:"images"`
+			NextCursor string         `json:"next_cursor"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return body.Images, body.NextCursor
+	}
+
+	// NULL keys sort before every other value
+	byKey := func(desc bool) func(a, b int64) bool {
+		return func(a, b int64) bool {
+			ka, kb := keys[a], keys[b]
+			if ka == kb {
+				return a < b != desc
+			}
+			return (!ka.Valid || kb.Valid && ka.String < kb.String) != desc
+		}
+	}
+	tests := []struct {
+		sort string
+		less func(a, b int64) bool
+	}{
+		{"newest", byKey(true)},
+		{"oldest", byKey(false)},
+	}
+	for _, tt := range tests {
+		for _, limit := range []int{1, 2, 3, 4} {
+			want := append([]int64{}, ids...)
+			sort.Slice(want, func(i, j int) bool { return tt.less(want[i], want[j]) })
+
+			var got []int64
+			query := url.Values{"cursor": {""}, "sort": {tt.sort}, "limit": {fmt.Sprint(limit)}}
+			for pages := 0; ; pages++ {
+				if pages > len(ids) {
+					t.Fatalf("%s, limit %d: pagination did not end", tt.sort, limit)
+				}
+				images, next := page(query)
+				if len(images) > limit {
+					t.Fatalf("%s, limit %d: page of %d images", tt.sort, limit, len(images))
+				}
+				for _, img := range images {
+					got = append(got, img.ID)
+				}
+				if next == "" {
+					break
+				}
+				query = url.Values{"cursor": {next}, "limit": {fmt.Sprint(limit)}}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("%s, limit %d: pages visited %v, want %v", tt.sort, limit, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Trust levels, earned through approved uploads. New accounts get the
+// tightest quota; trusted uploaders the loosest, and optionally skip review.
+const (
+	trustNew     = "new"
+	trustMember  = "member"
+	trustTrusted = "trusted"
+)
+
+// uploaderTrust computes a user's trust level from their upload history.
+// Rejected uploads, and approved ones later removed, count against them.
+// Moderators and admins are always trusted.
+func uploaderTrust(userID int64) (string, error) {
+	var role string
+	var approved, failed int
+	err := database.DB.QueryRow(`
+		SELECT role,
+			(SELECT COUNT(*) FROM upload_history WHERE user_id = users.id AND outcome = 'approved'),
+			(SELECT COUNT(*) FROM upload_history WHERE user_id = users.id AND outcome IN ('rejected', 'removed'))
+		FROM users WHERE id = ?`, userID,
+	).Scan(&role, &approved, &failed)
+	if err != nil {
+		return "", err
+	}
+
+	cfg := config.AppConfig
+	switch {
+	case privilegedRoles[role]:
+		return trustTrusted, nil
+	case approved >= cfg.TrustTrustedAt && approved*100 >= cfg.TrustMinApproval*(approved+failed):
+		return trustTrusted, nil
+	case approved >= cfg.TrustMemberAt:
+		return trustMember, nil
+	}
+	return trustNew, nil
+}
+
+func trustQuota(level string) config.UploadQuota {
+	switch level {
+	case trustTrusted:
+		return config.AppConfig.QuotaTrusted
+	case trustMember:
+		return config.AppConfig.QuotaMember
+	}
+	return config.AppConfig.QuotaNew
+}
+
+// errQuotaExceeded is returned by insertImage when an upload does not fit
+// the uploader's quota.
+var errQuotaExceeded = errors.New("upload quota exceeded")
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// uploadQuota tracks a user's quota while a batch is being uploaded.
+type uploadQuota struct {
+	level string
+	limit config.UploadQuota
+	used  config.UploadQuota
+}
+
+// loadUploadQuota reads the user's trust level and their usage over the
+// rolling day and week.
+func loadUploadQuota(userID int64) (*uploadQuota, error) {
+	level, err := uploaderTrust(userID)
+	if err != nil {
+		return nil, err
+	}
+	used, err := quotaUsage(database.DB, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &uploadQuota{level: level, limit: trustQuota(level), used: used}, nil
+}
+
+// quotaUsage sums the user's uploads over the rolling day and week.
+func quotaUsage(db queryRower, userID int64) (config.UploadQuota, error) {
+	now := time.Now()
+	day := database.Timestamp(now.Add(-24 * time.Hour))
+	week := database.Timestamp(now.Add(-7 * 24 * time.Hour))
+
+	var used config.UploadQuota
+	err := db.QueryRow(`
+		SELECT
+			COUNT(CASE WHEN created_at >= ?1 THEN 1 END),
+			COUNT(*),
+			COALESCE(SUM(CASE WHEN created_at >= ?1 THEN bytes END), 0),
+			COALESCE(SUM(bytes), 0)
+		FROM upload_history WHERE user_id = ?3 AND created_at >= ?2`,
+		day, week, userID,
+	).Scan(&used.DailyCount, &used.WeeklyCount, &used.DailyBytes, &used.WeeklyBytes)
+	return used, err
+}
+
+// withinQuota reports whether usage stays within limit; zero limits are
+// unlimited.
+func withinQuota(used, limit config.UploadQuota) bool {
+	fits := func(used, limit int64) bool { return limit == 0 || used <= limit }
+	return fits(used.DailyCount, limit.DailyCount) && fits(used.WeeklyCount, limit.WeeklyCount) &&
+		fits(used.DailyBytes, limit.DailyBytes) && fits(used.WeeklyBytes, limit.WeeklyBytes)
+}
+
+// oneMore is usage after one more upload of size bytes.
+func oneMore(used config.UploadQuota, bytes int64) config.UploadQuota {
+	used.DailyCount++
+	used.WeeklyCount++
+	used.DailyBytes += bytes
+	used.WeeklyBytes += bytes
+	return used
+}
+
+// fits reports whether one more upload of size bytes fits the usage read so
+// far. insertImage checks again when it records the upload, as other
+// requests may have uploaded since.
+func (q *uploadQuota) fits(bytes int64) bool {
+	return withinQuota(oneMore(q.used, bytes), q.limit)
+}
+
+// add counts an upload that has been stored.
+func (q *uploadQuota) add(bytes int64) {
+	q.used = oneMore(q.used, bytes)
+}
+
+// remaining describes what is left of the quota; unlimited values are null.
+func (q *uploadQuota) remaining() fiber.Map {
+	left := func(used, limit int64) interface{} {
+		if limit == 0 {
+			return nil
+		}
+		if used > limit {
+			return int64(0)
+		}
+		return limit - used
+	}
+	return fiber.Map{
+		"trust_level":              q.level,
+		"daily_uploads_remaining":  left(q.used.DailyCount, q.limit.DailyCount),
+		"weekly_uploads_remaining": left(q.used.WeeklyCount, q.limit.WeeklyCount),
+		"daily_bytes_remaining":    left(q.used.DailyBytes, q.limit.DailyBytes),
+		"weekly_bytes_remaining":   left(q.used.WeeklyBytes, q.limit.WeeklyBytes),
+	}
+}
+
+// GetMyQuota returns the current user's trust level and remaining quota.
+func GetMyQuota(c *fiber.Ctx) error {
+	q, err := loadUploadQuota(c.Locals("user_id").(int64))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load quota"})
+	}
+	return c.JSON(q.remaining())
+}
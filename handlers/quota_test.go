@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestInsertImageEnforcesQuotaConcurrently(t *testing.T) {
+	setupTestDB(t)
+	userID, err := CreateUser("alice", "password123", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := config.UploadQuota{DailyCount: 3}
+
+	var wg sync.WaitGroup
+	results := make(chan error, 10)
+	for i := 0; i < cap(results); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := insertImage(newImage{
+				Filename:     fmt.Sprintf("%d.webp", i),
+				OriginalName: fmt.Sprintf("%d.png", i),
+				UploaderID:   userID,
+				Bytes:        100,
+				Quota:        limit,
+			})
+			results <- err
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+
+	stored, refused := 0, 0
+	for err := range results {
+		switch err {
+		case nil:
+			stored++
+		case errQuotaExceeded:
+			refused++
+		default:
+			t.Errorf("insertImage: %v", err)
+		}
+	}
+	if stored != 3 || refused != 7 {
+		t.Errorf("stored %d and refused %d uploads, want 3 and 7", stored, refused)
+	}
+	var images int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM images").Scan(&images); err != nil {
+		t.Fatal(err)
+	}
+	if images != 3 {
+		t.Errorf("%d images stored, want 3", images)
+	}
+}
+
+func TestUploadImageChargesOnlyStoredUploads(t *testing.T) {
+	setupTestDB(t)
+	// No encoder can be found, so every conversion fails
+	t.Setenv("PATH", t.TempDir())
+	config.AppConfig.QuotaNew = config.UploadQuota{DailyCount: 5}
+	userID, err := CreateUser("alice", "password123", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Post("/upload", func(c *fiber.Ctx) error {
+		c.Locals("user_id", userID)
+		return UploadImage(c)
+	})
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("images", "CAT.PNG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("not really a png"))
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result struct {
+		Errors []string `json:"errors"`
+		Quota  struct {
+			DailyUploadsRemaining int64 `json:"daily_uploads_remaining"`
+		} `json:"quota"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) != 1 || strings.Contains(result.Errors[0], "Only JPG") {
+		t.Fatalf("errors = %q, want one conversion error for an accepted extension", result.Errors)
+	}
+	if result.Quota.DailyUploadsRemaining != 5 {
+		t.Errorf("daily uploads remaining = %d after a failed conversion, want 5", result.Quota.DailyUploadsRemaining)
+	}
+	var history int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM upload_history WHERE user_id = ?", userID).Scan(&history); err != nil {
+		t.Fatal(err)
+	}
+	if history != 0 {
+		t.Errorf("%d uploads recorded after a failed conversion, want 0", history)
+	}
+}
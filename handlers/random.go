@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math/rand"
+	"strconv"
+
+	"hyw-webpics/database"
+	"hyw-webpics/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	maxRandomCount = 20
+	// randomKeyRange matches the range of random_key assigned by the database.
+	randomKeyRange = 2147483646
+)
+
+// randomSession tracks a walk around the random_key ring. Every image has a
+// fixed random key, so walking the ring once from a random start visits the
+// whole pool exactly once; each step is an index seek.
+type randomSession struct {
+	Start   int64 `json:"s"`
+	Key     int64 `json:"k"`
+	ID      int64 `json:"i"`
+	Wrapped bool  `json:"w,omitempty"`
+}
+
+func newRandomSession(start int64) randomSession {
+	return randomSession{Start: start, Key: start}
+}
+
+func encodeRandomSession(sess randomSession) string {
+	data, _ := json.Marshal(sess)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeRandomSession(s string) (randomSession, bool) {
+	var sess randomSession
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(data, &sess) != nil {
+		return sess, false
+	}
+	return sess, true
+}
+
+// randomFilters builds the WHERE clause for the random endpoints from the
+// category_id, tag and animated query parameters.
+func randomFilters(c *fiber.Ctx) (string, []interface{}, error) {
+	where := "images.status = 'approved'"
+	var args []interface{}
+
+	if categoryID := c.Query("category_id"); categoryID != "" {
+		where += " AND images.category_id = ?"
+		args = append(args, categoryID)
+	}
+
+	if tag := c.Query("tag"); tag != "" {
+		where += " AND images.id IN (SELECT it.image_id FROM image_tags it JOIN tags t ON t.id = it.tag_id WHERE t.name = ?)"
+		args = append(args, parseTagName(tag))
+	}
+
+	if animated := c.Query("animated"); animated != "" {
+		value, err := strconv.ParseBool(animated)
+		if err != nil {
+			return "", nil, fiber.NewError(fiber.StatusBadRequest, "animated must be true or false")
+		}
+		where += " AND images.animated = ?"
+		args = append(args, value)
+	}
+
+	return where, args, nil
+}
+
+// pickRandomImages returns up to n distinct images by continuing the session
+// walk. When the ring is exhausted a new cycle starts at a fresh random point.
+func pickRandomImages(c *fiber.Ctx, where string, args []interface{}, sess randomSession, n int) ([]models.Image, randomSession, error) {
+	var images []models.Image
+	seen := make(map[int64]bool)
+	restarted := false
+
+	for len(images) < n {
+		query := "SELECT " + imageColumns + ", images.random_key FROM images WHERE " + where +
+			" AND (images.random_key > ? OR (images.random_key = ? AND images.id > ?))"
+		queryArgs := append(append([]interface{}{}, args...), sess.Key, sess.Key, sess.ID)
+		if sess.Wrapped {
+			query += " AND images.random_key < ?"
+			queryArgs = append(queryArgs, sess.Start)
+		}
+		requested := n - len(images)
+		query += " ORDER BY images.random_key, images.id LIMIT ?"
+		queryArgs = append(queryArgs, requested)
+
+		rows, err := database.DB.Query(query, queryArgs...)
+		if err != nil {
+			return nil, sess, err
+		}
+
+		found := 0
+		for rows.Next() {
+			var key int64
+			img, err := scanImage(rows, &key)
+			if err != nil {
+				logScanError(c, "random images", err)
+				continue
+			}
+			found++
+			sess.Key, sess.ID = key, img.ID
+			if seen[img.ID] {
+				continue
+			}
+			seen[img.ID] = true
+			images = append(images, img)
+		}
+		rows.Close()
+
+		if found == requested {
+			continue
+		}
+
+		if !sess.Wrapped {
+			// Continue from the bottom of the ring up to the start point
+			sess.Wrapped = true
+			sess.Key, sess.ID = -1, 0
+			continue
+		}
+
+		// The whole pool has been visited; begin a new cycle
+		if restarted {
+			break
+		}
+		restarted = true
+		sess = newRandomSession(rand.Int63n(randomKeyRange) + 1)
+	}
+
+	return images, sess, nil
+}
+
+// GetRandomImage returns random approved images. Passing the session token
+// from a previous response continues a walk that does not repeat an image
+// until the whole pool has been seen. seed starts a reproducible walk.
+// redirect=1 sends the client to the image file instead of returning JSON.
+func GetRandomImage(c *fiber.Ctx) error {
+	if c.QueryBool("redirect") {
+		return GetRandomImageFile(c)
+	}
+
+	where, args, err := randomFilters(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	count := c.QueryInt("count", 1)
+	if count < 1 || count > maxRandomCount {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "count must be between 1 and 20",
+		})
+	}
+
+	sess, ok := decodeRandomSession(c.Query("session"))
+	if !ok || c.Query("session") == "" {
+		start := rand.Int63n(randomKeyRange) + 1
+		if seed, err := strconv.ParseInt(c.Query("seed"), 10, 64); err == nil {
+			start = int64(mixSeed(seed)%randomKeyRange) + 1
+		}
+		sess = newRandomSession(start)
+	}
+
+	images, sess, err := pickRandomImages(c, where, args, sess, count)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch random image",
+		})
+	}
+	if len(images) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No approved images found",
+		})
+	}
+	decorateImages(c, images)
+
+	token := encodeRandomSession(sess)
+	c.Set("X-Random-Session", token)
+
+	// Plain calls keep returning a bare image for existing clients
+	if c.Query("count") == "" && c.Query("session") == "" && c.Query("seed") == "" {
+		return c.JSON(images[0])
+	}
+
+	return c.JSON(fiber.Map{
+		"images":  images,
+		"session": token,
+	})
+}
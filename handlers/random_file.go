@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"math/rand"
+	"path"
+	"strings"
+
+	"hyw-webpics/stats"
+	"hyw-webpics/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetRandomImageFile responds with a random image itself rather than JSON,
+// for embedding in chat bots, signatures and overlays. The file is streamed
+// unless redirect=1, in which case the client is sent to its static URL.
+// Accepts the same filters as GetRandomImage plus size (width); the format
+// is the extension of the route, /random.webp or /random.png.
+func GetRandomImageFile(c *fiber.Ctx) error {
+	format := strings.TrimPrefix(path.Ext(c.Route().Path), ".")
+	// Links from before the .png route asked for PNG with format=png
+	if asked := c.Query("format"); asked != "" && asked != format {
+		if _, ok := utils.VariantFormats[asked]; !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "format must be webp or png",
+			})
+		}
+		query := c.Request().URI().QueryArgs()
+		query.Del("format")
+		target := "/random." + asked
+		if rest := string(query.QueryString()); rest != "" {
+			target += "?" + rest
+		}
+		return c.Redirect(target, fiber.StatusMovedPermanently)
+	}
+	contentType := utils.VariantFormats[format]
+
+	where, args, err := randomFilters(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	width := c.QueryInt("size", 0)
+	if width != 0 && !validVariantWidth(width) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "size must be one of 128, 256, 512 or 1024",
+		})
+	}
+
+	images, _, err := pickRandomImages(c, where, args, newRandomSession(rand.Int63n(randomKeyRange)+1), 1)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch random image",
+		})
+	}
+	if len(images) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No approved images found",
+		})
+	}
+	img := images[0]
+	stats.RecordView(img.ID, clientKey(c))
+
+	// Animated images are served as-is; the resize tools only handle stills
+	if img.Animated {
+		width, format, contentType = 0, "webp", utils.VariantFormats["webp"]
+	}
+
+	path, url, err := utils.ImageVariant(img.Filename, width, format)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to prepare image",
+		})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	if c.QueryBool("redirect") {
+		return c.Redirect(url, fiber.StatusFound)
+	}
+
+	if err := c.SendFile(path); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return nil
+}
+
+func validVariantWidth(width int) bool {
+	for _, w := range utils.VariantWidths {
+		if w == width {
+			return true
+		}
+	}
+	return false
+}
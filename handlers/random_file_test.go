@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestGetRandomImageFileFormat(t *testing.T) {
+	setupTestDB(t)
+	// A stand-in dwebp that writes its name to the -o file
+	bin := t.TempDir()
+	script := "#!/bin/sh\nwhile [ \"$1\" != -o ]; do shift; done\necho dwebp > \"$2\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "dwebp"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	app := fiber.New()
+	app.Get("/random.webp", GetRandomImageFile)
+	app.Get("/random.png", GetRandomImageFile)
+	get := func(path string) *http.Response {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	tests := []struct {
+		path     string
+		status   int
+		location string
+	}{
+		// The extension decides the format; format only redirects old links
+		{"/random.webp?format=png&size=256&tag=cat", fiber.StatusMovedPermanently, "/random.png?size=256&tag=cat"},
+		{"/random.webp?format=png", fiber.StatusMovedPermanently, "/random.png"},
+		{"/random.png?format=webp", fiber.StatusMovedPermanently, "/random.webp"},
+		{"/random.webp?format=gif", fiber.StatusBadRequest, ""},
+		{"/random.webp?format=webp", fiber.StatusNotFound, ""},
+		{"/random.png", fiber.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		resp := get(tt.path)
+		if resp.StatusCode != tt.status {
+			t.Errorf("GET %s = %d, want %d", tt.path, resp.StatusCode, tt.status)
+		}
+		if got := resp.Header.Get(fiber.HeaderLocation); got != tt.location {
+			t.Errorf("GET %s redirects to %q, want %q", tt.path, got, tt.location)
+		}
+	}
+
+	userID, err := CreateUser("alice", "password123", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := insertImage(newImage{Filename: "cat.webp", OriginalName: "cat.png", UploaderID: userID, Approved: true}); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{
+		"/random.webp?redirect=1": "/uploads/cat.webp",
+		"/random.png?redirect=1":  "/uploads/variants/full/cat.png",
+	} {
+		resp := get(path)
+		if got := resp.Header.Get(fiber.HeaderLocation); resp.StatusCode != fiber.StatusFound || got != want {
+			t.Errorf("GET %s = %d to %q, want 302 to %q", path, resp.StatusCode, got, want)
+		}
+	}
+}
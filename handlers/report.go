@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+	"hyw-webpics/logging"
+	"hyw-webpics/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var reportReasons = map[string]bool{
+	"spam":      true,
+	"nsfw":      true,
+	"offensive": true,
+	"copyright": true,
+	"other":     true,
+}
+
+const maxReportDetails = 500
+
+type ReportRequest struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details"`
+}
+
+// ReportImage files a report against an approved image. Each client has at
+// most one open report per image; once an image collects enough open
+// reports from signed-in users it is taken out of circulation until a
+// moderator reviews it. Anonymous reports only go to the report queue, since
+// anyone with a few addresses could otherwise pull any image.
+func ReportImage(c *fiber.Ctx) error {
+	imageID, err := c.ParamsInt("id")
+	if err != nil || !imageApproved(imageID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Image not found"})
+	}
+
+	var req ReportRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if !reportReasons[req.Reason] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "reason must be spam, nsfw, offensive, copyright or other",
+		})
+	}
+	details := truncateRunes(strings.TrimSpace(req.Details), maxReportDetails)
+
+	var userID interface{}
+	if id, ok := currentUserID(c); ok {
+		userID = id
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"INSERT OR IGNORE INTO reports (image_id, user_id, reporter, reason, details) VALUES (?, ?, ?, ?, ?)",
+		imageID, userID, clientKey(c), req.Reason, details,
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to file report"})
+	}
+
+	var open int
+	scanRow(c, "count reports", tx.QueryRow("SELECT COUNT(*) FROM reports WHERE image_id = ? AND status = 'open' AND user_id IS NOT NULL", imageID), &open)
+
+	threshold := config.AppConfig.ReportThreshold
+	if userID != nil && threshold > 0 && open >= threshold {
+		result, err := tx.Exec("UPDATE images SET status = 'review' WHERE id = ? AND status = 'approved'", imageID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to file report"})
+		}
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			details := fmt.Sprintf("%d open reports from users", open)
+			if err := recordModeration(tx, systemModerator, "auto_review", "image", int64(imageID), imageID, "report threshold reached", details); err != nil {
+				logging.Request(c, moderationLog).Error("Failed to record moderation action", "err", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to file report"})
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to file report"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Report received"})
+}
+
+type ReportedImage struct {
+	models.Image
+	ReportCount    int            `json:"report_count"`
+	Reasons        map[string]int `json:"reasons"`
+	LastReportedAt time.Time      `json:"last_reported_at"`
+}
+
+// GetReportQueue lists images with open reports, most reported first.
+func GetReportQueue(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := clampLimit(c.QueryInt("limit", defaultPageLimit()))
+
+	var total int
+	scanRow(c, "count reports", database.DB.QueryRow("SELECT COUNT(DISTINCT image_id) FROM reports WHERE status = 'open'"), &total)
+
+	rows, err := database.DB.Query(`
+		SELECT `+imageColumns+`, r.cnt, r.last_at
+		FROM (
+			SELECT image_id, COUNT(*) AS cnt, MAX(created_at) AS last_at
+			FROM reports WHERE status = 'open' GROUP BY image_id
+		) r
+		JOIN images ON images.id = r.image_id
+		ORDER BY r.cnt DESC, r.last_at DESC, images.id DESC
+		LIMIT ? OFFSET ?`,
+		limit, (page-1)*limit,
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch reports"})
+	}
+	defer rows.Close()
+
+	var images []models.Image
+	counts := make(map[int64]int)
+	lastAt := make(map[int64]time.Time)
+	for rows.Next() {
+		var count int
+		var last string
+		img, err := scanImage(rows, &count, &last)
+		if err != nil {
+			logScanError(c, "report queue", err)
+			continue
+		}
+		images = append(images, img)
+		counts[img.ID] = count
+		lastAt[img.ID] = parseDBTime(last)
+	}
+	attachTags(c, images)
+	attachUploaders(c, images)
+
+	reasons := make(map[int64]map[string]int, len(images))
+	if len(images) > 0 {
+		ids := make([]int64, len(images))
+		for i := range images {
+			ids[i] = images[i].ID
+			reasons[images[i].ID] = make(map[string]int)
+		}
+		reasonRows, err := database.DB.Query(
+			"SELECT image_id, reason, COUNT(*) FROM reports WHERE status = 'open' AND image_id IN ("+placeholders(len(ids))+") GROUP BY image_id, reason",
+			idsToInterfaces(ids)...,
+		)
+		if err != nil {
+			logQueryError(c, "report reasons", err)
+		} else {
+			defer reasonRows.Close()
+			for reasonRows.Next() {
+				var id int64
+				var reason string
+				var count int
+				if err := reasonRows.Scan(&id, &reason, &count); err != nil {
+					logScanError(c, "report reasons", err)
+					continue
+				}
+				reasons[id][reason] = count
+			}
+		}
+	}
+
+	queue := []ReportedImage{}
+	for _, img := range images {
+		queue = append(queue, ReportedImage{
+			Image:          img,
+			ReportCount:    counts[img.ID],
+			Reasons:        reasons[img.ID],
+			LastReportedAt: lastAt[img.ID],
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"images": queue,
+		"total":  total,
+		"page":   page,
+		"limit":  limit,
+	})
+}
+
+// GetImageReports lists the individual reports filed against an image.
+func GetImageReports(c *fiber.Ctx) error {
+	imageID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid image ID"})
+	}
+
+	where := "image_id = ?"
+	args := []interface{}{imageID}
+	if status := c.Query("status", "open"); status != "all" {
+		where += " AND status = ?"
+		args = append(args, status)
+	}
+
+	rows, err := database.DB.Query(
+		"SELECT id, image_id, user_id, reason, details, status, resolution, created_at, resolved_at FROM reports WHERE "+where+" ORDER BY created_at DESC, id DESC",
+		args...,
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch reports"})
+	}
+	defer rows.Close()
+
+	reports := []models.Report{}
+	for rows.Next() {
+		var r models.Report
+		var resolvedAt sql.NullTime
+		if err := rows.Scan(&r.ID, &r.ImageID, &r.UserID, &r.Reason, &r.Details, &r.Status, &r.Resolution, &r.CreatedAt, &resolvedAt); err != nil {
+			logScanError(c, "image reports", err)
+			continue
+		}
+		if resolvedAt.Valid {
+			r.ResolvedAt = &resolvedAt.Time
+		}
+		reports = append(reports, r)
+	}
+
+	return c.JSON(fiber.Map{"reports": reports})
+}
+
+type ResolveReportsRequest struct {
+	Action string `json:"action"` // "dismiss" or "remove"
+	Reason string `json:"reason"`
+}
+
+// ResolveImageReports closes all open reports on an image. Dismissing puts
+// an image under review back into circulation; removing deletes the image.
+// Either way the decision and a summary of the reports are audited.
+func ResolveImageReports(c *fiber.Ctx) error {
+	imageID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid image ID"})
+	}
+
+	var req ResolveReportsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Action != "dismiss" && req.Action != "remove" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "action must be dismiss or remove"})
+	}
+	reason := truncateRunes(strings.TrimSpace(req.Reason), 500)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	var filename, status string
+	err = tx.QueryRow("SELECT filename, status FROM images WHERE id = ?", imageID).Scan(&filename, &status)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Image not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	summary, err := reportSummary(tx, imageID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	if summary == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "No open reports for this image"})
+	}
+
+	if req.Action == "dismiss" {
+		_, err = tx.Exec(
+			"UPDATE reports SET status = 'resolved', resolution = 'dismissed', resolved_at = CURRENT_TIMESTAMP WHERE image_id = ? AND status = 'open'",
+			imageID,
+		)
+		if err == nil && status == "review" {
+			_, err = tx.Exec("UPDATE images SET status = 'approved' WHERE id = ?", imageID)
+		}
+	} else {
+		// The reports go with the image; the audit entry keeps their summary
+		_, err = tx.Exec("DELETE FROM images WHERE id = ?", imageID)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to resolve reports"})
+	}
+
+	if err := recordModeration(tx, moderatorName(c), req.Action+"_reports", "image", int64(imageID), imageID, reason, summary); err != nil {
+		logging.Request(c, moderationLog).Error("Failed to record moderation action", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record moderation action"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to resolve reports"})
+	}
+
+	if req.Action == "remove" {
+		removeImageFiles(filename)
+		return c.JSON(fiber.Map{"message": "Image removed"})
+	}
+	return c.JSON(fiber.Map{"message": "Reports dismissed"})
+}
+
+// reportSummary describes the open reports on an image, e.g.
+// "3 reports: nsfw=2, spam=1", or "" when there are none.
+func reportSummary(tx *sql.Tx, imageID int) (string, error) {
+	rows, err := tx.Query("SELECT reason, COUNT(*) FROM reports WHERE image_id = ? AND status = 'open' GROUP BY reason", imageID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var parts []string
+	total := 0
+	for rows.Next() {
+		var reason string
+		var count int
+		if err := rows.Scan(&reason, &count); err != nil {
+			return "", err
+		}
+		parts = append(parts, fmt.Sprintf("%s=%d", reason, count))
+		total += count
+	}
+	if total == 0 {
+		return "", rows.Err()
+	}
+	sort.Strings(parts)
+	return fmt.Sprintf("%d reports: %s", total, strings.Join(parts, ", ")), rows.Err()
+}
+
+// parseDBTime parses a timestamp that SQLite returned as text, as happens
+// for aggregates that lose the column's declared type.
+func parseDBTime(s string) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339Nano} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"hyw-webpics/database"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestReportThreshold(t *testing.T) {
+	setupTestDB(t)
+	uploader, err := CreateUser("uploader", "password123", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	imageID, err := insertImage(newImage{Filename: "a.webp", OriginalName: "a.png", UploaderID: uploader, Approved: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reporters are told apart by X-Forwarded-For, and signed in by X-User
+	app := fiber.New(fiber.Config{ProxyHeader: fiber.HeaderXForwardedFor})
+	app.Post("/images/:id/report", func(c *fiber.Ctx) error {
+		if id, err := strconv.ParseInt(c.Get("X-User"), 10, 64); err == nil {
+			c.Locals("user_id", id)
+		}
+		return ReportImage(c)
+	})
+	app.Post("/reports/images/:id/resolve", ResolveImageReports)
+	post := func(path, body string, header ...string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("POST %s = %d", path, resp.StatusCode)
+		}
+	}
+	status := func() string {
+		var s string
+		if err := database.DB.QueryRow("SELECT status FROM images WHERE id = ?", imageID).Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	reportPath := fmt.Sprintf("/images/%d/report", imageID)
+	report := `{"reason": "spam"}`
+
+	// Anonymous reports reach the queue but never pull the image
+	for i := 1; i <= 5; i++ {
+		post(reportPath, report, "X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i))
+	}
+	if got := status(); got != "approved" {
+		t.Fatalf("status after 5 anonymous reports = %q, want approved", got)
+	}
+	var queued int
+	database.DB.QueryRow("SELECT COUNT(*) FROM reports WHERE image_id = ? AND status = 'open'", imageID).Scan(&queued)
+	if queued != 5 {
+		t.Errorf("%d anonymous reports queued, want 5", queued)
+	}
+
+	var reporters []int64
+	for i := 1; i <= 3; i++ {
+		id, err := CreateUser(fmt.Sprintf("reporter%d", i), "password123", "user")
+		if err != nil {
+			t.Fatal(err)
+		}
+		reporters = append(reporters, id)
+	}
+	// A second report from the same user is ignored
+	post(reportPath, report, "X-User", strconv.FormatInt(reporters[0], 10))
+	for i, id := range reporters {
+		post(reportPath, report, "X-User", strconv.FormatInt(id, 10))
+		want := "approved"
+		if i+1 >= 3 {
+			want = "review"
+		}
+		if got := status(); got != want {
+			t.Errorf("status after %d user reports = %q, want %q", i+1, got, want)
+		}
+	}
+	var audited int
+	database.DB.QueryRow("SELECT COUNT(*) FROM moderation_actions WHERE action = 'auto_review' AND image_id = ?", imageID).Scan(&audited)
+	if audited != 1 {
+		t.Errorf("%d auto_review entries, want 1", audited)
+	}
+
+	post(fmt.Sprintf("/reports/images/%d/resolve", imageID), `{"action": "dismiss"}`)
+	if got := status(); got != "approved" {
+		t.Errorf("status after dismissing = %q, want approved", got)
+	}
+	var open int
+	database.DB.QueryRow("SELECT COUNT(*) FROM reports WHERE image_id = ? AND status = 'open'", imageID).Scan(&open)
+	if open != 0 {
+		t.Errorf("%d reports still open after dismissing", open)
+	}
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"html"
+	"strings"
+	"unicode/utf8"
+
+	"hyw-webpics/database"
+	"hyw-webpics/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// The trigram tokenizer can only MATCH terms of at least three characters.
+	// Shorter terms (most two-character Chinese words) fall back to LIKE.
+	minMatchTermLength = 3
+	maxSearchTerms     = 8
+
+	snippetOpen  = "\x02"
+	snippetClose = "\x03"
+)
+
+type SearchResult struct {
+	models.Image
+	Snippet string `json:"snippet"`
+}
+
+// SearchImages runs a full-text search over approved images. Terms are
+// ANDed together; each must appear in the title, filename, tags or OCR text.
+func SearchImages(c *fiber.Ctx) error {
+	terms := strings.Fields(c.Query("q"))
+	if len(terms) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Query parameter q is required",
+		})
+	}
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := clampLimit(c.QueryInt("limit", defaultPageLimit()))
+	offset := (page - 1) * limit
+
+	var matchTerms, shortTerms []string
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) >= minMatchTermLength {
+			matchTerms = append(matchTerms, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+		} else {
+			shortTerms = append(shortTerms, term)
+		}
+	}
+
+	where := "images.status = 'approved'"
+	var args []interface{}
+
+	if len(matchTerms) > 0 {
+		where += " AND images_fts MATCH ?"
+		args = append(args, strings.Join(matchTerms, " AND "))
+	}
+	for _, term := range shortTerms {
+		pattern := "%" + escapeLike(term) + "%"
+		where += " AND (images_fts.title LIKE ? ESCAPE '\\' OR images_fts.original_name LIKE ? ESCAPE '\\' OR images_fts.tags LIKE ? ESCAPE '\\' OR images_fts.ocr_text LIKE ? ESCAPE '\\')"
+		args = append(args, pattern, pattern, pattern, pattern)
+	}
+
+	if categoryID := c.Query("category_id"); categoryID != "" {
+		where += " AND images.category_id = ?"
+		args = append(args, categoryID)
+	}
+
+	from := " FROM images_fts JOIN images ON images.id = images_fts.rowid WHERE " + where
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*)"+from, args...).Scan(&total); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Search failed",
+		})
+	}
+
+	// Columns are weighted title > tags > OCR text > original filename
+	snippetExpr := "snippet(images_fts, -1, '" + snippetOpen + "', '" + snippetClose + "', '…', 12)"
+	order := " ORDER BY bm25(images_fts, 10.0, 2.0, 5.0, 3.0), images.id DESC"
+	if len(matchTerms) == 0 {
+		snippetExpr = "''"
+		order = " ORDER BY images.approved_at DESC, images.id DESC"
+	}
+
+	query := "SELECT " + imageColumns + ", " + snippetExpr + from + order + " LIMIT ? OFFSET ?"
+	rows, err := database.DB.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Search failed",
+		})
+	}
+	defer rows.Close()
+
+	var images []models.Image
+	var snippets []string
+	for rows.Next() {
+		var snippet string
+		img, err := scanImage(rows, &snippet)
+		if err != nil {
+			logScanError(c, "search results", err)
+			continue
+		}
+		images = append(images, img)
+		snippets = append(snippets, snippet)
+	}
+	decorateImages(c, images)
+
+	results := make([]SearchResult, len(images))
+	for i, img := range images {
+		snippet := snippets[i]
+		if snippet == "" {
+			snippet = shortTermSnippet(img, shortTerms)
+		}
+		results[i] = SearchResult{Image: img, Snippet: renderSnippet(snippet, shortTerms)}
+	}
+
+	return c.JSON(fiber.Map{
+		"results": results,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// renderSnippet HTML-escapes a snippet, turns the FTS match markers into
+// <mark> tags and additionally marks terms that were matched with LIKE.
+func renderSnippet(snippet string, shortTerms []string) string {
+	for _, term := range shortTerms {
+		snippet = markTerm(snippet, term)
+	}
+
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, snippetOpen, "<mark>")
+	return strings.ReplaceAll(escaped, snippetClose, "</mark>")
+}
+
+// shortTermSnippet picks the first field containing a LIKE-matched term,
+// trimmed to a window around the match.
+func shortTermSnippet(img models.Image, terms []string) string {
+	fields := []string{img.Title, strings.Join(img.Tags, " "), img.OCRText, img.OriginalName}
+	for _, field := range fields {
+		lower := strings.ToLower(field)
+		for _, term := range terms {
+			i := strings.Index(lower, strings.ToLower(term))
+			if i < 0 || len(lower) != len(field) {
+				continue
+			}
+			runes := []rune(field)
+			start := utf8.RuneCountInString(field[:i]) - 12
+			if start < 0 {
+				start = 0
+			}
+			end := start + 24 + utf8.RuneCountInString(term)
+			if end > len(runes) {
+				end = len(runes)
+			}
+			snippet := string(runes[start:end])
+			if start > 0 {
+				snippet = "…" + snippet
+			}
+			if end < len(runes) {
+				snippet += "…"
+			}
+			return snippet
+		}
+	}
+	if img.Title != "" {
+		return img.Title
+	}
+	return img.OriginalName
+}
+
+func markTerm(text, term string) string {
+	lowerText := strings.ToLower(text)
+	lowerTerm := strings.ToLower(term)
+	if len(lowerText) != len(text) || lowerTerm == "" {
+		return text
+	}
+
+	var b strings.Builder
+	for {
+		i := strings.Index(lowerText, lowerTerm)
+		if i < 0 {
+			b.WriteString(text)
+			return b.String()
+		}
+		end := i + len(lowerTerm)
+		b.WriteString(text[:i])
+		b.WriteString(snippetOpen + text[i:end] + snippetClose)
+		text, lowerText = text[end:], lowerText[end:]
+	}
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"hyw-webpics/database"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSearchImagesLimit(t *testing.T) {
+	setupTestDB(t)
+	app := fiber.New()
+	app.Get("/search", SearchImages)
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"", 20},
+		{"&limit=0", 20},
+		{"&limit=-5", 20},
+		{"&limit=3", 3},
+		{"&limit=1000", 100},
+	}
+	for _, tt := range tests {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/search?q=cat"+tt.query, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct {
+			Limit int `json:"limit"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Limit != tt.want {
+			t.Errorf("limit for %q = %d, want %d", tt.query, body.Limit, tt.want)
+		}
+	}
+}
+
+// searchFor runs a search and returns the IDs and snippets of the results.
+func searchFor(t *testing.T, app *fiber.App, q string) ([]int64, []string) {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/search?"+url.Values{"q": {q}}.Encode(), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("search for %q = %d", q, resp.StatusCode)
+	}
+	var body struct {
+		Results []SearchResult `json:"results"`
+		Total   int            `json:"total"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Total != len(body.Results) {
+		t.Errorf("search for %q: total %d for %d results", q, body.Total, len(body.Results))
+	}
+	ids, snippets := []int64{}, []string{}
+	for _, r := range body.Results {
+		ids = append(ids, r.ID)
+		snippets = append(snippets, r.Snippet)
+	}
+	return ids, snippets
+}
+
+// seedSearch stores an image and returns its ID; ocr, when set, is written
+// as the extracted text.
+func seedSearch(t *testing.T, img newImage, ocr string) int64 {
+	t.Helper()
+	img.OriginalName = "upload.png"
+	id, err := insertImage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ocr != "" {
+		if _, err := database.DB.Exec("UPDATE images SET ocr_text = ? WHERE id = ?", ocr, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return id
+}
+
+func TestSearchImages(t *testing.T) {
+	setupTestDB(t)
+	userID, err := CreateUser("alice", "password123", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	add := func(name, title, ocr string, tags ...string) int64 {
+		return seedSearch(t, newImage{Filename: name, Title: title, Tags: tags, UploaderID: userID, Approved: true}, ocr)
+	}
+	cat := add("cat.webp", "猫猫头表情", "", "cat")
+	ocr := add("ocr.webp", "sunset", "今天也是表情包")
+	tagged := add("tagged.webp", "", "", "reaction")
+	markup := add("markup.webp", "<i>&dog", "")
+	inTitle := add("in-title.webp", "banana", "plain")
+	inOCR := add("in-ocr.webp", "plain", "banana")
+	seedSearch(t, newImage{Filename: "pending.webp", Title: "猫猫头", UploaderID: userID}, "")
+
+	app := fiber.New()
+	app.Get("/search", SearchImages)
+
+	tests := []struct {
+		name     string
+		q        string
+		ids      []int64
+		snippets []string
+	}{
+		{"title, CJK substring", "猫猫头", []int64{cat}, []string{"<mark>猫猫头</mark>表情"}},
+		{"OCR text, CJK substring", "表情包", []int64{ocr}, []string{"今天也是<mark>表情包</mark>"}},
+		{"tag", "reaction", []int64{tagged}, []string{"<mark>reaction</mark>"}},
+		{"terms are ANDed", "猫猫头 reaction", []int64{}, []string{}},
+		// Too short for the trigram index: matched with LIKE, newest first
+		{"short CJK term", "表情", []int64{ocr, cat}, []string{"今天也是<mark>表情</mark>包", "猫猫头<mark>表情</mark>"}},
+		{"single character", "猫", []int64{cat}, []string{"<mark>猫</mark><mark>猫</mark>头表情"}},
+		{"short term ANDed with a long one", "表情 sunset", []int64{ocr}, nil},
+		// A title match outranks a newer OCR match
+		{"bm25 ordering", "banana", []int64{inTitle, inOCR}, nil},
+		{"HTML in titles is escaped", "dog", []int64{markup}, []string{"&lt;i&gt;&amp;<mark>dog</mark>"}},
+		{"short term is marked before escaping", "&", []int64{markup}, []string{"&lt;i&gt;<mark>&amp;</mark>dog"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, snippets := searchFor(t, app, tt.q)
+			if fmt.Sprint(ids) != fmt.Sprint(tt.ids) {
+				t.Errorf("search for %q found %v, want %v", tt.q, ids, tt.ids)
+			}
+			if tt.snippets != nil && fmt.Sprintf("%q", snippets) != fmt.Sprintf("%q", tt.snippets) {
+				t.Errorf("search for %q: snippets %q, want %q", tt.q, snippets, tt.snippets)
+			}
+			for _, s := range snippets {
+				if strings.Contains(strings.NewReplacer("<mark>", "", "</mark>", "").Replace(s), "<") {
+					t.Errorf("search for %q: unescaped HTML in snippet %q", tt.q, s)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchIndexFollowsChanges(t *testing.T) {
+	setupTestDB(t)
+	userID, err := CreateUser("alice", "password123", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := seedSearch(t, newImage{Filename: "a.webp", Title: "猫猫头", Tags: []string{"cat"}, UploaderID: userID, Approved: true}, "原来的文字")
+
+	app := fiber.New()
+	app.Get("/search", SearchImages)
+	app.Put("/images/:id/text", UpdateImageText)
+	app.Delete("/images/:id", RejectImage)
+	found := func(q string) bool {
+		ids, _ := searchFor(t, app, q)
+		return len(ids) == 1 && ids[0] == id
+	}
+	do := func(method, path, body string) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s %s = %d", method, path, resp.StatusCode)
+		}
+	}
+	exec := func(query string, args ...interface{}) {
+		if _, err := database.DB.Exec(query, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	retag := func(tags ...string) {
+		tx, err := database.DB.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec("DELETE FROM image_tags WHERE image_id = ?", id); err != nil {
+			t.Fatal(err)
+		}
+		if err := setImageTags(tx, id, tags); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []struct {
+		name    string
+		change  func()
+		found   []string
+		missing []string
+	}{
+		{"inserted", func() {}, []string{"猫猫头", "cat", "原来的文字"}, nil},
+		{"text corrected", func() {
+			do(http.MethodPut, fmt.Sprintf("/images/%d/text", id), `{"text": "改过的文字"}`)
+		}, []string{"改过的文字"}, []string{"原来的文字"}},
+		{"retitled", func() {
+			exec("UPDATE images SET title = ? WHERE id = ?", "狗狗头", id)
+		}, []string{"狗狗头"}, []string{"猫猫头"}},
+		{"retagged", func() { retag("kitten", "meme") }, []string{"kitten", "meme"}, []string{"cat"}},
+		{"untagged", func() { retag() }, nil, []string{"kitten", "meme"}},
+		{"deleted", func() {
+			do(http.MethodDelete, fmt.Sprintf("/images/%d", id), "")
+		}, nil, []string{"狗狗头", "改过的文字"}},
+	}
+	for _, step := range steps {
+		step.change()
+		for _, q := range step.found {
+			if !found(q) {
+				t.Errorf("%s: search for %q did not find the image", step.name, q)
+			}
+		}
+		for _, q := range step.missing {
+			if ids, _ := searchFor(t, app, q); len(ids) != 0 {
+				t.Errorf("%s: search for %q found %v, want nothing", step.name, q, ids)
+			}
+		}
+	}
+	var indexed int
+	database.DB.QueryRow("SELECT COUNT(*) FROM images_fts").Scan(&indexed)
+	if indexed != 0 {
+		t.Errorf("%d rows left in the search index after the image was deleted", indexed)
+	}
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"database/sql"
+	"time"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+	"hyw-webpics/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newSession issues an access token and a refresh token. family groups the
+// refresh tokens rotated from a single sign-in; pass "" to start a new one.
+// Only the refresh token's hash is stored.
+func newSession(db execer, userID int64, username string, tokenVersion int64, family string) (fiber.Map, error) {
+	access, err := issueToken(userID, username, tokenVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	if family == "" {
+		if family, err = utils.RandomToken(12); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now().UTC()
+	expires := now.Add(time.Duration(config.AppConfig.RefreshTokenDays) * 24 * time.Hour)
+	_, err = db.Exec(
+		"INSERT INTO refresh_tokens (user_id, token_hash, family, expires_at) VALUES (?, ?, ?, ?)",
+		userID, utils.HashToken(refresh), family, expires,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Expired tokens are no longer needed for reuse detection
+	if _, err := db.Exec("DELETE FROM refresh_tokens WHERE user_id = ? AND expires_at < ?", userID, now); err != nil {
+		authLog.Warn("Failed to prune expired refresh tokens", "user_id", userID, "err", err)
+	}
+
+	return fiber.Map{
+		"token":         access,
+		"refresh_token": refresh,
+		"expires_in":    config.AppConfig.AccessTokenMins * 60,
+	}, nil
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshSession exchanges a refresh token for a new access and refresh
+// token. Each refresh token works once; presenting one that was already used
+// means it leaked, so every token from the same sign-in is revoked.
+func RefreshSession(c *fiber.Ctx) error {
+	var req RefreshRequest
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "refresh_token is required"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	var id, userID int64
+	var family string
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+	err = tx.QueryRow(
+		"SELECT id, user_id, family, expires_at, revoked_at FROM refresh_tokens WHERE token_hash = ?",
+		utils.HashToken(req.RefreshToken),
+	).Scan(&id, &userID, &family, &expiresAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid refresh token"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	reused := revokedAt.Valid
+	if !reused {
+		result, err := tx.Exec("UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL", id)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+		// Losing a race with a concurrent refresh of the same token is reuse too
+		affected, _ := result.RowsAffected()
+		reused = affected == 0
+	}
+	if reused {
+		if _, err := tx.Exec("UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE family = ? AND revoked_at IS NULL", family); err == nil {
+			tx.Commit()
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Refresh token reuse detected, please sign in again"})
+	}
+	if time.Now().After(expiresAt) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Refresh token expired"})
+	}
+
+	var username string
+	var tokenVersion int64
+	if err := tx.QueryRow("SELECT username, token_version FROM users WHERE id = ?", userID).Scan(&username, &tokenVersion); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid refresh token"})
+	}
+
+	session, err := newSession(tx, userID, username, tokenVersion, family)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+	}
+
+	return c.JSON(session)
+}
+
+// Logout revokes the refresh token and everything rotated from the same
+// sign-in. The short-lived access token simply expires.
+func Logout(c *fiber.Ctx) error {
+	var req RefreshRequest
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "refresh_token is required"})
+	}
+
+	_, err := database.DB.Exec(`
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE revoked_at IS NULL AND family = (SELECT family FROM refresh_tokens WHERE token_hash = ?)`,
+		utils.HashToken(req.RefreshToken),
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to sign out"})
+	}
+	return c.JSON(fiber.Map{"message": "Signed out"})
+}
+
+// LogoutAll signs the user out everywhere: every refresh token is revoked
+// and every access token issued so far stops validating.
+func LogoutAll(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+	if err := revokeAllSessions(database.DB, userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to sign out"})
+	}
+	return c.JSON(fiber.Map{"message": "Signed out everywhere"})
+}
+
+func revokeAllSessions(db execer, userID int64) error {
+	if _, err := db.Exec("UPDATE users SET token_version = token_version + 1 WHERE id = ?", userID); err != nil {
+		return err
+	}
+	_, err := db.Exec("UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = ? AND revoked_at IS NULL", userID)
+	return err
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"path/filepath"
+	"testing"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+)
+
+// setupTestDB loads the default configuration and connects to a fresh
+// database in a temporary directory, closed when the test ends.
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("DATABASE_PATH", filepath.Join(dir, "test.db"))
+	t.Setenv("UPLOAD_DIR", filepath.Join(dir, "uploads"))
+	if _, err := config.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	database.Connect()
+	t.Cleanup(database.Close)
+}
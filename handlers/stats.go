@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"database/sql"
+	"strconv"
+	"sync"
+	"time"
+
+	"hyw-webpics/database"
+	"hyw-webpics/models"
+	"hyw-webpics/stats"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// trendingWindows maps each window to how far back it looks and the
+// half-life of an event's weight in the hot score.
+var trendingWindows = map[string]struct {
+	span     time.Duration
+	halfLife time.Duration
+}{
+	"day":   {24 * time.Hour, 6 * time.Hour},
+	"week":  {7 * 24 * time.Hour, 36 * time.Hour},
+	"month": {30 * 24 * time.Hour, 7 * 24 * time.Hour},
+}
+
+const (
+	shareWeight    = 5.0
+	favoriteWeight = 3.0
+	maxTrending    = 50
+	trendingTTL    = time.Minute
+)
+
+type TrendingImage struct {
+	models.Image
+	HotScore float64 `json:"hot_score"`
+}
+
+type trendingEntry struct {
+	ids     []int64
+	scores  map[int64]float64
+	expires time.Time
+}
+
+var (
+	trendingMu    sync.Mutex
+	trendingCache = make(map[string]trendingEntry)
+)
+
+// clientKey identifies the client for view and share deduplication.
+func clientKey(c *fiber.Ctx) string {
+	if userID, ok := currentUserID(c); ok {
+		return "u:" + strconv.FormatInt(userID, 10)
+	}
+	return "ip:" + c.IP()
+}
+
+// GetImage returns a single approved image and counts the view.
+func GetImage(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Image not found"})
+	}
+
+	img, err := scanImage(database.DB.QueryRow(
+		"SELECT "+imageColumns+" FROM images WHERE id = ? AND status = 'approved'", id,
+	))
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Image not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch image"})
+	}
+
+	stats.RecordView(img.ID, clientKey(c))
+
+	images := []models.Image{img}
+	decorateImages(c, images)
+	return c.JSON(images[0])
+}
+
+// ShareImage records that a client shared or copied an image link.
+func ShareImage(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Image not found"})
+	}
+
+	var exists int
+	scanRow(c, "count images", database.DB.QueryRow("SELECT COUNT(*) FROM images WHERE id = ? AND status = 'approved'", id), &exists)
+	if exists == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Image not found"})
+	}
+
+	stats.RecordShare(int64(id), clientKey(c))
+	return c.JSON(fiber.Map{"message": "Share recorded"})
+}
+
+// GetTrendingImages ranks approved images by a time-decayed hot score over
+// views, shares and favorites within the requested window.
+func GetTrendingImages(c *fiber.Ctx) error {
+	window := c.Query("window", "day")
+	if _, ok := trendingWindows[window]; !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "window must be day, week or month",
+		})
+	}
+
+	limit := c.QueryInt("limit", defaultPageLimit())
+	if limit < 1 || limit > maxTrending {
+		limit = maxTrending
+	}
+
+	entry, err := trendingScores(window)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to compute trending images"})
+	}
+
+	ids := entry.ids
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	results := []TrendingImage{}
+	if len(ids) > 0 {
+		rows, err := database.DB.Query(
+			"SELECT "+imageColumns+" FROM images WHERE status = 'approved' AND id IN ("+placeholders(len(ids))+")",
+			idsToInterfaces(ids)...,
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch images"})
+		}
+		defer rows.Close()
+
+		byID := make(map[int64]models.Image, len(ids))
+		for rows.Next() {
+			img, err := scanImage(rows)
+			if err != nil {
+				logScanError(c, "trending images", err)
+				continue
+			}
+			byID[img.ID] = img
+		}
+
+		var images []models.Image
+		for _, id := range ids {
+			if img, ok := byID[id]; ok {
+				images = append(images, img)
+			}
+		}
+		decorateImages(c, images)
+
+		for _, img := range images {
+			results = append(results, TrendingImage{Image: img, HotScore: entry.scores[img.ID]})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"window": window,
+		"images": results,
+	})
+}
+
+// trendingScores returns the ranked image IDs for a window, recomputing them
+// at most once per trendingTTL.
+func trendingScores(window string) (trendingEntry, error) {
+	trendingMu.Lock()
+	defer trendingMu.Unlock()
+
+	if entry, ok := trendingCache[window]; ok && time.Now().Before(entry.expires) {
+		return entry, nil
+	}
+
+	w := trendingWindows[window]
+	since := time.Now().Add(-w.span).UTC()
+	halfLifeDays := w.halfLife.Hours() / 24
+
+	// Each event's weight halves every halfLife; hourly buckets are aged from
+	// the middle of the hour
+	rows, err := database.DB.Query(`
+		SELECT image_id, SUM(weight * exp(-ln(2) * max(0, julianday('now') - julianday(at)) / ?)) AS score
+		FROM (
+			SELECT image_id, views + ? * shares AS weight, hour || ':30:00' AS at
+			FROM image_stats_hourly WHERE hour >= ?
+			UNION ALL
+			SELECT image_id, ?, created_at
+			FROM favorites WHERE created_at >= ?
+		)
+		GROUP BY image_id
+		ORDER BY score DESC
+		LIMIT ?`,
+		halfLifeDays, shareWeight, since.Format(stats.HourFormat),
+		favoriteWeight, database.Timestamp(since), maxTrending,
+	)
+	if err != nil {
+		return trendingEntry{}, err
+	}
+	defer rows.Close()
+
+	entry := trendingEntry{scores: make(map[int64]float64), expires: time.Now().Add(trendingTTL)}
+	for rows.Next() {
+		var id int64
+		var score float64
+		if err := rows.Scan(&id, &score); err != nil {
+			logScanError(nil, "trending scores", err)
+			continue
+		}
+		entry.ids = append(entry.ids, id)
+		entry.scores[id] = score
+	}
+
+	trendingCache[window] = entry
+	return entry, nil
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"database/sql"
+	"strings"
+	"unicode/utf8"
+
+	"hyw-webpics/database"
+	"hyw-webpics/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	maxTagsPerImage = 10
+	maxTagLength    = 32
+)
+
+// parseTags splits a comma separated tag list (ASCII or full-width commas),
+// normalising case and dropping duplicates and empty entries.
+func parseTags(raw string) []string {
+	fields := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == '，' || r == '、'
+	})
+
+	seen := make(map[string]bool)
+	var tags []string
+	for _, f := range fields {
+		tag := parseTagName(f)
+		if tag == "" || seen[tag] || utf8.RuneCountInString(tag) > maxTagLength {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+		if len(tags) == maxTagsPerImage {
+			break
+		}
+	}
+	return tags
+}
+
+// parseTagName normalises a single tag as entered by a user.
+func parseTagName(raw string) string {
+	return strings.ToLower(strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(raw), "#")))
+}
+
+// setImageTags links the given tags to an image, creating missing tags.
+func setImageTags(tx *sql.Tx, imageID int64, tags []string) error {
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO tags (name) VALUES (?)", tag); err != nil {
+			return err
+		}
+		_, err := tx.Exec(
+			"INSERT OR IGNORE INTO image_tags (image_id, tag_id) SELECT ?, id FROM tags WHERE name = ?",
+			imageID, tag,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachTags loads the tags for a page of images in a single query.
+func attachTags(c *fiber.Ctx, images []models.Image) {
+	if len(images) == 0 {
+		return
+	}
+
+	index := make(map[int64]int, len(images))
+	ids := make([]int64, len(images))
+	for i := range images {
+		index[images[i].ID] = i
+		ids[i] = images[i].ID
+		images[i].Tags = []string{}
+	}
+
+	rows, err := database.DB.Query(
+		"SELECT it.image_id, t.name FROM image_tags it JOIN tags t ON t.id = it.tag_id WHERE it.image_id IN ("+placeholders(len(ids))+") ORDER BY t.name",
+		idsToInterfaces(ids)...,
+	)
+	if err != nil {
+		logQueryError(c, "image tags", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var imageID int64
+		var name string
+		if err := rows.Scan(&imageID, &name); err != nil {
+			logScanError(c, "image tags", err)
+			continue
+		}
+		if i, ok := index[imageID]; ok {
+			images[i].Tags = append(images[i].Tags, name)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+	"hyw-webpics/totp"
+	"hyw-webpics/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	twoFactorIssuer   = "hyw-webpics"
+	recoveryCodeCount = 10
+)
+
+// privilegedRoles may use the admin API. With REQUIRE_PRIVILEGED_2FA they
+// must have two-factor authentication enabled to do so.
+var privilegedRoles = map[string]bool{"moderator": true, "admin": true}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// GetTwoFactorStatus reports whether the current user has two-factor
+// authentication enabled and whether their role requires it.
+func GetTwoFactorStatus(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+
+	var role string
+	var enabled bool
+	var remaining int
+	err := database.DB.QueryRow(`
+		SELECT role, totp_enabled,
+			(SELECT COUNT(*) FROM recovery_codes WHERE user_id = users.id AND used_at IS NULL)
+		FROM users WHERE id = ?`, userID,
+	).Scan(&role, &enabled, &remaining)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	return c.JSON(fiber.Map{
+		"enabled":                  enabled,
+		"role":                     role,
+		"required":                 config.AppConfig.Require2FA && privilegedRoles[role],
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// SetupTwoFactor generates a new secret for the current user. It takes
+// effect once EnableTwoFactor confirms a code from the authenticator app.
+func SetupTwoFactor(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+	username := c.Locals("username").(string)
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate secret"})
+	}
+
+	result, err := database.DB.Exec(
+		"UPDATE users SET totp_secret = ?, totp_last_step = 0 WHERE id = ? AND totp_enabled = 0",
+		secret, userID,
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start setup"})
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Two-factor authentication is already enabled"})
+	}
+
+	return c.JSON(fiber.Map{
+		"secret":      secret,
+		"otpauth_uri": totp.ProvisioningURI(secret, twoFactorIssuer, username),
+	})
+}
+
+// EnableTwoFactor turns on two-factor authentication after checking a code
+// for the pending secret, and returns recovery codes. They are shown only
+// this once.
+func EnableTwoFactor(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+
+	var req TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	var secret string
+	var enabled bool
+	if err := database.DB.QueryRow("SELECT totp_secret, totp_enabled FROM users WHERE id = ?", userID).Scan(&secret, &enabled); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	if enabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Two-factor authentication is already enabled"})
+	}
+	if secret == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Start two-factor setup first"})
+	}
+
+	step, ok := totp.Validate(secret, req.Code, totp.Now())
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid code"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET totp_enabled = 1, totp_last_step = ? WHERE id = ?", step, userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to enable two-factor authentication"})
+	}
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to enable two-factor authentication"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to enable two-factor authentication"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor turns two-factor authentication off. It needs both the
+// password and a current code, and is refused when the user's role requires
+// a second factor.
+func DisableTwoFactor(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+
+	var req DisableTwoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	var role string
+	scanRow(c, "read role", database.DB.QueryRow("SELECT role FROM users WHERE id = ?", userID), &role)
+	if config.AppConfig.Require2FA && privilegedRoles[role] {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Two-factor authentication is required for your role"})
+	}
+
+	if status, msg := checkPassword(userID, req.Password); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	if !verifySecondFactor(userID, req.Code) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid code"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET totp_enabled = 0, totp_secret = '', totp_last_step = 0 WHERE id = ?", userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to disable two-factor authentication"})
+	}
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to disable two-factor authentication"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to disable two-factor authentication"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code, used or not, with a
+// fresh set.
+func RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+
+	var req TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if !verifySecondFactor(userID, req.Code) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid code"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate recovery codes"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate recovery codes"})
+	}
+
+	return c.JSON(fiber.Map{"recovery_codes": codes})
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+// A TOTP time step is accepted at most once, so an observed code cannot be
+// replayed; a recovery code is used up.
+func verifySecondFactor(userID int64, code string) bool {
+	var secret string
+	var enabled bool
+	err := database.DB.QueryRow("SELECT totp_secret, totp_enabled FROM users WHERE id = ?", userID).Scan(&secret, &enabled)
+	if err != nil || !enabled {
+		return false
+	}
+
+	if step, ok := totp.Validate(secret, code, totp.Now()); ok {
+		result, err := database.DB.Exec("UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?", step, userID, step)
+		if err != nil {
+			return false
+		}
+		affected, _ := result.RowsAffected()
+		return affected == 1
+	}
+
+	result, err := database.DB.Exec(
+		"UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		userID, utils.HashToken(normalizeRecoveryCode(code)),
+	)
+	if err != nil {
+		return false
+	}
+	affected, _ := result.RowsAffected()
+	return affected == 1
+}
+
+// replaceRecoveryCodes stores a new set of recovery codes for the user and
+// returns them formatted for display. Only their hashes are kept.
+func replaceRecoveryCodes(db execer, userID int64) ([]string, error) {
+	if _, err := db.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := base32.StdEncoding.EncodeToString(b)[:10]
+		if _, err := db.Exec("INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, utils.HashToken(code)); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode accepts recovery codes with or without the dash and
+// in either case.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+	"hyw-webpics/totp"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// fixClock makes totp.Now return t for the rest of the test.
+func fixClock(t *testing.T, now time.Time) {
+	t.Helper()
+	prev := totp.Now
+	totp.Now = func() time.Time { return now }
+	t.Cleanup(func() { totp.Now = prev })
+}
+
+func TestVerifySecondFactorRejectsReusedStep(t *testing.T) {
+	setupTestDB(t)
+	now := time.Unix(1700000000, 0)
+	fixClock(t, now)
+
+	userID, err := CreateUser("alice", "password123", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.DB.Exec("UPDATE users SET totp_secret = ?, totp_enabled = 1, totp_last_step = 0 WHERE id = ?", secret, userID); err != nil {
+		t.Fatal(err)
+	}
+	code := func(step int64) string {
+		c, err := totp.Code(secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	step := totp.Step(now)
+
+	if !verifySecondFactor(userID, code(step)) {
+		t.Fatal("first use of the current code was rejected")
+	}
+	if verifySecondFactor(userID, code(step)) {
+		t.Error("the same code was accepted twice")
+	}
+	// An older step inside the skew window is valid TOTP but already passed
+	if verifySecondFactor(userID, code(step-1)) {
+		t.Error("a code older than the last accepted step was accepted")
+	}
+	if !verifySecondFactor(userID, code(step+1)) {
+		t.Error("the next step's code was rejected")
+	}
+	if verifySecondFactor(userID, code(step+5)) {
+		t.Error("a code outside the skew window was accepted")
+	}
+}
+
+func TestAdminLoginRejectsReusedStep(t *testing.T) {
+	setupTestDB(t)
+	now := time.Unix(1700000000, 0)
+	fixClock(t, now)
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.AppConfig.AdminPassword = "admin-password"
+	config.AppConfig.AdminTOTPSecret = secret
+	adminLastStep.Lock()
+	adminLastStep.step = 0
+	adminLastStep.Unlock()
+
+	app := fiber.New()
+	app.Post("/login", AdminLogin)
+	login := func(code string) int {
+		body := `{"password":"admin-password","code":"` + code + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	code, err := totp.Code(secret, totp.Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := login(code); status != http.StatusOK {
+		t.Fatalf("first login = %d, want 200", status)
+	}
+	if status := login(code); status != http.StatusUnauthorized {
+		t.Errorf("replayed login = %d, want 401", status)
+	}
+}
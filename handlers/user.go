@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"hyw-webpics/database"
+	"hyw-webpics/models"
+	"hyw-webpics/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxDisplayName = 50
+
+// userSummaryColumns is the column list scanned by scanUserSummary.
+const userSummaryColumns = "users.id, users.username, users.display_name, users.avatar"
+
+func scanUserSummary(row rowScanner, extra ...interface{}) (models.UserSummary, error) {
+	var u models.UserSummary
+	var avatar string
+	err := row.Scan(append([]interface{}{&u.ID, &u.Username, &u.DisplayName, &avatar}, extra...)...)
+	u.AvatarURL = avatarURL(avatar)
+	return u, err
+}
+
+func avatarURL(avatar string) string {
+	if avatar == "" {
+		return ""
+	}
+	return "/uploads/" + avatar
+}
+
+// attachUploaders fills in the uploader summary of each image with a single
+// query for the whole page.
+func attachUploaders(c *fiber.Ctx, images []models.Image) {
+	if len(images) == 0 {
+		return
+	}
+
+	seen := make(map[int64]bool)
+	var ids []int64
+	for _, img := range images {
+		if img.UploaderID != 0 && !seen[img.UploaderID] {
+			seen[img.UploaderID] = true
+			ids = append(ids, img.UploaderID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	rows, err := database.DB.Query(
+		"SELECT "+userSummaryColumns+" FROM users WHERE id IN ("+placeholders(len(ids))+")",
+		idsToInterfaces(ids)...,
+	)
+	if err != nil {
+		logQueryError(c, "uploaders", err)
+		return
+	}
+	defer rows.Close()
+
+	users := make(map[int64]*models.UserSummary, len(ids))
+	for rows.Next() {
+		u, err := scanUserSummary(rows)
+		if err != nil {
+			logScanError(c, "uploaders", err)
+			continue
+		}
+		users[u.ID] = &u
+	}
+
+	for i := range images {
+		images[i].Uploader = users[images[i].UploaderID]
+	}
+}
+
+// GetUserProfile returns a user's public profile.
+func GetUserProfile(c *fiber.Ctx) error {
+	var profile models.UserProfile
+	summary, err := scanUserSummary(database.DB.QueryRow(`
+		SELECT `+userSummaryColumns+`, users.created_at,
+			(SELECT COUNT(*) FROM images WHERE images.uploader_id = users.id AND images.status = 'approved')
+		FROM users WHERE users.username = ?`, c.Params("username"),
+	), &profile.JoinedAt, &profile.ApprovedUploads)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch user"})
+	}
+
+	profile.UserSummary = summary
+	return c.JSON(profile)
+}
+
+// GetUserImages lists a user's approved uploads with the same paging and
+// sort options as the main listing.
+func GetUserImages(c *fiber.Ctx) error {
+	var userID int64
+	err := database.DB.QueryRow("SELECT id FROM users WHERE username = ?", c.Params("username")).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch user"})
+	}
+
+	req, err := parsePageRequest(c, "approved_at")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	where := "images.uploader_id = ? AND images.status = 'approved'"
+	args := []interface{}{userID}
+
+	images, nextCursor, err := queryImagePage(c, req, "FROM images", where, args)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch images"})
+	}
+	decorateImages(c, images)
+
+	var total int
+	if !req.cursorMode {
+		scanRow(c, "count images", database.DB.QueryRow("SELECT COUNT(*) FROM images WHERE "+where, args...), &total)
+	}
+
+	return c.JSON(imagePageResponse(req, images, nextCursor, total))
+}
+
+type ProfileRequest struct {
+	DisplayName *string `json:"display_name"`
+}
+
+// UpdateProfile changes the current user's public profile fields.
+func UpdateProfile(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+
+	var req ProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if req.DisplayName != nil {
+		name := strings.TrimSpace(*req.DisplayName)
+		if utf8.RuneCountInString(name) > maxDisplayName {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Display name must be at most 50 characters"})
+		}
+		if _, err := database.DB.Exec("UPDATE users SET display_name = ? WHERE id = ?", name, userID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update profile"})
+		}
+	}
+
+	return currentUserSummary(c, userID)
+}
+
+// UploadAvatar replaces the current user's avatar. The file goes through the
+// same WebP conversion as image uploads but skips moderation.
+func UploadAvatar(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+
+	file, err := c.FormFile("avatar")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "No avatar file provided"})
+	}
+	if !allowedUploadExts[strings.ToLower(filepath.Ext(file.Filename))] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Only JPG, PNG, and GIF files are allowed"})
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Failed to read file"})
+	}
+	filename, err := utils.ConvertToWebP(src, file.Filename)
+	src.Close()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return setAvatar(c, userID, filename)
+}
+
+func DeleteAvatar(c *fiber.Ctx) error {
+	return setAvatar(c, c.Locals("user_id").(int64), "")
+}
+
+func setAvatar(c *fiber.Ctx, userID int64, filename string) error {
+	var old string
+	scanRow(c, "read avatar", database.DB.QueryRow("SELECT avatar FROM users WHERE id = ?", userID), &old)
+
+	if _, err := database.DB.Exec("UPDATE users SET avatar = ? WHERE id = ?", filename, userID); err != nil {
+		if filename != "" {
+			removeImageFiles(filename)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update avatar"})
+	}
+	if old != "" {
+		removeImageFiles(old)
+	}
+
+	return currentUserSummary(c, userID)
+}
+
+func currentUserSummary(c *fiber.Ctx, userID int64) error {
+	u, err := scanUserSummary(database.DB.QueryRow("SELECT "+userSummaryColumns+" FROM users WHERE id = ?", userID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch user"})
+	}
+	return c.JSON(u)
+}
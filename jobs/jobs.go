@@ -0,0 +1,111 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+
+	"hyw-webpics/logging"
+)
+
+const queueSize = 1024
+
+type job struct {
+	name string
+	fn   func()
+}
+
+var (
+	queue   chan job
+	startMu sync.Mutex
+	stopped bool
+	workers sync.WaitGroup
+
+	jobsLog = logging.For("jobs")
+)
+
+// Start launches the background workers. Jobs enqueued before Start are
+// buffered and picked up once the workers run.
+func Start(n int) {
+	startMu.Lock()
+	defer startMu.Unlock()
+
+	ensureQueue()
+	for i := 0; i < n; i++ {
+		workers.Add(1)
+		go worker()
+	}
+}
+
+// Enqueue schedules fn to run on a background worker. If the queue is full
+// or the workers are stopping the job is dropped and logged rather than
+// blocking the caller.
+func Enqueue(name string, fn func()) {
+	startMu.Lock()
+	defer startMu.Unlock()
+	ensureQueue()
+
+	if stopped {
+		jobsLog.Warn("Job queue stopped, dropping job", "job", name)
+		return
+	}
+	select {
+	case queue <- job{name: name, fn: fn}:
+	default:
+		jobsLog.Warn("Job queue full, dropping job", "job", name)
+	}
+}
+
+// Stop refuses new jobs and waits for the workers to finish the queued ones.
+// If ctx ends first the remaining jobs are abandoned and ctx's error is
+// returned.
+func Stop(ctx context.Context) error {
+	startMu.Lock()
+	if !stopped {
+		stopped = true
+		ensureQueue()
+		close(queue)
+	}
+	startMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		jobsLog.Warn("Abandoning background jobs", "remaining", Depth())
+		return ctx.Err()
+	}
+}
+
+func ensureQueue() {
+	if queue == nil {
+		queue = make(chan job, queueSize)
+	}
+}
+
+func worker() {
+	defer workers.Done()
+	for j := range queue {
+		run(j)
+	}
+}
+
+func run(j job) {
+	defer func() {
+		if r := recover(); r != nil {
+			jobsLog.Error("Job panicked", "job", j.name, "panic", r)
+		}
+	}()
+	j.fn()
+}
+
+// Depth returns the number of jobs waiting for a worker.
+func Depth() int {
+	startMu.Lock()
+	defer startMu.Unlock()
+	return len(queue)
+}
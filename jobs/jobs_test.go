@@ -0,0 +1,49 @@
+package jobs
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStopDrainsQueue(t *testing.T) {
+	var ran atomic.Int32
+	release := make(chan struct{})
+	// Queued before the workers start, like jobs enqueued during startup
+	Enqueue("blocked", func() {
+		<-release
+		ran.Add(1)
+	})
+	for i := 0; i < 19; i++ {
+		Enqueue("quick", func() {
+			time.Sleep(time.Millisecond)
+			ran.Add(1)
+		})
+	}
+	Enqueue("panics", func() { panic("boom") })
+	Start(2)
+
+	// A job that outlasts the deadline is abandoned
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := Stop(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Stop with a blocked job = %v, want context.DeadlineExceeded", err)
+	}
+
+	close(release)
+	if err := Stop(context.Background()); err != nil {
+		t.Fatalf("Stop = %v", err)
+	}
+	if n := ran.Load(); n != 20 {
+		t.Errorf("%d of 20 queued jobs ran before Stop returned", n)
+	}
+	if d := Depth(); d != 0 {
+		t.Errorf("%d jobs left in the queue", d)
+	}
+
+	Enqueue("late", func() { ran.Add(1) })
+	if d := Depth(); d != 0 {
+		t.Errorf("a job enqueued after Stop was queued")
+	}
+}
@@ -0,0 +1,178 @@
+// Package logging provides leveled, structured loggers built on log/slog.
+// Every logger belongs to a subsystem ("http", "db", "auth"...) whose level
+// can be set on its own. Loggers may be created before Configure runs, as
+// package variables usually are; they pick up the configured output and
+// levels when it does.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	mu           sync.Mutex
+	levels       = make(map[string]*slog.LevelVar)
+	overrides    = make(map[string]slog.Level)
+	defaultLevel = slog.LevelInfo
+
+	// output holds the current slog.Handler. It is boxed because JSON and
+	// text handlers have different types, which atomic.Value refuses.
+	output atomic.Pointer[outputBox]
+)
+
+type outputBox struct{ slog.Handler }
+
+func init() {
+	output.Store(&outputBox{newOutput("json", os.Stderr)})
+}
+
+func newOutput(format string, w io.Writer) slog.Handler {
+	// Levels are checked per subsystem, so the output accepts everything
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	if format == "text" {
+		return slog.NewTextHandler(w, opts)
+	}
+	return slog.NewJSONHandler(w, opts)
+}
+
+// For returns the logger of a subsystem.
+func For(subsystem string) *slog.Logger {
+	mu.Lock()
+	defer mu.Unlock()
+
+	level := levels[subsystem]
+	if level == nil {
+		level = new(slog.LevelVar)
+		level.Set(levelOf(subsystem))
+		levels[subsystem] = level
+	}
+	return slog.New(&handler{
+		level: level,
+		wrap: func(h slog.Handler) slog.Handler {
+			return h.WithAttrs([]slog.Attr{slog.String("subsystem", subsystem)})
+		},
+	})
+}
+
+func levelOf(subsystem string) slog.Level {
+	if level, ok := overrides[subsystem]; ok {
+		return level
+	}
+	return defaultLevel
+}
+
+// Configure sets the output format ("json" or "text"), the default level and
+// per-subsystem levels given as "http=warn,db=debug". It also routes the
+// standard log package and slog's default logger through the "app"
+// subsystem.
+func Configure(format, level, subsystemLevels string) error {
+	if format != "json" && format != "text" {
+		return fmt.Errorf("log format must be json or text, not %q", format)
+	}
+	def, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	parsed, err := ParseLevels(subsystemLevels)
+	if err != nil {
+		return err
+	}
+
+	output.Store(&outputBox{newOutput(format, os.Stderr)})
+
+	mu.Lock()
+	defaultLevel, overrides = def, parsed
+	for subsystem, lv := range levels {
+		lv.Set(levelOf(subsystem))
+	}
+	mu.Unlock()
+
+	slog.SetDefault(For("app"))
+	return nil
+}
+
+// ParseLevel parses debug, info, warn or error.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q", s)
+	}
+	return level, nil
+}
+
+// ParseLevels parses a comma separated list of subsystem=level pairs.
+func ParseLevels(s string) (map[string]slog.Level, error) {
+	parsed := make(map[string]slog.Level)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		subsystem, value, ok := strings.Cut(pair, "=")
+		if !ok || subsystem == "" {
+			return nil, fmt.Errorf("invalid subsystem level %q, expected name=level", pair)
+		}
+		level, err := ParseLevel(value)
+		if err != nil {
+			return nil, err
+		}
+		parsed[subsystem] = level
+	}
+	return parsed, nil
+}
+
+// Request returns l with the request ID and, once authentication has run,
+// the acting user or admin of c.
+func Request(c *fiber.Ctx, l *slog.Logger) *slog.Logger {
+	if c == nil {
+		return l
+	}
+	var attrs []any
+	if id, ok := c.Locals("request_id").(string); ok {
+		attrs = append(attrs, "request_id", id)
+	}
+	if userID, ok := c.Locals("user_id").(int64); ok {
+		attrs = append(attrs, "user_id", userID)
+	}
+	if actor, ok := c.Locals("moderator").(string); ok {
+		attrs = append(attrs, "actor", actor)
+	}
+	return l.With(attrs...)
+}
+
+// handler filters by its subsystem's level and writes to the current
+// output. Attributes and groups added with With are replayed onto the output
+// for each record, so they survive Configure swapping it.
+type handler struct {
+	level *slog.LevelVar
+	wrap  func(slog.Handler) slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	return h.wrap(output.Load().Handler).Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &handler{level: h.level, wrap: func(out slog.Handler) slog.Handler {
+		return h.wrap(out).WithAttrs(attrs)
+	}}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{level: h.level, wrap: func(out slog.Handler) slog.Handler {
+		return h.wrap(out).WithGroup(name)
+	}}
+}
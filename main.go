@@ -1,99 +1,142 @@
 package main
 
 import (
-	"log"
+	"context"
+	"flag"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"hyw-webpics/config"
 	"hyw-webpics/database"
-	"hyw-webpics/handlers"
-	"hyw-webpics/middleware"
+	"hyw-webpics/jobs"
+	"hyw-webpics/logging"
+	"hyw-webpics/server"
+	"hyw-webpics/stats"
+	"hyw-webpics/utils"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 )
 
+var serverLog = logging.For("server")
+
 func main() {
-	// Load configuration
-	config.Load()
+	// Load configuration: defaults < config file < environment < flags
+	args, err := config.Load(os.Args[1:])
+	if err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(0)
+		}
+		serverLog.Error("Invalid configuration", "err", err)
+		os.Exit(1)
+	}
+	if err := logging.Configure(config.AppConfig.LogFormat, config.AppConfig.LogLevel, config.AppConfig.LogLevels); err != nil {
+		serverLog.Error("Invalid configuration", "err", err)
+		os.Exit(1)
+	}
+
+	// config print works on any configuration, so it runs before validation
+	if len(args) > 0 && args[0] == "config" {
+		os.Exit(runConfig(args[1:]))
+	}
+	if err := config.AppConfig.Validate(); err != nil {
+		serverLog.Error("Invalid configuration", "err", err)
+		os.Exit(1)
+	}
 
 	// Connect to database
 	database.Connect()
-	defer database.Close()
+	utils.InitTextExtractor(config.AppConfig.OCRLanguages)
+
+	// Without a command the binary runs the server
+	command := "serve"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	code := runCommand(command, args)
+	database.Close()
+	os.Exit(code)
+}
+
+// serve runs the HTTP server.
+func serve(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	jobs.Start(2)
+	stats.Start(time.Duration(config.AppConfig.StatsFlushSecs) * time.Second)
 
 	// Create uploads directory
 	if err := os.MkdirAll(config.AppConfig.UploadDir, 0755); err != nil {
-		log.Fatal("Failed to create uploads directory:", err)
+		serverLog.Error("Failed to create uploads directory", "err", err)
+		return 1
+	}
+
+	app, metricsApp := server.New()
+	if metricsApp != nil {
+		go func() {
+			listen := config.AppConfig.MetricsListen
+			serverLog.Info("Metrics listening", "addr", listen)
+			if err := metricsApp.Listen(listen); err != nil {
+				serverLog.Error("Metrics server stopped", "err", err)
+			}
+		}()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	listenErr := make(chan error, 1)
+	go func() {
+		serverLog.Info("Server starting", "port", config.AppConfig.Port)
+		listenErr <- app.Listen(":" + config.AppConfig.Port)
+	}()
+
+	select {
+	case err := <-listenErr:
+		serverLog.Error("Server stopped", "err", err)
+		return 1
+	case <-ctx.Done():
+	}
+	// Restore the default handling, so a second signal kills the process
+	stop()
+
+	apps := []*fiber.App{app}
+	if metricsApp != nil {
+		apps = append(apps, metricsApp)
+	}
+	return shutdown(apps...)
+}
+
+// shutdown stops accepting connections, then waits for in-flight requests
+// and queued background jobs and writes buffered stats, all within
+// server.shutdown_timeout_seconds. main closes the database afterwards.
+func shutdown(apps ...*fiber.App) int {
+	timeout := time.Duration(config.AppConfig.ShutdownSecs) * time.Second
+	serverLog.Info("Shutting down", "timeout", timeout.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	code := 0
+	for _, app := range apps {
+		if err := app.ShutdownWithContext(ctx); err != nil {
+			serverLog.Error("Requests still running at shutdown", "err", err)
+			code = 1
+		}
+	}
+	if err := jobs.Stop(ctx); err != nil {
+		serverLog.Error("Background jobs still running at shutdown", "err", err)
+		code = 1
+	}
+	if err := stats.Stop(); err != nil {
+		serverLog.Error("Failed to flush image stats", "err", err)
+		code = 1
 	}
 
-	// Create Fiber app
-	app := fiber.New(fiber.Config{
-		BodyLimit: 50 * 1024 * 1024, // 50MB
-	})
-
-	// Middleware
-	app.Use(logger.New())
-	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowMethods: "GET,POST,PUT,DELETE",
-		AllowHeaders: "Origin,Content-Type,Accept,Authorization,X-Admin-Token",
-	}))
-
-	// API routes
-	api := app.Group("/api")
-
-	// Auth routes
-	auth := api.Group("/auth")
-	auth.Post("/register", handlers.Register)
-	auth.Post("/login", handlers.Login)
-	auth.Get("/me", middleware.UserAuth(), handlers.GetMe)
-
-	// Image routes
-	images := api.Group("/images")
-	images.Post("/upload", middleware.UserAuth(), handlers.UploadImage)
-	images.Get("/", handlers.GetApprovedImages)
-	images.Get("/random", handlers.GetRandomImage)
-
-	// Category routes (Public List)
-	api.Get("/categories", handlers.GetCategories)
-
-	// Admin functionality
-	admin := api.Group("/admin")
-
-	// Public Routes
-	admin.Post("/login", handlers.AdminLogin)
-	admin.Post("/logout", handlers.AdminLogout)
-
-	// Protected Routes
-	admin.Use(middleware.AdminAuth()) // Ensure all admin routes BELOW are protected
-
-	// Admin Category Management
-	admin.Post("/categories", handlers.CreateCategory)
-	admin.Put("/categories/:id", handlers.UpdateCategory)
-	admin.Delete("/categories/:id", handlers.DeleteCategory)
-
-	// Admin Stats & Ops
-	admin.Get("/stats", handlers.GetAdminStats)
-	admin.Get("/pending", handlers.GetPendingImages) // Keep for convenience or legacy
-	admin.Get("/images", handlers.GetAdminImages)    // New generic list
-	admin.Post("/approve/:id", handlers.ApproveImage)
-	admin.Post("/bulk-approve", handlers.BulkApproveImages)
-	admin.Post("/bulk-delete", handlers.BulkDeleteImages)
-	admin.Delete("/images/:id", handlers.RejectImage) // Renamed usage, handlers.RejectImage now does generic delete
-	admin.Post("/reject/:id", handlers.RejectImage)   // Keep alias for compatibility
-
-	// Serve uploaded images
-	app.Static("/uploads", config.AppConfig.UploadDir)
-
-	// Serve Vue frontend (production build)
-	app.Static("/", "./web/dist")
-
-	// SPA fallback - serve index.html for all non-API routes
-	app.Get("/*", func(c *fiber.Ctx) error {
-		return c.SendFile("./web/dist/index.html")
-	})
-
-	log.Printf("Server starting on port %s", config.AppConfig.Port)
-	log.Fatal(app.Listen(":" + config.AppConfig.Port))
+	serverLog.Info("Shutdown complete")
+	return code
 }
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+	"hyw-webpics/jobs"
+	"hyw-webpics/stats"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestShutdownDrainsJobsAndStats(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("DATABASE_PATH", filepath.Join(t.TempDir(), "test.db"))
+	t.Setenv("SHUTDOWN_TIMEOUT_SECONDS", "5")
+	if _, err := config.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	database.Connect()
+	t.Cleanup(database.Close)
+	if _, err := database.DB.Exec("INSERT INTO images (id, filename, original_name, uploader_id, status) VALUES (1, 'a.webp', 'a.png', 0, 'approved')"); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs.Start(1)
+	stats.Start(time.Hour)
+	var ran atomic.Int32
+	for i := 0; i < 5; i++ {
+		jobs.Enqueue("slow", func() {
+			time.Sleep(10 * time.Millisecond)
+			ran.Add(1)
+		})
+	}
+	stats.RecordView(1, "ip:1")
+
+	if code := shutdown(fiber.New()); code != 0 {
+		t.Errorf("shutdown = %d, want 0", code)
+	}
+	if n := ran.Load(); n != 5 {
+		t.Errorf("%d of 5 queued jobs ran before shutdown returned", n)
+	}
+	var views int
+	if err := database.DB.QueryRow("SELECT view_count FROM images WHERE id = 1").Scan(&views); err != nil {
+		t.Fatal(err)
+	}
+	if views != 1 {
+		t.Errorf("view_count = %d after shutdown, want the buffered view written", views)
+	}
+}
@@ -0,0 +1,32 @@
+package metrics
+
+import "runtime"
+
+// Metrics recorded by the server. Gauges that need the database or other
+// packages are registered by those packages' callers, see handlers.
+var (
+	HTTPRequests = NewCounter("webpics_http_requests_total",
+		"HTTP requests by method, route and status.", "method", "route", "status")
+	HTTPDuration = NewHistogram("webpics_http_request_duration_seconds",
+		"HTTP request latency by method, route and status.", DefBuckets, "method", "route", "status")
+
+	Uploads = NewCounter("webpics_uploads_total",
+		"Uploaded files by outcome: pending, auto_approved, invalid, over_quota, conversion_failed, failed.", "outcome")
+	Conversion = NewHistogram("webpics_image_conversion_duration_seconds",
+		"Time spent in cwebp, gif2webp and dwebp, by kind (upload or variant).",
+		[]float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}, "kind")
+
+	DBQuery = NewHistogram("webpics_db_query_duration_seconds",
+		"Database statement latency by op (query or exec); queries are timed until their first row.", DefBuckets, "op")
+)
+
+func init() {
+	NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.", nil,
+		func(set func(float64, ...string)) { set(float64(runtime.NumGoroutine())) })
+	NewGaugeFunc("go_memstats_heap_alloc_bytes", "Bytes of allocated heap objects.", nil,
+		func(set func(float64, ...string)) {
+			var m runtime.MemStats
+			runtime.ReadMemStats(&m)
+			set(float64(m.HeapAlloc))
+		})
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCounterExposition(t *testing.T) {
+	c := NewCounter("test_counter_total", "A counter.", "path", "code")
+	c.Inc(`a"b\c`+"\nd", "200")
+	c.Add(2.5, "/plain", "404")
+	c.Inc("/plain", "404")
+
+	var buf bytes.Buffer
+	c.write(&buf)
+	want := `# HELP test_counter_total A counter.
+# TYPE test_counter_total counter
+test_counter_total{path="/plain",code="404"} 3.5
+test_counter_total{path="a\"b\\c\nd",code="200"} 1
+`
+	if buf.String() != want {
+		t.Errorf("counter output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestHistogramExposition(t *testing.T) {
+	h := NewHistogram("test_duration_seconds", "A histogram.", []float64{1, 2.5}, "op")
+	// Bounds are inclusive; 5 only lands in +Inf
+	for _, v := range []float64{0.5, 1, 2, 5} {
+		h.Observe(v, "query")
+	}
+
+	var buf bytes.Buffer
+	h.write(&buf)
+	want := `# HELP test_duration_seconds A histogram.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{op="query",le="1"} 2
+test_duration_seconds_bucket{op="query",le="2.5"} 3
+test_duration_seconds_bucket{op="query",le="+Inf"} 4
+test_duration_seconds_sum{op="query"} 8.5
+test_duration_seconds_count{op="query"} 4
+`
+	if buf.String() != want {
+		t.Errorf("histogram output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	NewGaugeFunc("test_gauge", "A gauge.", nil, func(set func(float64, ...string)) { set(7) })
+
+	var buf bytes.Buffer
+	Write(&buf)
+	out := buf.String()
+	if !strings.Contains(out, "\ntest_gauge 7\n") {
+		t.Errorf("output has no test_gauge sample:\n%s", out)
+	}
+	// Sorted by name
+	if a, b := strings.Index(out, "# HELP go_goroutines"), strings.Index(out, "# HELP webpics_http_requests_total"); a < 0 || b < 0 || a > b {
+		t.Errorf("metrics are not sorted by name:\n%s", out)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering test_gauge twice did not panic")
+		}
+	}()
+	NewGaugeFunc("test_gauge", "Again.", nil, func(func(float64, ...string)) {})
+}
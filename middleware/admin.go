@@ -1,26 +1,136 @@
 package middleware
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+	"hyw-webpics/logging"
+	"hyw-webpics/utils"
+
 	"github.com/gofiber/fiber/v2"
 )
 
-func AdminAuth() fiber.Handler {
+// AdminSessionValue returns the signed admin_session cookie value for a
+// session expiring at expires.
+func AdminSessionValue(expires time.Time) string {
+	return utils.SignValue(config.AppConfig.JWTSecret, "admin:"+strconv.FormatInt(expires.Unix(), 10))
+}
+
+// AdminToken returns the X-Admin-Token that goes with an admin_session
+// cookie. AdminLogin hands it to the client, which must send it back with
+// the cookie.
+func AdminToken(session string) string {
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.JWTSecret))
+	mac.Write([]byte("admin-token:" + session))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validAdminSession checks a cookie produced by AdminSessionValue.
+func validAdminSession(cookie string) bool {
+	value, ok := utils.VerifySignedValue(config.AppConfig.JWTSecret, cookie)
+	if !ok || !strings.HasPrefix(value, "admin:") {
+		return false
+	}
+	expires, err := strconv.ParseInt(strings.TrimPrefix(value, "admin:"), 10, 64)
+	return err == nil && time.Now().Unix() < expires
+}
+
+// AdminAuth protects the admin API. It accepts either the shared admin
+// password session (the admin_session cookie plus the X-Admin-Token header
+// AdminToken derives from it)
+// or a user session JWT whose role is admin or one of roles. API keys are
+// never accepted. With REQUIRE_PRIVILEGED_2FA, password sessions need
+// ADMIN_TOTP_SECRET to be configured and users need two-factor enabled.
+//
+// It sets the "role" and "moderator" locals, the latter naming who is acting
+// in the moderation log.
+func AdminAuth(roles ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		adminToken := c.Get("X-Admin-Token")
-		if adminToken == "" {
+		if token := c.Get("X-Admin-Token"); token != "" {
+			session := c.Cookies("admin_session")
+			if !validAdminSession(session) || subtle.ConstantTimeCompare([]byte(token), []byte(AdminToken(session))) != 1 {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid admin session",
+				})
+			}
+			if config.AppConfig.Require2FA && config.AppConfig.AdminTOTPSecret == "" {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Two-factor authentication is required",
+				})
+			}
+			c.Locals("role", "admin")
+			c.Locals("moderator", "admin")
+			return c.Next()
+		}
+
+		p, err := authenticate(c)
+		if err == errMissingAuth {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Admin authentication required",
 			})
 		}
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": authErrorMessages[err],
+			})
+		}
+		if p.scopes != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "API keys cannot be used for this endpoint",
+			})
+		}
 
-		// Validate admin session (stored in locals during login)
-		session := c.Cookies("admin_session")
-		if session == "" || session != "authenticated" {
+		var role string
+		var twoFactor bool
+		if err := database.DB.QueryRow("SELECT role, totp_enabled FROM users WHERE id = ?", p.userID).Scan(&role, &twoFactor); err != nil {
+			if err != sql.ErrNoRows {
+				logging.Request(c, authLog).Error("Failed to look up admin role", "err", err)
+			}
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid admin session",
+				"error": "Invalid token",
+			})
+		}
+
+		allowed := role == "admin"
+		for _, r := range roles {
+			allowed = allowed || role == r
+		}
+		if !allowed {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Insufficient role",
+			})
+		}
+		if config.AppConfig.Require2FA && !twoFactor {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Two-factor authentication is required for your role",
 			})
 		}
 
+		c.Locals("user_id", p.userID)
+		c.Locals("username", p.username)
+		c.Locals("role", role)
+		c.Locals("moderator", p.username)
+		return c.Next()
+	}
+}
+
+// AdminOnly restricts a route inside the admin group to admins, excluding
+// moderators. It must run after AdminAuth.
+func AdminOnly() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if role, _ := c.Locals("role").(string); role != "admin" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Admin role required",
+			})
+		}
 		return c.Next()
 	}
 }
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"hyw-webpics/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAdminAuthPasswordSession(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	if _, err := config.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	app.Get("/admin", AdminAuth(), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	session := AdminSessionValue(time.Now().Add(time.Hour))
+	other := AdminSessionValue(time.Now().Add(2 * time.Hour))
+	expired := AdminSessionValue(time.Now().Add(-time.Hour))
+	tests := []struct {
+		name   string
+		cookie string
+		token  string
+		status int
+	}{
+		{"cookie and its token", session, AdminToken(session), fiber.StatusNoContent},
+		{"fixed token", session, "admin", fiber.StatusUnauthorized},
+		{"token of another session", session, AdminToken(other), fiber.StatusUnauthorized},
+		{"token without the cookie", "", AdminToken(session), fiber.StatusUnauthorized},
+		{"expired session", expired, AdminToken(expired), fiber.StatusUnauthorized},
+		{"forged cookie", "admin:99999999999.00", AdminToken("admin:99999999999.00"), fiber.StatusUnauthorized},
+		{"cookie alone", session, "", fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "admin_session", Value: tt.cookie})
+			}
+			if tt.token != "" {
+				req.Header.Set("X-Admin-Token", tt.token)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
@@ -1,50 +1,192 @@
 package middleware
 
 import (
+	"database/sql"
+	"errors"
 	"strings"
+	"time"
 
 	"hyw-webpics/config"
+	"hyw-webpics/database"
+	"hyw-webpics/logging"
+	"hyw-webpics/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func UserAuth() fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		authHeader := c.Get("Authorization")
-		if authHeader == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Missing authorization header",
-			})
+var authLog = logging.For("auth")
+
+var (
+	errMissingAuth   = errors.New("missing authorization header")
+	errAuthFormat    = errors.New("invalid authorization format")
+	errInvalidClaims = errors.New("invalid token claims")
+	errInvalidToken  = errors.New("invalid token")
+	errInvalidKey    = errors.New("invalid API key")
+)
+
+var authErrorMessages = map[error]string{
+	errMissingAuth:   "Missing authorization header",
+	errAuthFormat:    "Invalid authorization format",
+	errInvalidClaims: "Invalid token claims",
+	errInvalidToken:  "Invalid token",
+	errInvalidKey:    "Invalid or expired API key",
+}
+
+// principal is the authenticated caller. scopes is nil for JWT sessions,
+// which may do anything the user can; API keys carry an explicit list.
+type principal struct {
+	userID   int64
+	username string
+	scopes   []string
+}
+
+func (p principal) allows(scopes []string) bool {
+	if p.scopes == nil {
+		return true
+	}
+	for _, want := range scopes {
+		for _, have := range p.scopes {
+			if want == have {
+				return true
+			}
 		}
+	}
+	return false
+}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
+// UserAuth requires a signed-in user, authenticated with either a session JWT
+// or an API key. API keys are only accepted on routes that name a scope, and
+// only if the key holds one of those scopes, so account management stays
+// session-only.
+func UserAuth(scopes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		p, err := authenticate(c)
+		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid authorization format",
+				"error": authErrorMessages[err],
 			})
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.AppConfig.JWTSecret), nil
-		})
-
-		if err != nil || !token.Valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid token",
+		if p.scopes != nil && len(scopes) == 0 {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "API keys cannot be used for this endpoint",
 			})
 		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid token claims",
+		if !p.allows(scopes) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "API key lacks the " + strings.Join(scopes, " or ") + " scope",
 			})
 		}
 
-		c.Locals("user_id", int64(claims["user_id"].(float64)))
-		c.Locals("username", claims["username"].(string))
+		c.Locals("user_id", p.userID)
+		c.Locals("username", p.username)
 
 		return c.Next()
 	}
 }
+
+// OptionalUserAuth identifies the user when a valid token (or an API key with
+// the read scope) is sent but lets anonymous requests, and requests with bad
+// credentials, through unchanged.
+func OptionalUserAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if p, err := authenticate(c); err == nil && p.allows([]string{"read"}) {
+			c.Locals("user_id", p.userID)
+			c.Locals("username", p.username)
+		}
+
+		return c.Next()
+	}
+}
+
+func authenticate(c *fiber.Ctx) (principal, error) {
+	authHeader := c.Get("Authorization")
+	if authHeader == "" {
+		return principal{}, errMissingAuth
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == authHeader {
+		return principal{}, errAuthFormat
+	}
+
+	if strings.HasPrefix(tokenString, utils.APIKeyPrefix) {
+		return parseAPIKey(tokenString)
+	}
+
+	userID, username, err := parseUserToken(tokenString)
+	return principal{userID: userID, username: username}, err
+}
+
+// parseAPIKey looks up an API key by its hash and records when it was last
+// used, at most once a minute per key.
+func parseAPIKey(key string) (principal, error) {
+	var p principal
+	var keyID int64
+	var scopes string
+	var expiresAt *time.Time
+	err := database.DB.QueryRow(`
+		SELECT api_keys.id, api_keys.scopes, api_keys.expires_at, users.id, users.username
+		FROM api_keys JOIN users ON users.id = api_keys.user_id
+		WHERE api_keys.key_hash = ?`, utils.HashToken(key),
+	).Scan(&keyID, &scopes, &expiresAt, &p.userID, &p.username)
+	if err != nil && err != sql.ErrNoRows {
+		authLog.Error("Failed to look up API key", "err", err)
+	}
+	if err != nil || (expiresAt != nil && time.Now().After(*expiresAt)) {
+		return principal{}, errInvalidKey
+	}
+
+	if _, err := database.DB.Exec(`
+		UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND (last_used_at IS NULL OR last_used_at < datetime('now', '-1 minute'))`, keyID); err != nil {
+		authLog.Warn("Failed to record API key use", "key_id", keyID, "err", err)
+	}
+
+	p.scopes = strings.Split(scopes, ",")
+	return p, nil
+}
+
+func parseUserToken(tokenString string) (int64, string, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.AppConfig.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+
+	if err != nil || !token.Valid {
+		return 0, "", errInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, "", errInvalidClaims
+	}
+	// Typed tokens, such as two-factor challenges, are not access tokens
+	if _, typed := claims["typ"]; typed {
+		return 0, "", errInvalidToken
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, "", errInvalidClaims
+	}
+	if _, ok := claims["username"].(string); !ok {
+		return 0, "", errInvalidClaims
+	}
+	// Tokens issued before versioning carry no tv claim and count as 0
+	version, _ := claims["tv"].(float64)
+
+	// The account must still exist and the token must not predate the last
+	// password change
+	var username string
+	var current int64
+	err = database.DB.QueryRow("SELECT username, token_version FROM users WHERE id = ?", int64(userID)).Scan(&username, &current)
+	if err != nil && err != sql.ErrNoRows {
+		authLog.Error("Failed to look up token user", "user_id", int64(userID), "err", err)
+	}
+	if err != nil || int64(version) != current {
+		return 0, "", errInvalidToken
+	}
+
+	return int64(userID), username, nil
+}
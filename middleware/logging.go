@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"hyw-webpics/logging"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+var httpLog = logging.For("http")
+
+// maxRequestIDLength bounds a client supplied X-Request-ID.
+const maxRequestIDLength = 64
+
+// RequestID tags every request with an ID, kept from the X-Request-ID header
+// when a proxy already set a sane one, and echoes it in the response. Log
+// lines written through logging.Request carry it.
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(fiber.HeaderXRequestID)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		c.Locals("request_id", id)
+		c.Set(fiber.HeaderXRequestID, id)
+		return c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// AccessLog writes one line per request to the http subsystem: server
+// errors at error level, client errors at warn, the rest at info.
+func AccessLog() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			if e, ok := err.(*fiber.Error); ok {
+				status = e.Code
+			}
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		case c.Path() == "/healthz" || c.Path() == "/readyz":
+			// Probes run every few seconds and would drown everything else
+			level = slog.LevelDebug
+		}
+
+		// Reading the body of a streamed response would consume it, so
+		// those report the length they were sent with
+		size := c.Response().Header.ContentLength()
+		if !c.Response().IsBodyStream() {
+			size = len(c.Response().Body())
+		}
+
+		attrs := []any{
+			"method", c.Method(),
+			"path", c.Path(),
+			"route", c.Route().Path,
+			"status", status,
+			"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"ip", c.IP(),
+			"bytes", size,
+		}
+		if err != nil {
+			attrs = append(attrs, "err", err)
+		}
+		logging.Request(c, httpLog).Log(c.UserContext(), level, "request", attrs...)
+		return err
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"strconv"
+	"strings"
+	"time"
+
+	"hyw-webpics/config"
+	"hyw-webpics/metrics"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Metrics counts and times every request by its route pattern, so the
+// labels stay bounded no matter which IDs are requested.
+func Metrics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		// The error handler sets the status after the middleware returns
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			if e, ok := err.(*fiber.Error); ok {
+				status = e.Code
+			}
+		}
+
+		method, route, code := c.Method(), c.Route().Path, strconv.Itoa(status)
+		metrics.HTTPRequests.Inc(method, route, code)
+		metrics.HTTPDuration.Since(start, method, route, code)
+		return err
+	}
+}
+
+// MetricsAuth requires the METRICS_TOKEN bearer token when one is set.
+func MetricsAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := config.AppConfig.MetricsToken
+		if token == "" {
+			return c.Next()
+		}
+
+		given, bearer := strings.CutPrefix(c.Get("Authorization"), "Bearer ")
+		if !bearer || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid metrics token"})
+		}
+		return c.Next()
+	}
+}
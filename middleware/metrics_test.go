@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"hyw-webpics/config"
+	"hyw-webpics/metrics"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMetricsAuth(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	if _, err := config.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	app.Get("/metrics", MetricsAuth(), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	tests := []struct {
+		token         string
+		authorization string
+		status        int
+	}{
+		{"", "", fiber.StatusNoContent},
+		{"s3cret", "", fiber.StatusUnauthorized},
+		{"s3cret", "Bearer wrong", fiber.StatusUnauthorized},
+		{"s3cret", "Bearer ", fiber.StatusUnauthorized},
+		{"s3cret", "s3cret", fiber.StatusUnauthorized},
+		{"s3cret", "Basic s3cret", fiber.StatusUnauthorized},
+		{"s3cret", "Bearer s3cret", fiber.StatusNoContent},
+	}
+	for _, tt := range tests {
+		config.AppConfig.MetricsToken = tt.token
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("token %q, Authorization %q: status %d, want %d", tt.token, tt.authorization, resp.StatusCode, tt.status)
+		}
+	}
+}
+
+func TestMetricsLabelsByRoute(t *testing.T) {
+	app := fiber.New()
+	app.Use(Metrics())
+	app.Get("/test-metrics/:id", func(c *fiber.Ctx) error {
+		if c.Params("id") == "missing" {
+			return fiber.ErrNotFound
+		}
+		return c.SendString("ok")
+	})
+	for _, path := range []string{"/test-metrics/1", "/test-metrics/2", "/test-metrics/missing"} {
+		if _, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	metrics.Write(&buf)
+	out := buf.String()
+	for _, want := range []string{
+		`webpics_http_requests_total{method="GET",route="/test-metrics/:id",status="200"} 2`,
+		`webpics_http_requests_total{method="GET",route="/test-metrics/:id",status="404"} 1`,
+		`webpics_http_request_duration_seconds_count{method="GET",route="/test-metrics/:id",status="200"} 2`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("metrics have no line %s", want)
+		}
+	}
+	for _, raw := range []string{"/test-metrics/1", "/test-metrics/2", "/test-metrics/missing"} {
+		if strings.Contains(out, `"`+raw+`"`) {
+			t.Errorf("metrics are labelled by the raw path %s", raw)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+	"hyw-webpics/logging"
+	"hyw-webpics/ratelimit"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var limitLog = logging.For("ratelimit")
+
+var limitStore struct {
+	once sync.Once
+	s    ratelimit.Store
+}
+
+// store returns the rate limit store chosen by RATE_LIMIT_STORE. The memory
+// store is per process; the SQLite one is shared through the database.
+func store() ratelimit.Store {
+	limitStore.once.Do(func() {
+		if config.AppConfig.RateLimitStore == "sqlite" {
+			limitStore.s = ratelimit.NewSQLiteStore(database.DB)
+		} else {
+			limitStore.s = ratelimit.NewMemoryStore()
+		}
+	})
+	return limitStore.s
+}
+
+// RandomRateLimit limits the random image endpoints per client IP so they
+// cannot be used to scrape the whole library. All routes using it share one
+// budget.
+func RandomRateLimit() fiber.Handler {
+	return limitBy("random", ratelimit.Limit{Burst: config.AppConfig.RandomRateLimit, Per: time.Minute}, byIP)
+}
+
+// CommentRateLimit limits how often a signed-in user can post comments. It
+// must run after UserAuth.
+func CommentRateLimit() fiber.Handler {
+	return limitBy("comment", ratelimit.Limit{Burst: config.AppConfig.CommentRateLimit, Per: time.Minute}, byUser)
+}
+
+// ReportRateLimit limits how often a client can report images, per user when
+// signed in and per IP otherwise. It must run after OptionalUserAuth.
+func ReportRateLimit() fiber.Handler {
+	return limitBy("report", ratelimit.Limit{Burst: config.AppConfig.ReportRateLimit, Per: time.Hour}, func(c *fiber.Ctx) string {
+		if userID, ok := c.Locals("user_id").(int64); ok {
+			return "u:" + strconv.FormatInt(userID, 10)
+		}
+		return "ip:" + c.IP()
+	})
+}
+
+// TwoFactorRateLimit limits second-factor attempts per client IP so the six
+// digit codes cannot be brute forced.
+func TwoFactorRateLimit() fiber.Handler {
+	return limitBy("2fa", ratelimit.Limit{Burst: config.AppConfig.TwoFactorRateLimit, Per: 5 * time.Minute}, byIP)
+}
+
+// LoginRateLimit limits password sign-in attempts per client IP, for users
+// and the admin alike. Failures also lock the account out, see LoginLockedFor.
+func LoginRateLimit() fiber.Handler {
+	return limitBy("login", ratelimit.Limit{Burst: config.AppConfig.LoginRateLimit, Per: time.Minute}, byIP)
+}
+
+// RegisterRateLimit limits how many accounts a client IP can create.
+func RegisterRateLimit() fiber.Handler {
+	return limitBy("register", ratelimit.Limit{Burst: config.AppConfig.RegisterRateLimit, Per: time.Hour}, byIP)
+}
+
+// UploadRateLimit limits upload requests per user. It must run after
+// UserAuth.
+func UploadRateLimit() fiber.Handler {
+	return limitBy("upload", ratelimit.Limit{Burst: config.AppConfig.UploadRateLimit, Per: time.Hour}, byUser)
+}
+
+func byIP(c *fiber.Ctx) string {
+	return c.IP()
+}
+
+func byUser(c *fiber.Ctx) string {
+	userID, _ := c.Locals("user_id").(int64)
+	return strconv.FormatInt(userID, 10)
+}
+
+// limitBy rejects requests over the limit with 429 and a Retry-After header.
+// Each name is a separate budget. If the store fails, requests are let
+// through rather than taking the site down with it.
+func limitBy(name string, limit ratelimit.Limit, key func(c *fiber.Ctx) string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		d, err := store().Take(name+":"+key(c), limit, time.Now())
+		if err != nil {
+			logging.Request(c, limitLog).Error("Rate limit store failed, letting request through", "limit", name, "err", err)
+			return c.Next()
+		}
+		c.Set("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+		if !d.Allowed {
+			return TooManyRequests(c, d.RetryAfter, "Too many requests")
+		}
+		return c.Next()
+	}
+}
+
+// TooManyRequests responds with 429 and a Retry-After header rounded up to
+// whole seconds.
+func TooManyRequests(c *fiber.Ctx, retry time.Duration, msg string) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int((retry+time.Second-1)/time.Second)))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error": msg,
+	})
+}
+
+func loginLockout() ratelimit.Lockout {
+	return ratelimit.Lockout{
+		Threshold: config.AppConfig.LockoutThreshold,
+		Base:      time.Duration(config.AppConfig.LockoutMins) * time.Minute,
+		Max:       time.Duration(config.AppConfig.LockoutMaxMins) * time.Minute,
+		Window:    24 * time.Hour,
+	}
+}
+
+// LoginLockedFor returns how much longer key, an account being signed in
+// to, is locked out after failed attempts.
+func LoginLockedFor(key string) time.Duration {
+	until, err := store().LockedUntil("lockout:"+key, time.Now())
+	if err != nil {
+		limitLog.Error("Failed to read login lockout", "key", key, "err", err)
+		return 0
+	}
+	if wait := time.Until(until); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// LoginFailed records a failed sign-in to key. Once there are enough in a
+// row, key is locked out for progressively longer.
+func LoginFailed(key string) {
+	if _, err := store().Fail("lockout:"+key, loginLockout(), time.Now()); err != nil {
+		limitLog.Error("Failed to record failed login", "key", key, "err", err)
+	}
+}
+
+// LoginSucceeded clears key's failed sign-ins.
+func LoginSucceeded(key string) {
+	if err := store().Reset("lockout:" + key); err != nil {
+		limitLog.Error("Failed to clear failed logins", "key", key, "err", err)
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"hyw-webpics/config"
+	"hyw-webpics/ratelimit"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestLimitByRetryAfter(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	if _, err := config.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	app.Get("/", limitBy("test-retry-after", ratelimit.Limit{Burst: 2, Per: time.Minute}, byIP), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	tests := []struct {
+		status     int
+		remaining  string
+		retryAfter string
+	}{
+		{fiber.StatusNoContent, "1", ""},
+		{fiber.StatusNoContent, "0", ""},
+		// A token takes 30s to refill; the wait is rounded up to whole seconds
+		{fiber.StatusTooManyRequests, "0", "30"},
+	}
+	for i, tt := range tests {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("request %d: status %d, want %d", i+1, resp.StatusCode, tt.status)
+		}
+		if got := resp.Header.Get("X-RateLimit-Remaining"); got != tt.remaining {
+			t.Errorf("request %d: X-RateLimit-Remaining %q, want %q", i+1, got, tt.remaining)
+		}
+		if got := resp.Header.Get(fiber.HeaderRetryAfter); got != tt.retryAfter {
+			t.Errorf("request %d: Retry-After %q, want %q", i+1, got, tt.retryAfter)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type Collection struct {
+	ID          int64     `json:"id"`
+	UserID      int64     `json:"user_id"`
+	Name        string    `json:"name"`
+	Slug        string    `json:"slug"`
+	Description string    `json:"description"`
+	Visibility  string    `json:"visibility"`
+	ImageCount  int       `json:"image_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
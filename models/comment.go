@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+type Comment struct {
+	ID        int64      `json:"id"`
+	ImageID   int64      `json:"image_id"`
+	UserID    int64      `json:"user_id"`
+	Username  string     `json:"username"`
+	ParentID  *int64     `json:"parent_id"`
+	Body      string     `json:"body"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	Replies   []Comment  `json:"replies,omitempty"`
+}
+
+// ModerationAction is an audit record of a moderator decision.
+type ModerationAction struct {
+	ID         int64     `json:"id"`
+	Moderator  string    `json:"moderator"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"target_type"`
+	TargetID   int64     `json:"target_id"`
+	ImageID    *int64    `json:"image_id"`
+	Reason     string    `json:"reason"`
+	Details    string    `json:"details"`
+	CreatedAt  time.Time `json:"created_at"`
+}
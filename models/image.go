@@ -3,12 +3,22 @@ package models
 import "time"
 
 type Image struct {
-	ID           int64      `json:"id"`
-	Filename     string     `json:"filename"`
-	OriginalName string     `json:"original_name"`
-	UploaderID   int64      `json:"uploader_id"`
-	CategoryID   *int64     `json:"category_id"`
-	Status       string     `json:"status"`
-	CreatedAt    time.Time  `json:"created_at"`
-	ApprovedAt   *time.Time `json:"approved_at,omitempty"`
+	ID            int64        `json:"id"`
+	Filename      string       `json:"filename"`
+	OriginalName  string       `json:"original_name"`
+	Title         string       `json:"title"`
+	Tags          []string     `json:"tags"`
+	OCRText       string       `json:"ocr_text"`
+	Animated      bool         `json:"animated"`
+	UploaderID    int64        `json:"uploader_id"`
+	Uploader      *UserSummary `json:"uploader,omitempty"`
+	CategoryID    *int64       `json:"category_id"`
+	Status        string       `json:"status"`
+	CreatedAt     time.Time    `json:"created_at"`
+	ApprovedAt    *time.Time   `json:"approved_at,omitempty"`
+	FavoriteCount int64        `json:"favorite_count"`
+	ViewCount     int64        `json:"view_count"`
+	ShareCount    int64        `json:"share_count"`
+	CommentCount  int64        `json:"comment_count"`
+	Favorited     *bool        `json:"favorited,omitempty"` // only set for signed-in requests
 }
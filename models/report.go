@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type Report struct {
+	ID         int64      `json:"id"`
+	ImageID    int64      `json:"image_id"`
+	UserID     *int64     `json:"user_id"`
+	Reason     string     `json:"reason"`
+	Details    string     `json:"details"`
+	Status     string     `json:"status"`
+	Resolution string     `json:"resolution,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
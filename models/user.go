@@ -3,8 +3,37 @@ package models
 import "time"
 
 type User struct {
-	ID        int64     `json:"id"`
-	Username  string    `json:"username"`
-	Password  string    `json:"-"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          int64     `json:"id"`
+	Username    string    `json:"username"`
+	Password    string    `json:"-"`
+	DisplayName string    `json:"display_name"`
+	Avatar      string    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// UserSummary is the uploader information embedded in image responses.
+type UserSummary struct {
+	ID          int64  `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+}
+
+// UserProfile is the public profile of a user.
+type UserProfile struct {
+	UserSummary
+	JoinedAt        time.Time `json:"joined_at"`
+	ApprovedUploads int       `json:"approved_uploads"`
+}
+
+// APIKey describes a personal API key. The secret itself is only returned
+// once, when the key is created.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
 }
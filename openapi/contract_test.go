@@ -0,0 +1,447 @@
+package openapi_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+	"hyw-webpics/handlers"
+	"hyw-webpics/openapi"
+	"hyw-webpics/server"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func setup(t *testing.T) (app, metricsApp *fiber.App) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("DATABASE_PATH", filepath.Join(dir, "test.db"))
+	t.Setenv("UPLOAD_DIR", filepath.Join(dir, "uploads"))
+	t.Setenv("BACKUP_DIR", filepath.Join(dir, "backups"))
+	if _, err := config.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	database.Connect()
+	t.Cleanup(database.Close)
+	return server.New()
+}
+
+func TestRoutesMatchSpec(t *testing.T) {
+	app, metricsApp := setup(t)
+	var routes []string
+	for _, a := range []*fiber.App{app, metricsApp} {
+		if a == nil {
+			continue
+		}
+		for _, r := range a.GetRoutes(true) {
+			routes = append(routes, r.Method+" "+r.Path)
+		}
+	}
+	for _, problem := range openapi.Check(routes) {
+		t.Error(problem)
+	}
+}
+
+// exchange is one request made against the real handlers. Its response is
+// validated against the schema the spec documents for the operation.
+type exchange struct {
+	method, path string // path as requested
+	route        string // path as listed in Operations
+	token        string
+	body         interface{}
+	status       int
+	save         string // placeholder set from the response, e.g. "{slug}"
+}
+
+func TestResponsesMatchSpec(t *testing.T) {
+	app, _ := setup(t)
+	spec := decodeSpec(t)
+
+	if _, err := handlers.CreateUser("admin", "password123", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	bobID, err := handlers.CreateUser("bob", "password123", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Files are not needed to list images, so rows stand in for uploads
+	for i, status := range []string{"approved", "approved", "pending"} {
+		if _, err := database.DB.Exec(
+			"INSERT INTO images (filename, original_name, title, uploader_id, category_id, status, approved_at) VALUES (?, ?, ?, ?, 1, ?, CASE WHEN ? = 'approved' THEN CURRENT_TIMESTAMP END)",
+			fmt.Sprintf("img%d.webp", i), fmt.Sprintf("cat %d.png", i), "cat picture", bobID, status, status,
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	do := func(e exchange) []byte {
+		t.Helper()
+		var body io.Reader
+		if e.body != nil {
+			data, _ := json.Marshal(e.body)
+			body = bytes.NewReader(data)
+		}
+		req := httptest.NewRequest(e.method, e.path, body)
+		req.Header.Set("Content-Type", "application/json")
+		if e.token != "" {
+			req.Header.Set("Authorization", "Bearer "+e.token)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != e.status {
+			t.Fatalf("%s %s = %d, want %d: %s", e.method, e.path, resp.StatusCode, e.status, data)
+		}
+		return data
+	}
+	login := func(username string) string {
+		var s struct {
+			Token string `json:"token"`
+		}
+		data := do(exchange{method: "POST", path: "/api/auth/login", body: handlers.LoginRequest{Username: username, Password: "password123"}, status: 200})
+		if err := json.Unmarshal(data, &s); err != nil {
+			t.Fatal(err)
+		}
+		return s.Token
+	}
+	admin, bob := login("admin"), login("bob")
+
+	exchanges := []exchange{
+		{method: "POST", path: "/api/auth/register", body: handlers.RegisterRequest{Username: "carol", Password: "password123"}, status: 201},
+		{method: "POST", path: "/api/auth/login", body: handlers.LoginRequest{Username: "carol", Password: "password123"}, status: 200},
+		{method: "GET", path: "/api/auth/me", token: bob, status: 200},
+		{method: "POST", path: "/api/admin/login", body: handlers.AdminLoginRequest{Password: "admin123"}, status: 200},
+		{method: "GET", path: "/api/images", route: "/api/images/", token: bob, status: 200},
+		{method: "GET", path: "/api/images?cursor=&sort=most-liked&limit=1", route: "/api/images/", status: 200},
+		{method: "GET", path: "/api/images/random", status: 200},
+		{method: "GET", path: "/api/images/random?count=2", status: 200},
+		{method: "GET", path: "/api/images/search?q=cat", status: 200},
+		{method: "GET", path: "/api/images/trending", status: 200},
+		{method: "GET", path: "/api/images/1", route: "/api/images/:id", token: bob, status: 200},
+		{method: "POST", path: "/api/images/1/share", route: "/api/images/:id/share", status: 200},
+		{method: "POST", path: "/api/images/1/favorite", route: "/api/images/:id/favorite", token: bob, status: 200},
+		{method: "POST", path: "/api/images/1/comments", route: "/api/images/:id/comments", token: bob, body: handlers.CommentRequest{Body: "nice"}, status: 201},
+		{method: "GET", path: "/api/images/1/comments", route: "/api/images/:id/comments", status: 200},
+		{method: "PUT", path: "/api/comments/1", route: "/api/comments/:id", token: bob, body: handlers.CommentRequest{Body: "very nice"}, status: 200},
+		{method: "POST", path: "/api/images/2/report", route: "/api/images/:id/report", token: bob, body: handlers.ReportRequest{Reason: "spam"}, status: 200},
+		{method: "GET", path: "/api/me/favorites", token: bob, status: 200},
+		{method: "DELETE", path: "/api/images/1/favorite", route: "/api/images/:id/favorite", token: bob, status: 200},
+		{method: "GET", path: "/api/me/quota", token: bob, status: 200},
+		{method: "PUT", path: "/api/me/profile", token: bob, body: map[string]string{"display_name": "Bob"}, status: 200},
+		{method: "DELETE", path: "/api/me/avatar", token: bob, status: 200},
+		{method: "POST", path: "/api/me/api-keys", token: bob, body: handlers.CreateAPIKeyRequest{Name: "bot", Scopes: []string{"read"}}, status: 201, save: "{key}"},
+		{method: "GET", path: "/api/me/api-keys", token: bob, status: 200},
+		{method: "GET", path: "/api/me/2fa", token: bob, status: 200},
+		{method: "POST", path: "/api/me/2fa/setup", token: bob, status: 200},
+		{method: "POST", path: "/api/collections", route: "/api/collections/", token: bob, body: map[string]string{"name": "Cats", "visibility": "public"}, status: 201, save: "{slug}"},
+		{method: "POST", path: "/api/collections/{slug}/images", route: "/api/collections/:slug/images", token: bob, body: handlers.CollectionImageRequest{ImageID: 1}, status: 200},
+		{method: "GET", path: "/api/collections", route: "/api/collections/", status: 200},
+		{method: "GET", path: "/api/me/collections", token: bob, status: 200},
+		{method: "GET", path: "/api/collections/{slug}", route: "/api/collections/:slug", status: 200},
+		{method: "PUT", path: "/api/collections/{slug}", route: "/api/collections/:slug", token: bob, body: map[string]string{"description": "Only cats"}, status: 200},
+		{method: "GET", path: "/api/users/bob", route: "/api/users/:username", status: 200},
+		{method: "GET", path: "/api/users/bob/images", route: "/api/users/:username/images", status: 200},
+		{method: "GET", path: "/api/categories", status: 200},
+		{method: "GET", path: "/api/admin/stats", token: admin, status: 200},
+		{method: "GET", path: "/api/admin/pending", token: admin, status: 200},
+		{method: "GET", path: "/api/admin/images?status=pending", route: "/api/admin/images", token: admin, status: 200},
+		{method: "GET", path: "/api/admin/comments", token: admin, status: 200},
+		{method: "POST", path: "/api/admin/comments/1/hide", route: "/api/admin/comments/:id/hide", token: admin, body: handlers.ModerationRequest{Reason: "test"}, status: 200},
+		{method: "GET", path: "/api/admin/moderation", token: admin, status: 200},
+		{method: "GET", path: "/api/admin/reports", token: admin, status: 200},
+		{method: "GET", path: "/api/admin/reports/images/2", route: "/api/admin/reports/images/:id", token: admin, status: 200},
+		{method: "PUT", path: "/api/admin/images/1/text", route: "/api/admin/images/:id/text", token: admin, body: handlers.UpdateImageTextRequest{Text: "meow"}, status: 200},
+		{method: "POST", path: "/api/admin/approve/3", route: "/api/admin/approve/:id", token: admin, body: handlers.ApproveRequest{CategoryID: 1}, status: 200},
+		{method: "POST", path: "/api/admin/bulk-approve", token: admin, body: map[string]interface{}{"ids": []int64{3}, "category_id": 1}, status: 200},
+		{method: "POST", path: "/api/admin/categories", token: admin, body: handlers.CreateCategoryRequest{Name: "Dogs", Slug: "dogs"}, status: 201, save: "{category}"},
+		{method: "PUT", path: "/api/admin/users/bob/role", route: "/api/admin/users/:username/role", token: admin, body: handlers.SetUserRoleRequest{Role: "moderator"}, status: 200},
+		{method: "GET", path: "/api/admin/backups", token: admin, status: 200},
+		{method: "PUT", path: "/api/admin/categories/{category}", route: "/api/admin/categories/:id", token: admin, body: handlers.CreateCategoryRequest{Name: "Puppies", Slug: "puppies"}, status: 200},
+		{method: "DELETE", path: "/api/admin/categories/{category}", route: "/api/admin/categories/:id", token: admin, status: 200},
+		{method: "POST", path: "/api/admin/comments/1/unhide", route: "/api/admin/comments/:id/unhide", token: admin, body: handlers.ModerationRequest{}, status: 200},
+		{method: "POST", path: "/api/admin/reports/images/2/resolve", route: "/api/admin/reports/images/:id/resolve", token: admin, body: handlers.ResolveReportsRequest{Action: "dismiss"}, status: 200},
+		{method: "PUT", path: "/api/collections/{slug}/order", route: "/api/collections/:slug/order", token: bob, body: handlers.ReorderCollectionRequest{ImageIDs: []int64{1}}, status: 200},
+		{method: "DELETE", path: "/api/collections/{slug}/images/1", route: "/api/collections/:slug/images/:imageId", token: bob, status: 200},
+		{method: "DELETE", path: "/api/collections/{slug}", route: "/api/collections/:slug", token: bob, status: 200},
+		{method: "DELETE", path: "/api/me/api-keys/{key}", route: "/api/me/api-keys/:id", token: bob, status: 200},
+		{method: "DELETE", path: "/api/comments/1", route: "/api/comments/:id", token: bob, status: 200},
+		{method: "POST", path: "/api/admin/reject/3", route: "/api/admin/reject/:id", token: admin, status: 200},
+		{method: "DELETE", path: "/api/admin/images/2", route: "/api/admin/images/:id", token: admin, status: 200},
+		{method: "POST", path: "/api/admin/bulk-delete", token: admin, body: handlers.BulkActionRequest{IDs: []int64{1}}, status: 200},
+		{method: "POST", path: "/api/auth/logout-all", token: bob, status: 200},
+		{method: "GET", path: "/healthz", status: 200},
+		// Errors use the envelope
+		{method: "GET", path: "/api/images/999", route: "/api/images/:id", status: 404},
+	}
+
+	// Slugs and IDs of things created along the way fill in later paths
+	saved := map[string]string{}
+	covered := map[string]bool{}
+	for _, e := range exchanges {
+		for placeholder, v := range saved {
+			e.path = strings.ReplaceAll(e.path, placeholder, v)
+		}
+		route := e.route
+		if route == "" {
+			route, _, _ = strings.Cut(e.path, "?")
+		}
+		op, ok := spec.operation(e.method, route)
+		if !ok {
+			t.Errorf("%s %s is not in the spec", e.method, route)
+			continue
+		}
+		covered[e.method+" "+route] = true
+
+		data := do(e)
+		schema := op.success
+		if e.status >= 400 {
+			schema = op.errorSchema
+		}
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			t.Errorf("%s %s: response is not JSON: %v", e.method, e.path, err)
+			continue
+		}
+		for _, problem := range spec.validate(schema, value, "") {
+			t.Errorf("%s %s: %s", e.method, e.path, problem)
+		}
+		if created, ok := value.(map[string]interface{}); ok && e.save != "" {
+			if slug, ok := created["slug"].(string); ok && e.save == "{slug}" {
+				saved[e.save] = slug
+			} else {
+				saved[e.save] = fmt.Sprint(created["id"])
+			}
+		}
+	}
+	t.Logf("validated responses of %d of %d operations", len(covered), len(openapi.Operations))
+}
+
+// document is the parts of the generated spec the test reads.
+type document struct {
+	Paths      map[string]map[string]operationDoc `json:"paths"`
+	Components struct {
+		Schemas map[string]map[string]interface{} `json:"schemas"`
+	} `json:"components"`
+}
+
+type operationDoc struct {
+	Responses map[string]struct {
+		Content map[string]struct {
+			Schema map[string]interface{} `json:"schema"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+type resolved struct {
+	success, errorSchema map[string]interface{}
+}
+
+func decodeSpec(t *testing.T) *document {
+	t.Helper()
+	var doc document
+	if err := json.Unmarshal(openapi.JSON(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return &doc
+}
+
+func (d *document) operation(method, route string) (resolved, bool) {
+	path := openapi.Operation{Path: route}.OpenAPIPath()
+	op, ok := d.Paths[path][strings.ToLower(method)]
+	if !ok {
+		return resolved{}, false
+	}
+	var r resolved
+	for status, resp := range op.Responses {
+		media, ok := resp.Content["application/json"]
+		if !ok {
+			continue
+		}
+		if status == "default" {
+			r.errorSchema = media.Schema
+		} else {
+			r.success = media.Schema
+		}
+	}
+	return r, true
+}
+
+func (d *document) resolve(schema map[string]interface{}) map[string]interface{} {
+	for {
+		ref, ok := schema["$ref"].(string)
+		if !ok {
+			return schema
+		}
+		schema = d.Components.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")]
+	}
+}
+
+// object merges the properties and required fields of an object schema and
+// of everything it includes with allOf.
+func (d *document) object(schema map[string]interface{}) (map[string]interface{}, []string) {
+	schema = d.resolve(schema)
+	properties := map[string]interface{}{}
+	var required []string
+	if parts, ok := schema["allOf"].([]interface{}); ok {
+		for _, part := range parts {
+			p, r := d.object(part.(map[string]interface{}))
+			for k, v := range p {
+				properties[k] = v
+			}
+			required = append(required, r...)
+		}
+	}
+	if p, ok := schema["properties"].(map[string]interface{}); ok {
+		for k, v := range p {
+			properties[k] = v
+		}
+	}
+	if r, ok := schema["required"].([]interface{}); ok {
+		for _, name := range r {
+			required = append(required, name.(string))
+		}
+	}
+	return properties, required
+}
+
+// validate reports where value does not match schema: wrong types, missing
+// required fields and fields the schema does not document.
+func (d *document) validate(schema map[string]interface{}, value interface{}, at string) []string {
+	if schema == nil {
+		return []string{at + ": no schema documented"}
+	}
+	schema = d.resolve(schema)
+	if value == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		if parts, ok := schema["allOf"].([]interface{}); ok && len(parts) == 1 && schema["nullable"] == true {
+			return nil
+		}
+		return []string{at + ": null where the schema is not nullable"}
+	}
+	if alternatives, ok := schema["oneOf"].([]interface{}); ok {
+		var all []string
+		for _, alt := range alternatives {
+			problems := d.validate(alt.(map[string]interface{}), value, at)
+			if len(problems) == 0 {
+				return nil
+			}
+			all = append(all, problems...)
+		}
+		return append([]string{at + ": matches no alternative of oneOf"}, all...)
+	}
+	if parts, ok := schema["allOf"].([]interface{}); ok && schema["properties"] == nil && len(parts) == 1 {
+		if _, isObject := value.(map[string]interface{}); !isObject {
+			return d.validate(parts[0].(map[string]interface{}), value, at)
+		}
+	}
+
+	typ, _ := schema["type"].(string)
+	if typ == "" && schema["allOf"] != nil {
+		typ = "object"
+	}
+	switch typ {
+	case "string":
+		if _, ok := value.(string); !ok {
+			return []string{fmt.Sprintf("%s: %T, want string", at, value)}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{fmt.Sprintf("%s: %T, want boolean", at, value)}
+		}
+	case "number", "integer":
+		n, ok := value.(float64)
+		if !ok {
+			return []string{fmt.Sprintf("%s: %T, want %s", at, value, typ)}
+		}
+		if typ == "integer" && n != math.Trunc(n) {
+			return []string{fmt.Sprintf("%s: %v, want integer", at, n)}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: %T, want array", at, value)}
+		}
+		var problems []string
+		for i, item := range items {
+			problems = append(problems, d.validate(schema["items"].(map[string]interface{}), item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+		return problems
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: %T, want object", at, value)}
+		}
+		if extra, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+			var problems []string
+			for k, v := range obj {
+				problems = append(problems, d.validate(extra, v, at+"."+k)...)
+			}
+			return problems
+		}
+		properties, required := d.object(schema)
+		var problems []string
+		for _, name := range required {
+			if _, ok := obj[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing required field %q", at, name))
+			}
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			prop, ok := properties[k]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s: undocumented field %q", at, k))
+				continue
+			}
+			problems = append(problems, d.validate(prop.(map[string]interface{}), obj[k], at+"."+k)...)
+		}
+		return problems
+	}
+	return nil
+}
+
+func TestValidateReportsDrift(t *testing.T) {
+	spec := decodeSpec(t)
+	op, ok := spec.operation("GET", "/api/categories")
+	if !ok {
+		t.Fatal("GET /api/categories is not in the spec")
+	}
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{"documented", `[{"id":1,"name":"Cats","slug":"cats"}]`, true},
+		{"undocumented field", `[{"id":1,"name":"Cats","slug":"cats","image_count":2}]`, false},
+		{"missing field", `[{"id":1,"name":"Cats"}]`, false},
+		{"wrong type", `[{"id":"1","name":"Cats","slug":"cats"}]`, false},
+		{"object for array", `{"categories":[]}`, false},
+	}
+	for _, tt := range tests {
+		var value interface{}
+		if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+			t.Fatal(err)
+		}
+		problems := spec.validate(op.success, value, "")
+		if (len(problems) == 0) != tt.ok {
+			t.Errorf("%s: problems = %q", tt.name, problems)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package openapi
+
+import (
+	_ "embed"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// docsPage renders /api/openapi.json in the browser. It is self-contained,
+// so the docs work offline and under a strict CSP.
+//
+//go:embed docs.html
+var docsPage []byte
+
+// ServeSpec responds with the OpenAPI document.
+func ServeSpec(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	return c.Send(JSON())
+}
+
+// ServeDocs responds with the documentation page.
+func ServeDocs(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Send(docsPage)
+}
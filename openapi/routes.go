@@ -0,0 +1,243 @@
+package openapi
+
+import (
+	"net/http"
+
+	"hyw-webpics/client"
+	"hyw-webpics/handlers"
+	"hyw-webpics/models"
+)
+
+var (
+	pageParams = []Param{
+		{Name: "page", Type: "integer", Description: "Page number, from 1"},
+		{Name: "limit", Type: "integer", Description: "Items per page"},
+	}
+	listingParams = append([]Param{
+		{Name: "sort", Description: "newest (default), oldest, random, most-liked or most-viewed"},
+		{Name: "seed", Type: "integer", Description: "Fixes the shuffle of random order"},
+		{Name: "cursor", Description: "Switches to cursor pagination; empty for the first page, then next_cursor"},
+	}, pageParams...)
+	randomParams = []Param{
+		{Name: "category_id", Type: "integer"},
+		{Name: "tag"},
+		{Name: "animated", Type: "boolean", Description: "Only animated or only still images"},
+		{Name: "redirect", Type: "boolean", Description: "Redirect to the image file"},
+	}
+)
+
+func withParams(params []Param, extra ...Param) []Param {
+	return append(append([]Param{}, params...), extra...)
+}
+
+// Operations lists every route the server registers, in the order of
+// main.go. Check fails when the two drift apart.
+var Operations = []Operation{
+	// Auth
+	{Method: http.MethodPost, Path: "/api/auth/register", Tag: "auth", Summary: "Create an account",
+		Body: handlers.RegisterRequest{}, Required: []string{"username", "password"}, Response: client.Registration{}, Status: http.StatusCreated},
+	{Method: http.MethodPost, Path: "/api/auth/login", Tag: "auth", Summary: "Sign in; accounts with two-factor authentication get a challenge",
+		Body: handlers.LoginRequest{}, Required: []string{"username", "password"}, Response: client.Session{}},
+	{Method: http.MethodPost, Path: "/api/auth/login/2fa", Tag: "auth", Summary: "Complete a sign-in with a TOTP or recovery code",
+		Body: handlers.LoginTwoFactorRequest{}, Required: []string{"challenge", "code"}, Response: client.Session{}},
+	{Method: http.MethodPost, Path: "/api/auth/refresh", Tag: "auth", Summary: "Exchange a refresh token for new tokens",
+		Body: handlers.RefreshRequest{}, Required: []string{"refresh_token"}, Response: client.Session{}},
+	{Method: http.MethodPost, Path: "/api/auth/logout", Tag: "auth", Summary: "Revoke a refresh token",
+		Body: handlers.RefreshRequest{}, Required: []string{"refresh_token"}, Response: client.Message{}},
+	{Method: http.MethodPost, Path: "/api/auth/logout-all", Tag: "auth", Summary: "Revoke every session of the current user",
+		Auth: User, Response: client.Message{}},
+	{Method: http.MethodGet, Path: "/api/auth/me", Tag: "auth", Summary: "The current user",
+		Auth: User, Scopes: []string{"read"}, Response: models.UserSummary{}},
+
+	// Images
+	{Method: http.MethodPost, Path: "/api/images/upload", Tag: "images", Summary: "Upload images for review",
+		Auth: User, Scopes: []string{"upload"}, Form: []Param{
+			{Name: "images", Type: "file", Description: "One or more image files", Required: true},
+			{Name: "title"},
+			{Name: "tags", Description: "Comma-separated"},
+			{Name: "category_id", Type: "integer"},
+		}, Response: client.UploadResult{}, Status: http.StatusCreated},
+	{Method: http.MethodGet, Path: "/api/images/", Tag: "images", Summary: "List approved images",
+		Auth: Optional, Query: withParams(listingParams, Param{Name: "category_id", Type: "integer"}), Response: client.ImagePage{}},
+	{Method: http.MethodGet, Path: "/api/images/random", Tag: "images", Summary: "Random approved images; a bare image unless count, session or seed is given",
+		Auth: Optional, Query: withParams(randomParams,
+			Param{Name: "count", Type: "integer", Description: "1 to 20"},
+			Param{Name: "session", Description: "Continues a walk that does not repeat images"},
+			Param{Name: "seed", Type: "integer", Description: "Starts a reproducible walk"},
+		), Response: OneOf{models.Image{}, client.RandomImages{}}},
+	{Method: http.MethodGet, Path: "/api/images/search", Tag: "images", Summary: "Search approved images by title, tags and text",
+		Auth: Optional, Query: withParams(pageParams,
+			Param{Name: "q", Required: true},
+			Param{Name: "category_id", Type: "integer"},
+		), Response: client.SearchResults{}},
+	{Method: http.MethodGet, Path: "/api/images/trending", Tag: "images", Summary: "The hottest images of a window",
+		Auth: Optional, Query: []Param{
+			{Name: "window", Description: "day (default), week or month"},
+			{Name: "limit", Type: "integer"},
+		}, Response: client.TrendingImages{}},
+	{Method: http.MethodGet, Path: "/api/images/:id", Tag: "images", Summary: "An approved image",
+		Auth: Optional, Response: models.Image{}},
+	{Method: http.MethodPost, Path: "/api/images/:id/share", Tag: "images", Summary: "Record a share",
+		Auth: Optional, Response: client.Message{}},
+	{Method: http.MethodPost, Path: "/api/images/:id/favorite", Tag: "images", Summary: "Favorite an image",
+		Auth: User, Scopes: []string{"favorite"}, Response: client.FavoriteState{}},
+	{Method: http.MethodDelete, Path: "/api/images/:id/favorite", Tag: "images", Summary: "Unfavorite an image",
+		Auth: User, Scopes: []string{"favorite"}, Response: client.FavoriteState{}},
+	{Method: http.MethodGet, Path: "/api/images/:id/comments", Tag: "comments", Summary: "An image's comment threads",
+		Query: pageParams, Response: client.CommentPage{}},
+	{Method: http.MethodPost, Path: "/api/images/:id/comments", Tag: "comments", Summary: "Comment on an image or reply to a comment",
+		Auth: User, Body: handlers.CommentRequest{}, Required: []string{"body"}, Response: models.Comment{}, Status: http.StatusCreated},
+	{Method: http.MethodPost, Path: "/api/images/:id/report", Tag: "images", Summary: "Report an image to the moderators",
+		Auth: Optional, Body: handlers.ReportRequest{}, Required: []string{"reason"}, Response: client.Message{}},
+
+	// Comments
+	{Method: http.MethodPut, Path: "/api/comments/:id", Tag: "comments", Summary: "Edit one of your comments",
+		Auth: User, Body: handlers.CommentRequest{}, Required: []string{"body"}, Response: models.Comment{}},
+	{Method: http.MethodDelete, Path: "/api/comments/:id", Tag: "comments", Summary: "Delete one of your comments",
+		Auth: User, Response: client.Message{}},
+
+	// Current user
+	{Method: http.MethodGet, Path: "/api/me/favorites", Tag: "me", Summary: "Your favorites",
+		Auth: User, Scopes: []string{"read", "favorite"}, Query: listingParams, Response: client.ImagePage{}},
+	{Method: http.MethodGet, Path: "/api/me/collections", Tag: "collections", Summary: "Your collections",
+		Auth: User, Scopes: []string{"read"}, Query: pageParams, Response: client.CollectionPage{}},
+	{Method: http.MethodGet, Path: "/api/me/quota", Tag: "me", Summary: "Your trust level and remaining upload quota",
+		Auth: User, Scopes: []string{"read", "upload"}, Response: client.Quota{}},
+	{Method: http.MethodDelete, Path: "/api/me/", Tag: "me", Summary: "Delete your account",
+		Auth: User, Body: handlers.DeleteAccountRequest{}, Required: []string{"password", "uploads"}, Response: client.AccountDeleted{}},
+	{Method: http.MethodPut, Path: "/api/me/password", Tag: "me", Summary: "Change your password, signing out other sessions",
+		Auth: User, Body: handlers.ChangePasswordRequest{}, Required: []string{"current_password", "new_password"}, Response: client.Session{}},
+	{Method: http.MethodPut, Path: "/api/me/profile", Tag: "me", Summary: "Set your display name",
+		Auth: User, Body: handlers.ProfileRequest{}, Response: models.UserSummary{}},
+	{Method: http.MethodPost, Path: "/api/me/avatar", Tag: "me", Summary: "Replace your avatar",
+		Auth: User, Form: []Param{{Name: "avatar", Type: "file", Required: true}}, Response: models.UserSummary{}},
+	{Method: http.MethodDelete, Path: "/api/me/avatar", Tag: "me", Summary: "Remove your avatar",
+		Auth: User, Response: models.UserSummary{}},
+	{Method: http.MethodGet, Path: "/api/me/api-keys", Tag: "me", Summary: "Your API keys",
+		Auth: User, Response: client.APIKeyList{}},
+	{Method: http.MethodPost, Path: "/api/me/api-keys", Tag: "me", Summary: "Create an API key; the key is only shown once",
+		Auth: User, Body: handlers.CreateAPIKeyRequest{}, Required: []string{"name", "scopes"}, Response: client.NewAPIKey{}, Status: http.StatusCreated},
+	{Method: http.MethodDelete, Path: "/api/me/api-keys/:id", Tag: "me", Summary: "Revoke an API key",
+		Auth: User, Response: client.Message{}},
+	{Method: http.MethodGet, Path: "/api/me/2fa", Tag: "me", Summary: "Your two-factor authentication status",
+		Auth: User, Response: client.TwoFactorStatus{}},
+	{Method: http.MethodPost, Path: "/api/me/2fa/setup", Tag: "me", Summary: "Start enabling two-factor authentication",
+		Auth: User, Response: client.TwoFactorSetup{}},
+	{Method: http.MethodPost, Path: "/api/me/2fa/enable", Tag: "me", Summary: "Confirm two-factor authentication with a code",
+		Auth: User, Body: handlers.TwoFactorCodeRequest{}, Required: []string{"code"}, Response: client.RecoveryCodes{}},
+	{Method: http.MethodPost, Path: "/api/me/2fa/disable", Tag: "me", Summary: "Turn two-factor authentication off",
+		Auth: User, Body: handlers.DisableTwoFactorRequest{}, Required: []string{"password", "code"}, Response: client.Message{}},
+	{Method: http.MethodPost, Path: "/api/me/2fa/recovery-codes", Tag: "me", Summary: "Replace your recovery codes",
+		Auth: User, Body: handlers.TwoFactorCodeRequest{}, Required: []string{"code"}, Response: client.RecoveryCodes{}},
+
+	// Users
+	{Method: http.MethodGet, Path: "/api/users/:username", Tag: "users", Summary: "A user's public profile",
+		Response: models.UserProfile{}},
+	{Method: http.MethodGet, Path: "/api/users/:username/images", Tag: "users", Summary: "A user's approved images",
+		Auth: Optional, Query: listingParams, Response: client.ImagePage{}},
+
+	// Collections
+	{Method: http.MethodGet, Path: "/api/collections/", Tag: "collections", Summary: "Public collections",
+		Query: pageParams, Response: client.CollectionPage{}},
+	{Method: http.MethodPost, Path: "/api/collections/", Tag: "collections", Summary: "Create a collection",
+		Auth: User, Body: handlers.CollectionRequest{}, Required: []string{"name"}, Response: models.Collection{}, Status: http.StatusCreated},
+	{Method: http.MethodGet, Path: "/api/collections/:slug", Tag: "collections", Summary: "A collection and a page of its images",
+		Auth: Optional, Query: pageParams, Response: client.CollectionDetail{}},
+	{Method: http.MethodPut, Path: "/api/collections/:slug", Tag: "collections", Summary: "Change one of your collections",
+		Auth: User, Body: handlers.CollectionRequest{}, Response: models.Collection{}},
+	{Method: http.MethodDelete, Path: "/api/collections/:slug", Tag: "collections", Summary: "Delete one of your collections",
+		Auth: User, Response: client.Message{}},
+	{Method: http.MethodPost, Path: "/api/collections/:slug/images", Tag: "collections", Summary: "Add an image to a collection",
+		Auth: User, Body: handlers.CollectionImageRequest{}, Required: []string{"image_id"}, Response: client.Message{}},
+	{Method: http.MethodDelete, Path: "/api/collections/:slug/images/:imageId", Tag: "collections", Summary: "Remove an image from a collection",
+		Auth: User, Response: client.Message{}},
+	{Method: http.MethodPut, Path: "/api/collections/:slug/order", Tag: "collections", Summary: "Reorder a collection's images",
+		Auth: User, Body: handlers.ReorderCollectionRequest{}, Required: []string{"image_ids"}, Response: client.Message{}},
+
+	// Categories
+	{Method: http.MethodGet, Path: "/api/categories", Tag: "categories", Summary: "Every category",
+		Response: []models.Category{}},
+
+	// Admin
+	{Method: http.MethodPost, Path: "/api/admin/login", Tag: "admin", Summary: "Start an admin password session; sets the admin_session cookie",
+		Body: handlers.AdminLoginRequest{}, Required: []string{"password"}, Response: client.AdminSession{}},
+	{Method: http.MethodPost, Path: "/api/admin/logout", Tag: "admin", Summary: "End the admin password session",
+		Response: client.Message{}},
+	{Method: http.MethodPost, Path: "/api/admin/categories", Tag: "categories", Summary: "Create a category",
+		Auth: Admin, Body: handlers.CreateCategoryRequest{}, Required: []string{"name", "slug"}, Response: models.Category{}, Status: http.StatusCreated},
+	{Method: http.MethodPut, Path: "/api/admin/categories/:id", Tag: "categories", Summary: "Rename a category",
+		Auth: Admin, Body: handlers.CreateCategoryRequest{}, Required: []string{"name", "slug"}, Response: client.Message{}},
+	{Method: http.MethodDelete, Path: "/api/admin/categories/:id", Tag: "categories", Summary: "Delete a category no image is filed in",
+		Auth: Admin, Response: client.Message{}},
+	{Method: http.MethodGet, Path: "/api/admin/stats", Tag: "admin", Summary: "Dashboard counters",
+		Auth: Moderator, Response: client.AdminStats{}},
+	{Method: http.MethodGet, Path: "/api/admin/pending", Tag: "admin", Summary: "Every image awaiting review",
+		Auth: Moderator, Response: client.PendingImages{}},
+	{Method: http.MethodGet, Path: "/api/admin/images", Tag: "admin", Summary: "Images of any status",
+		Auth: Moderator, Query: withParams(listingParams, Param{Name: "status", Description: "pending, approved or review; all when empty"}), Response: client.ImagePage{}},
+	{Method: http.MethodPost, Path: "/api/admin/approve/:id", Tag: "admin", Summary: "Publish an image",
+		Auth: Moderator, Body: handlers.ApproveRequest{}, Required: []string{"category_id"}, Response: client.Message{}},
+	{Method: http.MethodPost, Path: "/api/admin/bulk-approve", Tag: "admin", Summary: "Publish several images",
+		Auth: Moderator, Body: handlers.BulkActionRequest{}, Required: []string{"ids", "category_id"}, Response: client.BulkResult{}},
+	{Method: http.MethodPost, Path: "/api/admin/bulk-delete", Tag: "admin", Summary: "Delete several images",
+		Auth: Admin, Body: handlers.BulkActionRequest{}, Required: []string{"ids"}, Response: client.BulkResult{}},
+	{Method: http.MethodPut, Path: "/api/admin/images/:id/text", Tag: "admin", Summary: "Correct an image's OCR text",
+		Auth: Moderator, Body: handlers.UpdateImageTextRequest{}, Required: []string{"text"}, Response: client.ImageText{}},
+	{Method: http.MethodDelete, Path: "/api/admin/images/:id", Tag: "admin", Summary: "Delete an image",
+		Auth: Moderator, Response: client.Message{}},
+	{Method: http.MethodPost, Path: "/api/admin/reject/:id", Tag: "admin", Summary: "Delete an image (older alias)",
+		Auth: Moderator, Response: client.Message{}},
+	{Method: http.MethodGet, Path: "/api/admin/comments", Tag: "admin", Summary: "Comments, newest first",
+		Auth: Moderator, Query: withParams(pageParams,
+			Param{Name: "status", Description: "visible or hidden"},
+			Param{Name: "image_id", Type: "integer"},
+		), Response: client.CommentPage{}},
+	{Method: http.MethodPost, Path: "/api/admin/comments/:id/hide", Tag: "admin", Summary: "Hide a comment",
+		Auth: Moderator, Body: handlers.ModerationRequest{}, Response: client.Message{}},
+	{Method: http.MethodPost, Path: "/api/admin/comments/:id/unhide", Tag: "admin", Summary: "Show a hidden comment again",
+		Auth: Moderator, Body: handlers.ModerationRequest{}, Response: client.Message{}},
+	{Method: http.MethodDelete, Path: "/api/admin/comments/:id", Tag: "admin", Summary: "Delete any comment",
+		Auth: Moderator, Body: handlers.ModerationRequest{}, Response: client.Message{}},
+	{Method: http.MethodGet, Path: "/api/admin/moderation", Tag: "admin", Summary: "The moderation audit log",
+		Auth: Moderator, Query: withParams(pageParams,
+			Param{Name: "target_type", Description: "image, comment or user"},
+			Param{Name: "image_id", Type: "integer"},
+		), Response: client.ModerationLog{}},
+	{Method: http.MethodGet, Path: "/api/admin/reports", Tag: "admin", Summary: "Images with open reports",
+		Auth: Moderator, Query: pageParams, Response: client.ReportQueue{}},
+	{Method: http.MethodGet, Path: "/api/admin/reports/images/:id", Tag: "admin", Summary: "Every report filed against an image",
+		Auth: Moderator, Response: client.ImageReports{}},
+	{Method: http.MethodPost, Path: "/api/admin/reports/images/:id/resolve", Tag: "admin", Summary: "Dismiss an image's reports or remove it",
+		Auth: Moderator, Body: handlers.ResolveReportsRequest{}, Required: []string{"action"}, Response: client.Message{}},
+	{Method: http.MethodPut, Path: "/api/admin/users/:username/role", Tag: "admin", Summary: "Set a user's role",
+		Auth: Admin, Body: handlers.SetUserRoleRequest{}, Required: []string{"role"}, Response: client.RoleChange{}},
+	{Method: http.MethodGet, Path: "/api/admin/backups", Tag: "admin", Summary: "Backup archives",
+		Auth: Admin, Response: client.BackupList{}},
+	{Method: http.MethodPost, Path: "/api/admin/backups", Tag: "admin", Summary: "Archive the database and media",
+		Auth: Admin, Body: handlers.CreateBackupRequest{}, Response: client.BackupCreated{}, Status: http.StatusCreated},
+	{Method: http.MethodGet, Path: "/api/admin/backups/:name", Tag: "admin", Summary: "Download a backup archive",
+		Auth: Admin, Produces: "application/octet-stream"},
+
+	// API documentation
+	{Method: http.MethodGet, Path: "/api/openapi.json", Tag: "meta", Summary: "This document",
+		Produces: "application/json"},
+	{Method: http.MethodGet, Path: "/api/docs", Tag: "meta", Summary: "A page rendering this document",
+		Produces: "text/html"},
+
+	// Operations
+	{Method: http.MethodGet, Path: "/healthz", Tag: "meta", Summary: "Liveness probe",
+		Response: client.Health{}},
+	{Method: http.MethodGet, Path: "/readyz", Tag: "meta", Summary: "Readiness probe; 503 when the database, uploads or encoder are unavailable",
+		Response: client.Health{}},
+	{Method: http.MethodGet, Path: "/metrics", Tag: "meta", Summary: "Prometheus metrics; may be served on a separate address and need the METRICS_TOKEN bearer token",
+		Produces: "text/plain"},
+	{Method: http.MethodGet, Path: "/random.webp", Tag: "images", Summary: "The file of a random approved image, for embedding",
+		Query: withParams(randomParams,
+			Param{Name: "size", Type: "integer", Description: "Width: 128, 256, 512 or 1024"},
+			Param{Name: "format", Description: "png redirects to /random.png with the other parameters"},
+		), Produces: "image/*"},
+	{Method: http.MethodGet, Path: "/random.png", Tag: "images", Summary: "The file of a random approved image as PNG; animated images stay WebP",
+		Query: withParams(randomParams,
+			Param{Name: "size", Type: "integer", Description: "Width: 128, 256, 512 or 1024"},
+		), Produces: "image/*"},
+}
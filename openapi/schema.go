@@ -0,0 +1,116 @@
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemas derives JSON schemas from Go types the way encoding/json encodes
+// them. Named structs become components, referenced by name.
+type schemas struct {
+	components map[string]interface{}
+	types      map[string]reflect.Type
+}
+
+func newSchemas() *schemas {
+	return &schemas{components: map[string]interface{}{}, types: map[string]reflect.Type{}}
+}
+
+// of returns the schema of values like v.
+func (s *schemas) of(v interface{}) map[string]interface{} {
+	return s.schema(reflect.TypeOf(v))
+}
+
+func (s *schemas) schema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		inner := s.schema(t.Elem())
+		if _, ok := inner["$ref"]; ok {
+			// $ref takes no siblings in OpenAPI 3.0
+			return map[string]interface{}{"allOf": []interface{}{inner}, "nullable": true}
+		}
+		inner["nullable"] = true
+		return inner
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		if t == timeType {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + s.component(t)}
+	}
+	return map[string]interface{}{}
+}
+
+// component registers a named struct and returns its component name. Types
+// of different packages sharing a name are told apart by package.
+func (s *schemas) component(t reflect.Type) string {
+	name := t.Name()
+	if other, ok := s.types[name]; ok && other != t {
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	if _, ok := s.types[name]; !ok {
+		s.types[name] = t
+		// Registered before it is built, so recursive types terminate
+		s.components[name] = nil
+		s.components[name] = s.object(t)
+	}
+	return name
+}
+
+// object builds the schema of a struct's fields. Embedded structs are
+// referenced with allOf, as their fields are promoted. Fields are required
+// unless they are pointers or omitempty.
+func (s *schemas) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	var embedded []interface{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			embedded = append(embedded, s.schema(f.Type))
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = s.schema(f.Type)
+		if f.Type.Kind() != reflect.Ptr && !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	obj := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		obj["required"] = required
+	}
+	if len(embedded) == 0 {
+		return obj
+	}
+	return map[string]interface{}{"allOf": append(embedded, obj)}
+}
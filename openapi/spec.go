@@ -0,0 +1,348 @@
+// Package openapi describes the HTTP API as an OpenAPI 3 document. The
+// operations are listed by hand in routes.go, and their schemas are
+// reflected from the request structs the handlers decode and the client
+// response types. Handlers build their responses separately, so the tests
+// call them and validate what they send against the schemas. Check compares
+// the list with the routes a server registers.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"hyw-webpics/client"
+)
+
+// Auth is who may call an operation.
+type Auth int
+
+const (
+	// Public operations need no credentials.
+	Public Auth = iota
+	// Optional operations show more to a signed-in user, e.g. their own
+	// favorites.
+	Optional
+	// User operations need an access token, or an API key with one of the
+	// operation's scopes.
+	User
+	// Moderator operations need a moderator or admin account, or the admin
+	// password session.
+	Moderator
+	// Admin operations need an admin account or the admin password session.
+	Admin
+)
+
+// Param is a query parameter, or a field of a multipart form.
+type Param struct {
+	Name        string
+	Type        string // string, integer or boolean; string when empty
+	Description string
+	Required    bool
+}
+
+// OneOf is a response that is one of several types.
+type OneOf []interface{}
+
+// Operation is one route of the API.
+type Operation struct {
+	Method string
+	// Path is in the router's syntax, e.g. /api/images/:id.
+	Path    string
+	Tag     string
+	Summary string
+	Auth    Auth
+	// Scopes are the API key scopes accepted by a User operation; API keys
+	// are refused without any.
+	Scopes []string
+	Query  []Param
+	// Body is a value of the JSON request body's type.
+	Body interface{}
+	// Required lists the body fields that must be set.
+	Required []string
+	// Form describes a multipart request body.
+	Form []Param
+	// Response is a value of the response body's type; nil for none.
+	Response interface{}
+	// Status is the success status; 200 when zero.
+	Status int
+	// Produces is the content type of a response that is not JSON.
+	Produces string
+}
+
+var paramPattern = regexp.MustCompile(`:(\w+)`)
+
+// OpenAPIPath returns the path in OpenAPI syntax, e.g. /api/images/{id}.
+func (op Operation) OpenAPIPath() string {
+	return paramPattern.ReplaceAllString(normalize(op.Path), "{$1}")
+}
+
+var (
+	specOnce sync.Once
+	specJSON []byte
+)
+
+// JSON returns the spec, encoded once.
+func JSON() []byte {
+	specOnce.Do(func() {
+		data, err := json.MarshalIndent(Spec(), "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		specJSON = data
+	})
+	return specJSON
+}
+
+// Spec builds the OpenAPI document.
+func Spec() map[string]interface{} {
+	s := newSchemas()
+	errorRef := s.of(client.Error{})
+	paths := map[string]map[string]interface{}{}
+	tags := []interface{}{}
+	seenTags := map[string]bool{}
+
+	for _, op := range Operations {
+		if !seenTags[op.Tag] {
+			seenTags[op.Tag] = true
+			tags = append(tags, map[string]interface{}{"name": op.Tag})
+		}
+		path := op.OpenAPIPath()
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(op.Method)] = s.operation(op, errorRef)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "HYW WebPics API",
+			"version":     "1",
+			"description": "Errors are answered with {\"error\": \"message\"}. A Go client lives in the hyw-webpics/client package.",
+		},
+		"servers": []interface{}{map[string]interface{}{"url": "/"}},
+		"tags":    tags,
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": s.components,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "An access token from /api/auth/login, or an API key where the operation accepts one.",
+				},
+				"adminToken": map[string]interface{}{
+					"type":        "apiKey",
+					"in":          "header",
+					"name":        "X-Admin-Token",
+					"description": "The admin_token returned by /api/admin/login, sent with the admin_session cookie it set.",
+				},
+			},
+		},
+	}
+}
+
+func (s *schemas) operation(op Operation, errorRef map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{
+		"tags":        []string{op.Tag},
+		"summary":     op.Summary,
+		"operationId": operationID(op),
+	}
+
+	var params []interface{}
+	for _, m := range paramPattern.FindAllStringSubmatch(op.Path, -1) {
+		typ := "string"
+		if strings.HasSuffix(strings.ToLower(m[1]), "id") {
+			typ = "integer"
+		}
+		params = append(params, map[string]interface{}{
+			"name": m[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": typ},
+		})
+	}
+	for _, p := range op.Query {
+		params = append(params, paramObject(p, "query"))
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+
+	switch {
+	case op.Body != nil:
+		// Request types are shared between operations that need different
+		// fields, so which are required is told per operation
+		schema := s.of(op.Body)
+		if ref, ok := schema["$ref"].(string); ok {
+			delete(s.components[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]interface{}), "required")
+		}
+		if len(op.Required) > 0 {
+			schema = map[string]interface{}{"allOf": []interface{}{schema}, "required": op.Required}
+		}
+		out["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}},
+		}
+	case op.Form != nil:
+		properties := map[string]interface{}{}
+		var required []string
+		for _, p := range op.Form {
+			properties[p.Name] = paramSchema(p)
+			if p.Required {
+				required = append(required, p.Name)
+			}
+		}
+		form := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			form["required"] = required
+		}
+		out["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{"multipart/form-data": map[string]interface{}{"schema": form}},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	switch {
+	case op.Produces != "":
+		success["content"] = map[string]interface{}{op.Produces: map[string]interface{}{
+			"schema": map[string]interface{}{"type": "string", "format": "binary"},
+		}}
+	case op.Response != nil:
+		success["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": s.response(op.Response)}}
+	}
+	out["responses"] = map[string]interface{}{
+		strconv.Itoa(status): success,
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": errorRef}},
+		},
+	}
+
+	if security := op.security(); security != nil {
+		out["security"] = security
+	}
+	if description := op.description(); description != "" {
+		out["description"] = description
+	}
+	return out
+}
+
+func (s *schemas) response(v interface{}) map[string]interface{} {
+	if alternatives, ok := v.(OneOf); ok {
+		var schemas []interface{}
+		for _, alt := range alternatives {
+			schemas = append(schemas, s.of(alt))
+		}
+		return map[string]interface{}{"oneOf": schemas}
+	}
+	return s.of(v)
+}
+
+func (op Operation) security() []interface{} {
+	bearer := map[string]interface{}{"bearer": []string{}}
+	switch op.Auth {
+	case Optional:
+		return []interface{}{map[string]interface{}{}, bearer}
+	case User:
+		return []interface{}{bearer}
+	case Moderator, Admin:
+		return []interface{}{bearer, map[string]interface{}{"adminToken": []string{}}}
+	}
+	return nil
+}
+
+func (op Operation) description() string {
+	switch op.Auth {
+	case User:
+		if len(op.Scopes) == 0 {
+			return "Needs an access token; API keys are refused."
+		}
+		return "Needs an access token or an API key with the " + strings.Join(op.Scopes, " or ") + " scope."
+	case Moderator:
+		return "Needs a moderator or admin account; API keys are refused."
+	case Admin:
+		return "Needs an admin account; API keys are refused."
+	}
+	return ""
+}
+
+// operationID derives a unique name from the method and path, e.g.
+// get_api_images_id.
+func operationID(op Operation) string {
+	id := strings.ToLower(op.Method) + strings.NewReplacer("/", "_", ":", "", "-", "_", ".", "_").Replace(op.Path)
+	return strings.TrimRight(id, "_")
+}
+
+func paramObject(p Param, in string) map[string]interface{} {
+	obj := map[string]interface{}{"name": p.Name, "in": in, "schema": paramSchema(p)}
+	if p.Required {
+		obj["required"] = true
+	}
+	if p.Description != "" {
+		obj["description"] = p.Description
+	}
+	return obj
+}
+
+func paramSchema(p Param) map[string]interface{} {
+	typ := p.Type
+	if typ == "" {
+		typ = "string"
+	}
+	schema := map[string]interface{}{"type": typ}
+	if typ == "file" {
+		schema = map[string]interface{}{"type": "string", "format": "binary"}
+	}
+	if p.Description != "" {
+		schema["description"] = p.Description
+	}
+	return schema
+}
+
+// Check compares the routes registered on a server with Operations and
+// describes each route missing from either. HEAD routes, middleware and
+// the catch-all routes for static files and the frontend are ignored.
+func Check(routes []string) []string {
+	documented := map[string]bool{}
+	for _, op := range Operations {
+		documented[op.Method+" "+normalize(op.Path)] = true
+	}
+	registered := map[string]bool{}
+	for _, r := range routes {
+		method, path, _ := strings.Cut(r, " ")
+		if method == http.MethodHead || strings.Contains(path, "*") {
+			continue
+		}
+		registered[method+" "+normalize(path)] = true
+	}
+
+	var problems []string
+	for r := range registered {
+		if !documented[r] {
+			problems = append(problems, "route not in the spec: "+r)
+		}
+	}
+	for r := range documented {
+		if !registered[r] {
+			problems = append(problems, "spec lists a route that is not registered: "+r)
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// normalize drops the trailing slash group roots are registered with.
+func normalize(path string) string {
+	if len(path) > 1 {
+		return strings.TrimSuffix(path, "/")
+	}
+	return path
+}
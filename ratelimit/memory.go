@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+type failures struct {
+	count       int
+	lockedUntil time.Time
+	expires     time.Time
+}
+
+// MemoryStore keeps state in process memory. It is the default, and is
+// enough when a single server process handles all requests.
+type MemoryStore struct {
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	failures map[string]*failures
+}
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{buckets: make(map[string]*bucket), failures: make(map[string]*failures)}
+	go s.sweep()
+	return s
+}
+
+func (s *MemoryStore) Take(key string, limit Limit, now time.Time) (Decision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	tokens := refill(b.tokens, b.updated, now, limit)
+	d, tokens := decide(tokens, limit)
+	b.tokens, b.updated, b.full = tokens, now, fullAt(tokens, now, limit)
+	return d, nil
+}
+
+func (s *MemoryStore) Fail(key string, policy Lockout, now time.Time) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.failures[key]
+	if !ok || now.After(f.expires) {
+		f = &failures{}
+		s.failures[key] = f
+	}
+	f.count++
+	f.expires = now.Add(policy.Window)
+	if d := policy.duration(f.count); d > 0 {
+		f.lockedUntil = now.Add(d)
+	}
+	return f.lockedUntil, nil
+}
+
+func (s *MemoryStore) LockedUntil(key string, now time.Time) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.failures[key]; ok {
+		return f.lockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	delete(s.failures, key)
+	s.mu.Unlock()
+	return nil
+}
+
+// sweep forgets full buckets and expired failures, which behave exactly like
+// missing ones.
+func (s *MemoryStore) sweep() {
+	for range time.Tick(time.Minute) {
+		now := time.Now()
+		s.mu.Lock()
+		for key, b := range s.buckets {
+			if now.After(b.full) {
+				delete(s.buckets, key)
+			}
+		}
+		for key, f := range s.failures {
+			if now.After(f.expires) && now.After(f.lockedUntil) {
+				delete(s.failures, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
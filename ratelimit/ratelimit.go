@@ -0,0 +1,93 @@
+// Package ratelimit implements token bucket rate limits and progressive
+// lockout after repeated failures, backed by a Store that is either in
+// memory (one process) or in SQLite (shared by every process using the same
+// database file).
+package ratelimit
+
+import "time"
+
+// Limit allows Burst requests at once, refilling at Burst per Per.
+type Limit struct {
+	Burst int
+	Per   time.Duration
+}
+
+// rate is the refill speed in tokens per second.
+func (l Limit) rate() float64 {
+	return float64(l.Burst) / l.Per.Seconds()
+}
+
+// Decision is the outcome of taking a token.
+type Decision struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration // when not allowed, until the next token
+}
+
+// Lockout locks a key out once it has Threshold consecutive failures, for
+// Base, doubling with every further failure up to Max. Failures are
+// forgotten after Window without one, or on Reset.
+type Lockout struct {
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+	Window    time.Duration
+}
+
+// duration returns how long failures consecutive failures lock a key for.
+func (l Lockout) duration(failures int) time.Duration {
+	if l.Threshold <= 0 || failures < l.Threshold {
+		return 0
+	}
+	d := l.Base
+	for i := l.Threshold; i < failures && d < l.Max; i++ {
+		d *= 2
+	}
+	if d > l.Max {
+		d = l.Max
+	}
+	return d
+}
+
+// Store keeps bucket and failure state. now is passed in so callers, and
+// tests, control the clock.
+type Store interface {
+	// Take removes a token from key's bucket if one is available.
+	Take(key string, limit Limit, now time.Time) (Decision, error)
+	// Fail records a failure for key and returns when its lockout ends,
+	// which is not after now if it is not locked out.
+	Fail(key string, policy Lockout, now time.Time) (time.Time, error)
+	// LockedUntil returns when key's lockout ends.
+	LockedUntil(key string, now time.Time) (time.Time, error)
+	// Reset forgets key's failures, after a success.
+	Reset(key string) error
+}
+
+// refill returns the tokens in a bucket that held tokens at updated.
+func refill(tokens float64, updated, now time.Time, limit Limit) float64 {
+	if elapsed := now.Sub(updated).Seconds(); elapsed > 0 {
+		tokens += elapsed * limit.rate()
+	}
+	if max := float64(limit.Burst); tokens > max {
+		tokens = max
+	}
+	return tokens
+}
+
+// decide takes a token from a bucket holding tokens, returning the decision
+// and the tokens left.
+func decide(tokens float64, limit Limit) (Decision, float64) {
+	if tokens < 1 {
+		wait := (1 - tokens) / limit.rate()
+		return Decision{RetryAfter: time.Duration(wait * float64(time.Second))}, tokens
+	}
+	tokens--
+	return Decision{Allowed: true, Remaining: int(tokens)}, tokens
+}
+
+// fullAt is when a bucket holding tokens will have refilled completely and
+// can be forgotten.
+func fullAt(tokens float64, now time.Time, limit Limit) time.Time {
+	missing := float64(limit.Burst) - tokens
+	return now.Add(time.Duration(missing / limit.rate() * float64(time.Second)))
+}
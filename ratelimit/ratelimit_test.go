@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+)
+
+// stores returns a fresh store of each kind.
+func stores(t *testing.T) map[string]Store {
+	t.Helper()
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("DATABASE_PATH", filepath.Join(t.TempDir(), "test.db"))
+	if _, err := config.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	database.Connect()
+	t.Cleanup(database.Close)
+	return map[string]Store{"memory": NewMemoryStore(), "sqlite": NewSQLiteStore(database.DB)}
+}
+
+func TestTake(t *testing.T) {
+	// Two at once, then one every two seconds
+	limit := Limit{Burst: 2, Per: 4 * time.Second}
+	t0 := time.Unix(1700000000, 0)
+	steps := []struct {
+		name       string
+		at         time.Duration
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}{
+		{"first of the burst", 0, true, 1, 0},
+		{"rest of the burst", 0, true, 0, 0},
+		{"burst spent", 0, false, 0, 2 * time.Second},
+		{"half a token refilled", time.Second, false, 0, time.Second},
+		{"one token refilled", 2 * time.Second, true, 0, 0},
+		{"refill stops at the burst", time.Minute, true, 1, 0},
+		{"still within the burst", time.Minute, true, 0, 0},
+		{"spent again", time.Minute, false, 0, 2 * time.Second},
+	}
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, step := range steps {
+				d, err := s.Take("key", limit, t0.Add(step.at))
+				if err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				}
+				if d.Allowed != step.allowed || d.Remaining != step.remaining {
+					t.Errorf("%s: allowed %v with %d remaining, want %v with %d", step.name, d.Allowed, d.Remaining, step.allowed, step.remaining)
+				}
+				if diff := d.RetryAfter - step.retryAfter; diff < -time.Millisecond || diff > time.Millisecond {
+					t.Errorf("%s: retry after %v, want %v", step.name, d.RetryAfter, step.retryAfter)
+				}
+			}
+			// Keys have separate buckets
+			if d, _ := s.Take("other", limit, t0.Add(time.Minute)); !d.Allowed {
+				t.Error("another key shared the spent bucket")
+			}
+		})
+	}
+}
+
+func TestLockoutDuration(t *testing.T) {
+	policy := Lockout{Threshold: 3, Base: time.Minute, Max: 5 * time.Minute}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{6, 5 * time.Minute},
+		{20, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := policy.duration(tt.failures); got != tt.want {
+			t.Errorf("duration(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+	if got := (Lockout{Base: time.Minute, Max: time.Hour}).duration(10); got != 0 {
+		t.Errorf("duration with no threshold = %v, want 0", got)
+	}
+}
+
+func TestFail(t *testing.T) {
+	policy := Lockout{Threshold: 2, Base: time.Minute, Max: 4 * time.Minute, Window: time.Hour}
+	t0 := time.Unix(1700000000, 0)
+	steps := []struct {
+		name   string
+		at     time.Duration
+		locked time.Duration // lockout left after the failure, 0 for none
+	}{
+		{"below the threshold", 0, 0},
+		{"at the threshold", time.Second, time.Minute},
+		{"doubles", 2 * time.Second, 2 * time.Minute},
+		{"doubles again", 3 * time.Second, 4 * time.Minute},
+		{"capped", 4 * time.Second, 4 * time.Minute},
+		{"forgotten after the window", 2 * time.Hour, 0},
+		{"counting again", 2*time.Hour + time.Second, time.Minute},
+	}
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, step := range steps {
+				now := t0.Add(step.at)
+				until, err := s.Fail("key", policy, now)
+				if err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				}
+				left := until.Sub(now)
+				if left < 0 {
+					left = 0
+				}
+				if left != step.locked {
+					t.Errorf("%s: locked for %v, want %v", step.name, left, step.locked)
+				}
+				stored, err := s.LockedUntil("key", now)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if step.locked > 0 && !stored.Equal(until) {
+					t.Errorf("%s: LockedUntil = %v, want %v", step.name, stored, until)
+				}
+			}
+
+			if err := s.Reset("key"); err != nil {
+				t.Fatal(err)
+			}
+			now := t0.Add(2*time.Hour + 2*time.Second)
+			if until, err := s.LockedUntil("key", now); err != nil || until.After(now) {
+				t.Errorf("LockedUntil after Reset = %v, %v; want no lockout", until, err)
+			}
+			if until, _ := s.Fail("key", policy, now); until.After(now) {
+				t.Error("Reset did not clear the failure count")
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"database/sql"
+	"time"
+
+	"hyw-webpics/logging"
+)
+
+var limitLog = logging.For("ratelimit")
+
+// SQLiteStore keeps state in the rate_limits and login_failures tables so
+// that several server processes sharing a database enforce one budget.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	s := &SQLiteStore{db: db}
+	go s.sweep()
+	return s
+}
+
+// unix converts to fractional seconds, the precision buckets need.
+func unix(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+func fromUnix(f float64) time.Time {
+	return time.Unix(0, int64(f*1e9))
+}
+
+// Take refills and takes in a single statement, which SQLite runs under one
+// write lock, so concurrent processes cannot both spend the last token.
+func (s *SQLiteStore) Take(key string, limit Limit, now time.Time) (Decision, error) {
+	var tokens float64
+	var allowed bool
+	// ?1 key, ?2 burst, ?3 now, ?4 refill rate
+	err := s.db.QueryRow(`
+		INSERT INTO rate_limits (key, tokens, allowed, updated_at, full_at)
+		SELECT ?1, r - (r >= 1), r >= 1, ?3, ?3 + (?2 - r + (r >= 1)) / ?4
+		FROM (SELECT coalesce(
+			(SELECT min(?2, tokens + max(?3 - updated_at, 0) * ?4) FROM rate_limits WHERE key = ?1),
+			?2) AS r)
+		WHERE true
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = excluded.tokens, allowed = excluded.allowed,
+			updated_at = excluded.updated_at, full_at = excluded.full_at
+		RETURNING tokens, allowed`,
+		key, limit.Burst, unix(now), limit.rate(),
+	).Scan(&tokens, &allowed)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	if !allowed {
+		wait := (1 - tokens) / limit.rate()
+		return Decision{RetryAfter: time.Duration(wait * float64(time.Second))}, nil
+	}
+	return Decision{Allowed: true, Remaining: int(tokens)}, nil
+}
+
+func (s *SQLiteStore) Fail(key string, policy Lockout, now time.Time) (time.Time, error) {
+	var count int
+	var lockedUntil float64
+	err := s.db.QueryRow(`
+		INSERT INTO login_failures (key, failures, locked_until, expires_at) VALUES (?1, 1, 0, ?2 + ?3)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN expires_at < ?2 THEN 1 ELSE failures + 1 END,
+			expires_at = ?2 + ?3
+		RETURNING failures, locked_until`,
+		key, unix(now), policy.Window.Seconds(),
+	).Scan(&count, &lockedUntil)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	d := policy.duration(count)
+	if d == 0 {
+		return fromUnix(lockedUntil), nil
+	}
+	until := now.Add(d)
+	if _, err := s.db.Exec("UPDATE login_failures SET locked_until = ? WHERE key = ?", unix(until), key); err != nil {
+		return time.Time{}, err
+	}
+	return until, nil
+}
+
+func (s *SQLiteStore) LockedUntil(key string, now time.Time) (time.Time, error) {
+	var lockedUntil float64
+	err := s.db.QueryRow("SELECT locked_until FROM login_failures WHERE key = ?", key).Scan(&lockedUntil)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fromUnix(lockedUntil), nil
+}
+
+func (s *SQLiteStore) Reset(key string) error {
+	_, err := s.db.Exec("DELETE FROM login_failures WHERE key = ?", key)
+	return err
+}
+
+// sweep deletes full buckets and expired failures, which behave exactly like
+// missing rows.
+func (s *SQLiteStore) sweep() {
+	for range time.Tick(time.Minute) {
+		now := unix(time.Now())
+		if _, err := s.db.Exec("DELETE FROM rate_limits WHERE full_at < ?", now); err != nil {
+			limitLog.Warn("Rate limit sweep failed", "table", "rate_limits", "err", err)
+		}
+		if _, err := s.db.Exec("DELETE FROM login_failures WHERE expires_at < ?1 AND locked_until < ?1", now); err != nil {
+			limitLog.Warn("Rate limit sweep failed", "table", "login_failures", "err", err)
+		}
+	}
+}
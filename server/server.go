@@ -0,0 +1,186 @@
+// Package server builds the HTTP application: middleware and every route.
+// It is shared by the serve command, the openapi command and tests.
+package server
+
+import (
+	"os"
+	"strings"
+
+	"hyw-webpics/config"
+	"hyw-webpics/handlers"
+	"hyw-webpics/middleware"
+	"hyw-webpics/openapi"
+	"hyw-webpics/web"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+// New registers every route. Metrics get an app of their own when
+// metrics.listen is set; metricsApp is nil otherwise.
+func New() (app, metricsApp *fiber.App) {
+	app = fiber.New(fiber.Config{
+		BodyLimit: config.AppConfig.BodyLimitMB * 1024 * 1024,
+		// The banner is plain text and would break JSON log parsing
+		DisableStartupMessage: config.AppConfig.LogFormat == "json",
+	})
+
+	// Middleware
+	app.Use(middleware.RequestID())
+	app.Use(middleware.AccessLog())
+	app.Use(middleware.Metrics())
+	app.Use(cors.New(cors.Config{
+		AllowOrigins:  strings.Join(config.AppConfig.CORSOrigins, ","),
+		AllowMethods:  "GET,POST,PUT,DELETE",
+		AllowHeaders:  "Origin,Content-Type,Accept,Authorization,X-Admin-Token,X-Request-ID",
+		ExposeHeaders: "X-Request-ID",
+	}))
+
+	// API routes
+	api := app.Group("/api")
+
+	// Auth routes
+	auth := api.Group("/auth")
+	auth.Post("/register", middleware.RegisterRateLimit(), handlers.Register)
+	auth.Post("/login", middleware.LoginRateLimit(), handlers.Login)
+	auth.Post("/login/2fa", middleware.TwoFactorRateLimit(), handlers.LoginTwoFactor)
+	auth.Post("/refresh", handlers.RefreshSession)
+	auth.Post("/logout", handlers.Logout)
+	auth.Post("/logout-all", middleware.UserAuth(), handlers.LogoutAll)
+	auth.Get("/me", middleware.UserAuth("read"), handlers.GetMe)
+
+	// Image routes
+	images := api.Group("/images")
+	images.Post("/upload", middleware.UserAuth("upload"), middleware.UploadRateLimit(), handlers.UploadImage)
+	images.Get("/", middleware.OptionalUserAuth(), handlers.GetApprovedImages)
+	images.Get("/random", middleware.RandomRateLimit(), middleware.OptionalUserAuth(), handlers.GetRandomImage)
+	images.Get("/search", middleware.OptionalUserAuth(), handlers.SearchImages)
+	images.Get("/trending", middleware.OptionalUserAuth(), handlers.GetTrendingImages)
+	images.Get("/:id", middleware.OptionalUserAuth(), handlers.GetImage)
+	images.Post("/:id/share", middleware.OptionalUserAuth(), handlers.ShareImage)
+	images.Post("/:id/favorite", middleware.UserAuth("favorite"), handlers.AddFavorite)
+	images.Delete("/:id/favorite", middleware.UserAuth("favorite"), handlers.RemoveFavorite)
+	images.Get("/:id/comments", handlers.GetImageComments)
+	images.Post("/:id/comments", middleware.UserAuth(), middleware.CommentRateLimit(), handlers.CreateComment)
+	images.Post("/:id/report", middleware.OptionalUserAuth(), middleware.ReportRateLimit(), handlers.ReportImage)
+
+	// Comment routes
+	comments := api.Group("/comments", middleware.UserAuth())
+	comments.Put("/:id", handlers.UpdateComment)
+	comments.Delete("/:id", handlers.DeleteComment)
+
+	// Current user routes; only the listings accept API keys
+	me := api.Group("/me")
+	me.Get("/favorites", middleware.UserAuth("read", "favorite"), handlers.GetMyFavorites)
+	me.Get("/collections", middleware.UserAuth("read"), handlers.GetMyCollections)
+	me.Get("/quota", middleware.UserAuth("read", "upload"), handlers.GetMyQuota)
+	me.Delete("/", middleware.UserAuth(), handlers.DeleteAccount)
+	me.Put("/password", middleware.UserAuth(), handlers.ChangePassword)
+	me.Put("/profile", middleware.UserAuth(), handlers.UpdateProfile)
+	me.Post("/avatar", middleware.UserAuth(), handlers.UploadAvatar)
+	me.Delete("/avatar", middleware.UserAuth(), handlers.DeleteAvatar)
+	me.Get("/api-keys", middleware.UserAuth(), handlers.GetMyAPIKeys)
+	me.Post("/api-keys", middleware.UserAuth(), handlers.CreateAPIKey)
+	me.Delete("/api-keys/:id", middleware.UserAuth(), handlers.RevokeAPIKey)
+	me.Get("/2fa", middleware.UserAuth(), handlers.GetTwoFactorStatus)
+	me.Post("/2fa/setup", middleware.UserAuth(), handlers.SetupTwoFactor)
+	me.Post("/2fa/enable", middleware.UserAuth(), handlers.EnableTwoFactor)
+	me.Post("/2fa/disable", middleware.UserAuth(), middleware.TwoFactorRateLimit(), handlers.DisableTwoFactor)
+	me.Post("/2fa/recovery-codes", middleware.UserAuth(), middleware.TwoFactorRateLimit(), handlers.RegenerateRecoveryCodes)
+
+	// Public user profiles
+	users := api.Group("/users")
+	users.Get("/:username", handlers.GetUserProfile)
+	users.Get("/:username/images", middleware.OptionalUserAuth(), handlers.GetUserImages)
+
+	// Collection routes
+	collections := api.Group("/collections")
+	collections.Get("/", handlers.GetPublicCollections)
+	collections.Post("/", middleware.UserAuth(), handlers.CreateCollection)
+	collections.Get("/:slug", middleware.OptionalUserAuth(), handlers.GetCollection)
+	collections.Put("/:slug", middleware.UserAuth(), handlers.UpdateCollection)
+	collections.Delete("/:slug", middleware.UserAuth(), handlers.DeleteCollection)
+	collections.Post("/:slug/images", middleware.UserAuth(), handlers.AddCollectionImage)
+	collections.Delete("/:slug/images/:imageId", middleware.UserAuth(), handlers.RemoveCollectionImage)
+	collections.Put("/:slug/order", middleware.UserAuth(), handlers.ReorderCollection)
+
+	// Category routes (Public List)
+	api.Get("/categories", handlers.GetCategories)
+
+	// Admin functionality
+	admin := api.Group("/admin")
+
+	// Public Routes
+	admin.Post("/login", middleware.LoginRateLimit(), handlers.AdminLogin)
+	admin.Post("/logout", handlers.AdminLogout)
+
+	// Protected Routes
+	admin.Use(middleware.AdminAuth("moderator")) // Ensure all admin routes BELOW are protected
+
+	// Admin Category Management
+	admin.Post("/categories", middleware.AdminOnly(), handlers.CreateCategory)
+	admin.Put("/categories/:id", middleware.AdminOnly(), handlers.UpdateCategory)
+	admin.Delete("/categories/:id", middleware.AdminOnly(), handlers.DeleteCategory)
+
+	// Admin Stats & Ops
+	admin.Get("/stats", handlers.GetAdminStats)
+	admin.Get("/pending", handlers.GetPendingImages) // Keep for convenience or legacy
+	admin.Get("/images", handlers.GetAdminImages)    // New generic list
+	admin.Post("/approve/:id", handlers.ApproveImage)
+	admin.Post("/bulk-approve", handlers.BulkApproveImages)
+	admin.Post("/bulk-delete", middleware.AdminOnly(), handlers.BulkDeleteImages)
+	admin.Put("/images/:id/text", handlers.UpdateImageText)
+	admin.Delete("/images/:id", handlers.RejectImage) // Renamed usage, handlers.RejectImage now does generic delete
+	admin.Post("/reject/:id", handlers.RejectImage)   // Keep alias for compatibility
+
+	// Admin Moderation
+	admin.Get("/comments", handlers.GetAdminComments)
+	admin.Post("/comments/:id/hide", handlers.HideComment)
+	admin.Post("/comments/:id/unhide", handlers.UnhideComment)
+	admin.Delete("/comments/:id", handlers.AdminDeleteComment)
+	admin.Get("/moderation", handlers.GetModerationLog)
+	admin.Get("/reports", handlers.GetReportQueue)
+	admin.Get("/reports/images/:id", handlers.GetImageReports)
+	admin.Post("/reports/images/:id/resolve", handlers.ResolveImageReports)
+	admin.Put("/users/:username/role", middleware.AdminOnly(), handlers.SetUserRole)
+	admin.Get("/backups", middleware.AdminOnly(), handlers.GetBackups)
+	admin.Post("/backups", middleware.AdminOnly(), handlers.CreateBackup)
+	admin.Get("/backups/:name", middleware.AdminOnly(), handlers.DownloadBackup)
+
+	// Liveness and readiness probes
+	app.Get("/healthz", handlers.Healthz)
+	app.Get("/readyz", handlers.Readyz)
+
+	// Prometheus metrics, on their own address when one is configured
+	handlers.RegisterMetrics()
+	if config.AppConfig.MetricsListen != "" {
+		metricsApp = fiber.New(fiber.Config{DisableStartupMessage: true})
+		metricsApp.Get("/metrics", middleware.MetricsAuth(), handlers.GetMetrics)
+	} else {
+		app.Get("/metrics", middleware.MetricsAuth(), handlers.GetMetrics)
+	}
+
+	// Random image file for embedding (chat bots, signatures, overlays)
+	app.Get("/random.webp", middleware.RandomRateLimit(), handlers.GetRandomImageFile)
+	app.Get("/random.png", middleware.RandomRateLimit(), handlers.GetRandomImageFile)
+
+	// Serve uploaded images
+	app.Static("/uploads", config.AppConfig.UploadDir)
+
+	// API description, kept in step with the routes above by openapi check
+	app.Get("/api/openapi.json", openapi.ServeSpec)
+	app.Get("/api/docs", openapi.ServeDocs)
+
+	// Unknown API paths are errors, not pages of the app
+	app.All("/api/*", handlers.APINotFound)
+
+	// Serve the Vue frontend built into the binary, or from disk in
+	// development; paths it does not know fall back to index.html
+	frontend := web.Dist()
+	if dir := config.AppConfig.FrontendDir; dir != "" {
+		frontend = os.DirFS(dir)
+	}
+	app.Get("/*", handlers.Frontend(frontend))
+
+	return app, metricsApp
+}
@@ -0,0 +1,182 @@
+package stats
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"hyw-webpics/database"
+	"hyw-webpics/logging"
+)
+
+const (
+	// DedupWindow is how long repeat events from the same client are ignored.
+	DedupWindow = 30 * time.Minute
+	// retention is how long hourly buckets are kept for trending.
+	retention = 31 * 24 * time.Hour
+
+	HourFormat = "2006-01-02 15"
+)
+
+type counts struct {
+	views  int64
+	shares int64
+}
+
+type bucketKey struct {
+	imageID int64
+	hour    string
+}
+
+var (
+	mu      sync.Mutex
+	pending = make(map[bucketKey]*counts)
+	seen    = make(map[string]time.Time)
+
+	flushMu   sync.Mutex
+	lastPrune time.Time
+
+	// stop and stopped are made by Start
+	stop, stopped chan struct{}
+
+	statsLog = logging.For("stats")
+)
+
+// Start flushes buffered events to the database every interval until Stop
+// is called.
+func Start(interval time.Duration) {
+	stop, stopped = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := Flush(); err != nil {
+					statsLog.Error("Failed to flush image stats", "err", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the periodic flush started by Start and writes whatever is still
+// buffered, so no counts are lost when the server shuts down.
+func Stop() error {
+	if stop != nil {
+		close(stop)
+		<-stopped
+		stop = nil
+	}
+	return Flush()
+}
+
+// RecordView counts a view of an image by client, ignoring repeats within
+// DedupWindow.
+func RecordView(imageID int64, client string) {
+	record(imageID, client, "v", func(c *counts) { c.views++ })
+}
+
+// RecordShare counts a share or copy of an image by client, ignoring repeats
+// within DedupWindow.
+func RecordShare(imageID int64, client string) {
+	record(imageID, client, "s", func(c *counts) { c.shares++ })
+}
+
+func record(imageID int64, client, kind string, apply func(*counts)) {
+	now := time.Now()
+	dedupKey := kind + ":" + strconv.FormatInt(imageID, 10) + ":" + client
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if last, ok := seen[dedupKey]; ok && now.Sub(last) < DedupWindow {
+		return
+	}
+	seen[dedupKey] = now
+
+	key := bucketKey{imageID: imageID, hour: now.UTC().Format(HourFormat)}
+	c, ok := pending[key]
+	if !ok {
+		c = &counts{}
+		pending[key] = c
+	}
+	apply(c)
+}
+
+// Flush writes buffered counts to the image totals and hourly buckets. On
+// failure the counts are put back so they are retried on the next flush.
+func Flush() error {
+	flushMu.Lock()
+	defer flushMu.Unlock()
+
+	mu.Lock()
+	batch := pending
+	pending = make(map[bucketKey]*counts)
+	now := time.Now()
+	for key, t := range seen {
+		if now.Sub(t) >= DedupWindow {
+			delete(seen, key)
+		}
+	}
+	mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if err := writeBatch(batch); err != nil {
+		mu.Lock()
+		for key, c := range batch {
+			if p, ok := pending[key]; ok {
+				p.views += c.views
+				p.shares += c.shares
+			} else {
+				pending[key] = c
+			}
+		}
+		mu.Unlock()
+		return err
+	}
+
+	if now.Sub(lastPrune) > time.Hour {
+		lastPrune = now
+		cutoff := now.Add(-retention).UTC().Format(HourFormat)
+		if _, err := database.DB.Exec("DELETE FROM image_stats_hourly WHERE hour < ?", cutoff); err != nil {
+			statsLog.Warn("Failed to prune hourly stats", "err", err)
+		}
+	}
+	return nil
+}
+
+func writeBatch(batch map[bucketKey]*counts) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for key, c := range batch {
+		_, err := tx.Exec(
+			"UPDATE images SET view_count = view_count + ?, share_count = share_count + ? WHERE id = ?",
+			c.views, c.shares, key.imageID,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO image_stats_hourly (image_id, hour, views, shares) VALUES (?, ?, ?, ?)
+			ON CONFLICT (image_id, hour) DO UPDATE SET views = views + excluded.views, shares = shares + excluded.shares`,
+			key.imageID, key.hour, c.views, c.shares,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,49 @@
+package stats
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"hyw-webpics/config"
+	"hyw-webpics/database"
+)
+
+func TestStopFlushesBufferedCounts(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("DATABASE_PATH", filepath.Join(t.TempDir(), "test.db"))
+	if _, err := config.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	database.Connect()
+	t.Cleanup(database.Close)
+	if _, err := database.DB.Exec("INSERT INTO images (id, filename, original_name, uploader_id, status) VALUES (1, 'a.webp', 'a.png', 0, 'approved')"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The ticker never fires, so only Stop writes the counts
+	Start(time.Hour)
+	RecordView(1, "ip:1")
+	RecordView(1, "ip:1") // a repeat within DedupWindow
+	RecordView(1, "ip:2")
+	RecordShare(1, "ip:1")
+	if err := Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	var views, shares, hourlyViews, hourlyShares int
+	if err := database.DB.QueryRow("SELECT view_count, share_count FROM images WHERE id = 1").Scan(&views, &shares); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.QueryRow("SELECT SUM(views), SUM(shares) FROM image_stats_hourly WHERE image_id = 1").Scan(&hourlyViews, &hourlyShares); err != nil {
+		t.Fatal(err)
+	}
+	if views != 2 || shares != 1 || hourlyViews != 2 || hourlyShares != 1 {
+		t.Errorf("after Stop: %d views and %d shares, %d and %d hourly; want 2 and 1", views, shares, hourlyViews, hourlyShares)
+	}
+
+	// A second Stop only flushes again
+	if err := Stop(); err != nil {
+		t.Errorf("second Stop = %v", err)
+	}
+}
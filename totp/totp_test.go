@@ -0,0 +1,77 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 appendix B test vectors.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeRFC6238(t *testing.T) {
+	// The RFC lists 8-digit codes; the 6-digit code is their last six digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := Step(now)
+	code := func(step int64) string {
+		c, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		ok       bool
+		wantStep int64
+	}{
+		{"current step", code(step), true, step},
+		{"one step behind", code(step - 1), true, step - 1},
+		{"one step ahead", code(step + 1), true, step + 1},
+		{"two steps behind", code(step - 2), false, 0},
+		{"two steps ahead", code(step + 2), false, 0},
+		{"spaces are ignored", code(step)[:3] + " " + code(step)[3:], true, step},
+		{"too short", code(step)[:5], false, 0},
+		{"too long", code(step) + "0", false, 0},
+		{"empty", "", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Validate(rfcSecret, tt.code, now)
+			if ok != tt.ok || got != tt.wantStep {
+				t.Errorf("Validate(%q) = %d, %v; want %d, %v", tt.code, got, ok, tt.wantStep, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidateBadSecret(t *testing.T) {
+	if _, ok := Validate("not base32!", "123456", time.Unix(59, 0)); ok {
+		t.Error("accepted a code for an undecodable secret")
+	}
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode"
+
+	"hyw-webpics/logging"
+)
+
+var ocrLog = logging.For("ocr")
+
+// TextExtractor extracts the text printed on an image file.
+type TextExtractor interface {
+	ExtractText(path string) (string, error)
+}
+
+// Extractor is the TextExtractor used for uploads. It is a NoopExtractor
+// until InitTextExtractor or a caller replaces it.
+var Extractor TextExtractor = NoopExtractor{}
+
+// OCREnabled reports whether a real OCR engine is configured.
+func OCREnabled() bool {
+	_, noop := Extractor.(NoopExtractor)
+	return !noop
+}
+
+// NoopExtractor is used when no OCR engine is available.
+type NoopExtractor struct{}
+
+func (NoopExtractor) ExtractText(path string) (string, error) {
+	return "", nil
+}
+
+// TesseractExtractor shells out to a locally installed tesseract binary.
+type TesseractExtractor struct {
+	Binary    string
+	Languages string
+	Timeout   time.Duration
+}
+
+func (t TesseractExtractor) ExtractText(path string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.Timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.Binary, path, "stdout", "-l", t.Languages)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("tesseract failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return NormalizeOCRText(stdout.String()), nil
+}
+
+// InitTextExtractor selects tesseract when it is installed, keeping only the
+// requested languages that have trained data available.
+func InitTextExtractor(languages string) {
+	binary, err := exec.LookPath("tesseract")
+	if err != nil {
+		ocrLog.Info("tesseract not found, OCR disabled")
+		Extractor = NoopExtractor{}
+		return
+	}
+
+	available := map[string]bool{}
+	if out, err := exec.Command(binary, "--list-langs").Output(); err == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			available[strings.TrimSpace(line)] = true
+		}
+	}
+
+	var langs []string
+	for _, lang := range strings.Split(languages, "+") {
+		if available[lang] {
+			langs = append(langs, lang)
+		}
+	}
+	if len(langs) == 0 {
+		ocrLog.Warn("tesseract has no trained data, OCR disabled", "languages", languages)
+		Extractor = NoopExtractor{}
+		return
+	}
+
+	ocrLog.Info("OCR enabled using tesseract", "languages", strings.Join(langs, "+"))
+	Extractor = TesseractExtractor{
+		Binary:    binary,
+		Languages: strings.Join(langs, "+"),
+		Timeout:   time.Minute,
+	}
+}
+
+// NormalizeOCRText collapses whitespace and removes the spaces tesseract
+// inserts between adjacent Chinese characters.
+func NormalizeOCRText(text string) string {
+	words := strings.Fields(text)
+	var b strings.Builder
+	for i, w := range words {
+		if i > 0 {
+			prev := []rune(words[i-1])
+			first := []rune(w)
+			if !(unicode.Is(unicode.Han, prev[len(prev)-1]) && unicode.Is(unicode.Han, first[0])) {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(w)
+	}
+	return b.String()
+}
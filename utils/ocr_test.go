@@ -0,0 +1,24 @@
+package utils
+
+import "testing"
+
+func TestNormalizeOCRText(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"empty", "", ""},
+		{"only whitespace", " \n\t ", ""},
+		{"Han joined to Han", "今 天 也 是 表 情 包", "今天也是表情包"},
+		{"across lines", "猫猫\n头", "猫猫头"},
+		{"Latin keeps its spaces", "hello   brave\nnew world", "hello brave new world"},
+		{"Latin next to Han", "我 爱 Go 语 言", "我爱 Go 语言"},
+		{"Han run inside Latin", "say 你 好 now", "say 你好 now"},
+		{"digits are not Han", "第 3 名", "第 3 名"},
+		{"punctuation is not Han", "你 好 ， 世 界", "你好 ， 世界"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeOCRText(tt.in); got != tt.want {
+			t.Errorf("%s: NormalizeOCRText(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// APIKeyPrefix marks bearer credentials that are API keys rather than JWTs.
+const APIKeyPrefix = "hyw_"
+
+// HashToken returns the hex SHA-256 of a high-entropy secret such as a
+// refresh token or API key. Only this hash is stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RandomToken returns n random bytes encoded as unpadded base64url.
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// SignValue appends an HMAC-SHA256 signature to value, for cookies that must
+// not be forgeable.
+func SignValue(secret, value string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(value))
+	return value + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignedValue returns the value of a string produced by SignValue if
+// its signature is valid.
+func VerifySignedValue(secret, signed string) (string, bool) {
+	i := strings.LastIndexByte(signed, '.')
+	if i < 0 {
+		return "", false
+	}
+	value := signed[:i]
+	return value, hmac.Equal([]byte(SignValue(secret, value)), []byte(signed))
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"hyw-webpics/config"
+	"hyw-webpics/logging"
+	"hyw-webpics/metrics"
+)
+
+// VariantWidths are the widths derived variants may be requested at. The list
+// is fixed so the variant cache cannot be grown without bound.
+var VariantWidths = []int{128, 256, 512, 1024}
+
+// VariantFormats maps supported output formats to their content type.
+var VariantFormats = map[string]string{
+	"webp": "image/webp",
+	"png":  "image/png",
+}
+
+const variantDir = "variants"
+
+var imagesLog = logging.For("images")
+
+// ImageVariant returns the file path and public URL of an image resized to
+// width (0 keeps the original size) and encoded as format. Variants are
+// generated on first use and cached under the upload directory.
+func ImageVariant(filename string, width int, format string) (string, string, error) {
+	if width == 0 && format == "webp" {
+		return filepath.Join(config.AppConfig.UploadDir, filename), "/uploads/" + filename, nil
+	}
+
+	name := strings.TrimSuffix(filename, filepath.Ext(filename)) + "." + format
+	sizeDir := "full"
+	if width > 0 {
+		sizeDir = strconv.Itoa(width)
+	}
+
+	outputPath := filepath.Join(config.AppConfig.UploadDir, variantDir, sizeDir, name)
+	urlPath := "/uploads/" + variantDir + "/" + sizeDir + "/" + name
+	if _, err := os.Stat(outputPath); err == nil {
+		return outputPath, urlPath, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return "", "", fmt.Errorf("failed to create variant directory: %w", err)
+	}
+
+	// Encode to a temp file and rename so concurrent requests never see a
+	// partially written variant
+	tempFile, err := os.CreateTemp(filepath.Dir(outputPath), name+".*.tmp")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tempPath := tempFile.Name()
+	tempFile.Close()
+	defer os.Remove(tempPath)
+
+	input := filepath.Join(config.AppConfig.UploadDir, filename)
+	var cmd *exec.Cmd
+	if format == "png" {
+		args := []string{input, "-o", tempPath}
+		if width > 0 {
+			args = append(args, "-resize", strconv.Itoa(width), "0")
+		}
+		cmd = exec.Command("dwebp", args...)
+	} else {
+		cmd = exec.Command("cwebp", "-q", strconv.Itoa(config.AppConfig.WebPQuality), "-resize", strconv.Itoa(width), "0", input, "-o", tempPath)
+	}
+
+	start := time.Now()
+	out, err := cmd.CombinedOutput()
+	metrics.Conversion.Since(start, "variant")
+	if err != nil {
+		return "", "", fmt.Errorf("variant conversion failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	if err := os.Rename(tempPath, outputPath); err != nil {
+		return "", "", fmt.Errorf("failed to store variant: %w", err)
+	}
+
+	return outputPath, urlPath, nil
+}
+
+// RemoveVariants deletes every cached variant of an image.
+func RemoveVariants(filename string) {
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	matches, _ := filepath.Glob(filepath.Join(config.AppConfig.UploadDir, variantDir, "*", base+".*"))
+	for _, path := range matches {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			imagesLog.Warn("Failed to remove variant", "path", path, "err", err)
+		}
+	}
+}
@@ -6,8 +6,13 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"hyw-webpics/config"
+	"hyw-webpics/metrics"
 
 	"github.com/google/uuid"
 )
@@ -35,17 +40,73 @@ func ConvertToWebP(file io.Reader, originalName string) (string, error) {
 		return "", fmt.Errorf("failed to write temp file: %w", err)
 	}
 
-	// Create WebP encoder using system cwebp
-	// Quality 75 is a good balance
-	cmd := exec.Command("cwebp", "-q", "75", tempFile.Name(), "-o", outputPath)
+	// Create WebP encoder using system cwebp, or gif2webp when it is
+	// installed to keep GIF animation
+	encoder := "cwebp"
+	if strings.EqualFold(filepath.Ext(originalName), ".gif") {
+		if encoderAvailable("gif2webp") {
+			encoder = "gif2webp"
+		} else {
+			gifFallback.Do(func() {
+				imagesLog.Warn("gif2webp not found, converting GIFs with cwebp")
+			})
+		}
+	}
+	defer metrics.Conversion.Since(time.Now(), "upload")
+	cmd := exec.Command(encoder, "-q", strconv.Itoa(config.AppConfig.WebPQuality), tempFile.Name(), "-o", outputPath)
 	if err := cmd.Run(); err != nil {
-		// Fallback: If cwebp is not in path, it might be in .bin (for local dev)
-		localCwebp := filepath.Join(".", ".bin", "webp", "cwebp.exe")
-		cmd = exec.Command(localCwebp, "-q", "75", tempFile.Name(), "-o", outputPath)
+		// Fallback: If the encoder is not in path, it might be in .bin (for local dev)
+		cmd = exec.Command(localEncoder(encoder), "-q", strconv.Itoa(config.AppConfig.WebPQuality), tempFile.Name(), "-o", outputPath)
 		if err2 := cmd.Run(); err2 != nil {
-			return "", fmt.Errorf("webp conversion failed (system cwebp err: %v, local cwebp err: %v)", err, err2)
+			return "", fmt.Errorf("webp conversion failed (system %s err: %v, local %s err: %v)", encoder, err, encoder, err2)
 		}
 	}
 
 	return filename, nil
 }
+
+// gifFallback warns once that GIFs are converted without gif2webp.
+var gifFallback sync.Once
+
+// localEncoder is where an encoder is looked for when it is not on PATH.
+func localEncoder(name string) string {
+	return filepath.Join(".", ".bin", "webp", name+".exe")
+}
+
+// encoderAvailable reports whether name can be found on PATH or in the
+// local .bin fallback ConvertToWebP also tries.
+func encoderAvailable(name string) bool {
+	if _, err := exec.LookPath(name); err == nil {
+		return true
+	}
+	_, err := os.Stat(localEncoder(name))
+	return err == nil
+}
+
+// CheckEncoder reports an error unless cwebp, which converts every upload
+// but GIFs when gif2webp is installed, can be found.
+func CheckEncoder() error {
+	if encoderAvailable("cwebp") {
+		return nil
+	}
+	return fmt.Errorf("cwebp not found")
+}
+
+// IsAnimatedWebP reports whether the WebP file at path has the animation flag
+// set in its extended (VP8X) header.
+func IsAnimatedWebP(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, 21)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WEBP" || string(header[12:16]) != "VP8X" {
+		return false
+	}
+	return header[20]&0x02 != 0
+}
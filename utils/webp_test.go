@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hyw-webpics/config"
+)
+
+// fakeEncoders puts scripts named after each encoder on PATH, alone, that
+// write their own name to the -o file.
+func fakeEncoders(t *testing.T, names ...string) {
+	t.Helper()
+	bin := t.TempDir()
+	for _, name := range names {
+		script := "#!/bin/sh\nwhile [ \"$1\" != -o ]; do shift; done\necho " + name + " > \"$2\"\n"
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin)
+}
+
+func TestConvertToWebPEncoder(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("UPLOAD_DIR", t.TempDir())
+	if _, err := config.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		installed []string
+		upload    string
+		want      string
+	}{
+		{"png", []string{"cwebp", "gif2webp"}, "a.png", "cwebp"},
+		{"gif", []string{"cwebp", "gif2webp"}, "a.GIF", "gif2webp"},
+		{"gif without gif2webp", []string{"cwebp"}, "a.gif", "cwebp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeEncoders(t, tt.installed...)
+			filename, err := ConvertToWebP(strings.NewReader("image"), tt.upload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := os.ReadFile(filepath.Join(config.AppConfig.UploadDir, filename))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(string(out)); got != tt.want {
+				t.Errorf("converted with %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+// Package web embeds the built Vue frontend into the server binary. Run
+// `npm run build` here before `go build`; a binary built without it serves
+// a page saying so.
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+// Dist returns the embedded build, rooted at its index.html.
+func Dist() fs.FS {
+	sub, err := fs.Sub(dist, "dist")
+	if err != nil {
+		// dist is a constant, valid path
+		panic(err)
+	}
+	return sub
+}
@@ -16,19 +16,87 @@ api.interceptors.request.use(config => {
     return config
 })
 
+// Access tokens are short-lived: on a 401, trade the refresh token for a new
+// pair once and retry. Concurrent failures share a single refresh request.
+let refreshing = null
+api.interceptors.response.use(null, async error => {
+    const original = error.config
+    const refreshToken = localStorage.getItem('refresh_token')
+    if (error.response?.status !== 401 || !refreshToken || original._retried || original.url.startsWith('/auth/')) {
+        throw error
+    }
+
+    refreshing = refreshing || axios.post('/api/auth/refresh', { refresh_token: refreshToken })
+        .then(res => {
+            localStorage.setItem('token', res.data.token)
+            localStorage.setItem('refresh_token', res.data.refresh_token)
+        })
+        .catch(() => {
+            localStorage.removeItem('token')
+            localStorage.removeItem('refresh_token')
+        })
+        .finally(() => { refreshing = null })
+    await refreshing
+
+    if (!localStorage.getItem('token')) throw error
+    original._retried = true
+    return api(original)
+})
+
+// The shared admin password session needs the admin_token from the login
+// alongside its cookie. Without one, admin calls use the signed-in user's
+// role instead.
+const admin = (config = {}) => ({ ...config, headers: { 'X-Admin-Token': sessionStorage.getItem('admin_token') || '' } })
+
 // Auth API
 export const authApi = {
     register: (username, password) => api.post('/auth/register', { username, password }),
+    // With two-factor enabled this returns { two_factor_required, challenge } instead of a session
     login: (username, password) => api.post('/auth/login', { username, password }),
-    getMe: () => api.get('/auth/me')
+    login2fa: (challenge, code) => api.post('/auth/login/2fa', { challenge, code }),
+    getMe: () => api.get('/auth/me'),
+    logout: (refreshToken) => api.post('/auth/logout', { refresh_token: refreshToken }),
+    logoutAll: () => api.post('/auth/logout-all'),
+    // Returns a fresh session; every other session is signed out
+    changePassword: (currentPassword, newPassword) => api.put('/me/password', { current_password: currentPassword, new_password: newPassword }),
+    // uploads: 'anonymize' keeps approved images without an uploader, 'remove' deletes them
+    deleteAccount: (password, uploads) => api.delete('/me', { data: { password, uploads } })
+}
+
+// User API
+export const userApi = {
+    getProfile: (username) => api.get(`/users/${encodeURIComponent(username)}`),
+    getImages: (username, params = {}) => api.get(`/users/${encodeURIComponent(username)}/images`, { params }),
+    updateProfile: (data) => api.put('/me/profile', data),
+    uploadAvatar: (file) => {
+        const formData = new FormData()
+        formData.append('avatar', file)
+        return api.post('/me/avatar', formData, {
+            headers: { 'Content-Type': 'multipart/form-data' }
+        })
+    },
+    deleteAvatar: () => api.delete('/me/avatar'),
+    // Trust level and remaining upload quota; null means unlimited
+    getQuota: () => api.get('/me/quota'),
+    getApiKeys: () => api.get('/me/api-keys'),
+    // scopes: any of 'upload', 'read', 'favorite'; the key is only returned here
+    createApiKey: (name, scopes, expiresInDays = 0) => api.post('/me/api-keys', { name, scopes, expires_in_days: expiresInDays }),
+    revokeApiKey: (id) => api.delete(`/me/api-keys/${id}`),
+    getTwoFactor: () => api.get('/me/2fa'),
+    // Returns { secret, otpauth_uri } to show as a QR code
+    setupTwoFactor: () => api.post('/me/2fa/setup'),
+    // Returns the recovery codes, shown only once
+    enableTwoFactor: (code) => api.post('/me/2fa/enable', { code }),
+    disableTwoFactor: (password, code) => api.post('/me/2fa/disable', { password, code }),
+    regenerateRecoveryCodes: (code) => api.post('/me/2fa/recovery-codes', { code })
 }
 
 // Category API
 export const categoryApi = {
     getAll: () => api.get('/categories'),
-    create: (data) => api.post('/admin/categories', data, { headers: { 'X-Admin-Token': 'admin' } }),
-    update: (id, data) => api.put(`/admin/categories/${id}`, data, { headers: { 'X-Admin-Token': 'admin' } }),
-    delete: (id) => api.delete(`/admin/categories/${id}`, { headers: { 'X-Admin-Token': 'admin' } })
+    create: (data) => api.post('/admin/categories', data, admin()),
+    update: (id, data) => api.put(`/admin/categories/${id}`, data, admin()),
+    delete: (id) => api.delete(`/admin/categories/${id}`, admin())
 }
 
 // Image API
@@ -38,12 +106,34 @@ export const imageApi = {
         if (categoryId) url += `&category_id=${categoryId}`
         return api.get(url)
     },
+    // Cursor mode: pass { cursor: '' } for the first page, then next_cursor
+    list: (params = {}) => api.get('/images', { params }),
     getRandom: (categoryId = '') => {
         let url = '/images/random'
         if (categoryId) url += `?category_id=${categoryId}`
         return api.get(url)
     },
-    upload: (files, categoryId = '') => {
+    // params: { count, session, seed, tag, category_id, animated }
+    getRandomBatch: (params = {}) => api.get('/images/random', { params: { count: 1, ...params } }),
+    search: (q, page = 1, limit = 20, categoryId = '') => {
+        const params = { q, page, limit }
+        if (categoryId) params.category_id = categoryId
+        return api.get('/images/search', { params })
+    },
+    get: (id) => api.get(`/images/${id}`),
+    share: (id) => api.post(`/images/${id}/share`),
+    getTrending: (window = 'day', limit = 20) => api.get('/images/trending', { params: { window, limit } }),
+    favorite: (id) => api.post(`/images/${id}/favorite`),
+    unfavorite: (id) => api.delete(`/images/${id}/favorite`),
+    getFavorites: (params = {}) => api.get('/me/favorites', { params }),
+    getComments: (id, page = 1, limit = 20) => api.get(`/images/${id}/comments`, { params: { page, limit } }),
+    // parentId replies to a comment; threads are one level deep
+    comment: (id, body, parentId = null) => api.post(`/images/${id}/comments`, { body, parent_id: parentId }),
+    editComment: (commentId, body) => api.put(`/comments/${commentId}`, { body }),
+    deleteComment: (commentId) => api.delete(`/comments/${commentId}`),
+    // reason: spam | nsfw | offensive | copyright | other
+    report: (id, reason, details = '') => api.post(`/images/${id}/report`, { reason, details }),
+    upload: (files, categoryId = '', meta = {}) => {
         const formData = new FormData()
         // Handle both single file and array of files
         if (Array.isArray(files)) {
@@ -53,24 +143,55 @@ export const imageApi = {
         }
 
         if (categoryId) formData.append('category_id', categoryId)
+        if (meta.title) formData.append('title', meta.title)
+        if (meta.tags) formData.append('tags', Array.isArray(meta.tags) ? meta.tags.join(',') : meta.tags)
         return api.post('/images/upload', formData, {
             headers: { 'Content-Type': 'multipart/form-data' }
         })
     }
 }
 
+// Collections API
+export const collectionApi = {
+    listPublic: (params = {}) => api.get('/collections', { params }),
+    listMine: (params = {}) => api.get('/me/collections', { params }),
+    get: (slug, params = {}) => api.get(`/collections/${slug}`, { params }),
+    // data: { name, description, visibility: 'private' | 'unlisted' | 'public' }
+    create: (data) => api.post('/collections', data),
+    update: (slug, data) => api.put(`/collections/${slug}`, data),
+    remove: (slug) => api.delete(`/collections/${slug}`),
+    addImage: (slug, imageId) => api.post(`/collections/${slug}/images`, { image_id: imageId }),
+    removeImage: (slug, imageId) => api.delete(`/collections/${slug}/images/${imageId}`),
+    reorder: (slug, imageIds) => api.put(`/collections/${slug}/order`, { image_ids: imageIds })
+}
+
 // Admin API
 export const adminApi = {
-    login: (password) => api.post('/admin/login', { password }),
-    logout: () => api.post('/admin/logout'),
-    getPending: () => api.get('/admin/pending', { headers: { 'X-Admin-Token': 'admin' } }),
-    getImages: (params) => api.get('/admin/images', { params, headers: { 'X-Admin-Token': 'admin' } }),
-    approve: (id, categoryId) => api.post(`/admin/approve/${id}`, { category_id: categoryId }, { headers: { 'X-Admin-Token': 'admin' } }),
-    reject: (id) => api.post(`/admin/reject/${id}`, {}, { headers: { 'X-Admin-Token': 'admin' } }),
-    deleteImage: (id) => api.delete(`/admin/images/${id}`, { headers: { 'X-Admin-Token': 'admin' } }),
-    bulkApprove: (ids, categoryId) => api.post('/admin/bulk-approve', { ids, category_id: categoryId }, { headers: { 'X-Admin-Token': 'admin' } }),
-    bulkDelete: (ids) => api.post('/admin/bulk-delete', { ids }, { headers: { 'X-Admin-Token': 'admin' } }),
-    getStats: () => api.get('/admin/stats', { headers: { 'X-Admin-Token': 'admin' } })
+    // code is required when ADMIN_TOTP_SECRET is set
+    login: (password, code = '') => api.post('/admin/login', { password, code })
+        .then(res => { sessionStorage.setItem('admin_token', res.data.admin_token); return res }),
+    logout: () => api.post('/admin/logout').finally(() => sessionStorage.removeItem('admin_token')),
+    getPending: () => api.get('/admin/pending', admin()),
+    getImages: (params) => api.get('/admin/images', admin({ params })),
+    approve: (id, categoryId) => api.post(`/admin/approve/${id}`, { category_id: categoryId }, admin()),
+    reject: (id) => api.post(`/admin/reject/${id}`, {}, admin()),
+    updateImageText: (id, text) => api.put(`/admin/images/${id}/text`, { text }, admin()),
+    deleteImage: (id) => api.delete(`/admin/images/${id}`, admin()),
+    bulkApprove: (ids, categoryId) => api.post('/admin/bulk-approve', { ids, category_id: categoryId }, admin()),
+    bulkDelete: (ids) => api.post('/admin/bulk-delete', { ids }, admin()),
+    getStats: () => api.get('/admin/stats', admin()),
+    getComments: (params) => api.get('/admin/comments', admin({ params })),
+    hideComment: (id, reason = '') => api.post(`/admin/comments/${id}/hide`, { reason }, admin()),
+    unhideComment: (id, reason = '') => api.post(`/admin/comments/${id}/unhide`, { reason }, admin()),
+    deleteComment: (id, reason = '') => api.delete(`/admin/comments/${id}`, admin({ data: { reason } })),
+    getReports: (params) => api.get('/admin/reports', admin({ params })),
+    getImageReports: (id, status = 'open') => api.get(`/admin/reports/images/${id}`, admin({ params: { status } })),
+    // action: 'dismiss' returns the image to circulation, 'remove' deletes it
+    resolveReports: (id, action, reason = '') => api.post(`/admin/reports/images/${id}/resolve`, { action, reason }, admin()),
+    getModerationLog: (params) => api.get('/admin/moderation', admin({ params })),
+    getBackups: () => api.get('/admin/backups', admin()),
+    // incremental leaves out media the newest archive already holds
+    createBackup: (incremental = false) => api.post('/admin/backups', { incremental }, admin())
 }
 
 export default api